@@ -1,10 +1,13 @@
 package flow
 
 import (
+	"context"
 	"errors"
+	"flow/model"
 	"flow/schema"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/teambition/gear"
 )
@@ -68,7 +71,7 @@ func (a *API) QueryFlowPage(ctx *gear.Context) error {
 
 // GetFlow 获取流程数据
 func (a *API) GetFlow(ctx *gear.Context) error {
-	item, err := a.engine.flowBll.GetFlow(ctx.Param("id"))
+	item, err := a.engine.flowBll.GetFlow(context.Background(), ctx.Param("id"))
 	if err != nil {
 		return gear.ErrInternalServerError.From(err)
 	}
@@ -108,3 +111,124 @@ func (a *API) DeleteFlow(ctx *gear.Context) error {
 	}
 	return ctx.JSON(http.StatusOK, "ok")
 }
+
+// 转换外部任务的处理错误：任务不存在时返回404，未被当前工作者锁定或并发冲突时返回409
+func externalTaskError(err error) error {
+	switch {
+	case errors.Is(err, ErrExternalTaskNotFound), errors.Is(err, ErrNotFound):
+		return gear.ErrNotFound.From(err)
+	case errors.Is(err, ErrExternalTaskNotLocked), model.IsConflict(err):
+		return gear.ErrConflict.From(err)
+	}
+	return gear.ErrInternalServerError.From(err)
+}
+
+type fetchAndLockRequest struct {
+	WorkerID     string `json:"worker_id"`
+	Topic        string `json:"topic"`
+	MaxTasks     int    `json:"max_tasks"`
+	LockDuration int64  `json:"lock_duration"` // 锁定时长(毫秒)
+}
+
+func (a *fetchAndLockRequest) Validate() error {
+	if a.WorkerID == "" || a.Topic == "" || a.MaxTasks <= 0 || a.LockDuration <= 0 {
+		return errors.New("无效的请求参数")
+	}
+	return nil
+}
+
+// FetchAndLockExternalTask 领取并锁定外部任务
+func (a *API) FetchAndLockExternalTask(ctx *gear.Context) error {
+	var req fetchAndLockRequest
+	if err := ctx.ParseBody(&req); err != nil {
+		return gear.ErrBadRequest.From(err)
+	}
+
+	items, err := a.engine.FetchAndLock(req.Topic, req.WorkerID, req.MaxTasks, time.Duration(req.LockDuration)*time.Millisecond)
+	if err != nil {
+		return externalTaskError(err)
+	} else if items == nil {
+		items = []*LockedExternalTask{}
+	}
+	return ctx.JSON(http.StatusOK, items)
+}
+
+type completeExternalTaskRequest struct {
+	WorkerID  string                 `json:"worker_id"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+func (a *completeExternalTaskRequest) Validate() error {
+	if a.WorkerID == "" {
+		return errors.New("无效的请求参数")
+	}
+	return nil
+}
+
+// CompleteExternalTask 完成外部任务
+func (a *API) CompleteExternalTask(ctx *gear.Context) error {
+	var req completeExternalTaskRequest
+	if err := ctx.ParseBody(&req); err != nil {
+		return gear.ErrBadRequest.From(err)
+	}
+
+	result, err := a.engine.CompleteExternalTask(context.Background(), ctx.Param("id"), req.WorkerID, req.Variables)
+	if err != nil {
+		return externalTaskError(err)
+	}
+	return ctx.JSON(http.StatusOK, result)
+}
+
+type externalTaskFailureRequest struct {
+	WorkerID     string `json:"worker_id"`
+	ErrorMessage string `json:"error_message"`
+	Retries      int    `json:"retries"`
+	RetryTimeout int64  `json:"retry_timeout"` // 重新领取前的等待时间(毫秒)
+}
+
+func (a *externalTaskFailureRequest) Validate() error {
+	if a.WorkerID == "" || a.RetryTimeout < 0 {
+		return errors.New("无效的请求参数")
+	}
+	return nil
+}
+
+// HandleExternalTaskFailure 处理外部任务执行失败
+func (a *API) HandleExternalTaskFailure(ctx *gear.Context) error {
+	var req externalTaskFailureRequest
+	if err := ctx.ParseBody(&req); err != nil {
+		return gear.ErrBadRequest.From(err)
+	}
+
+	err := a.engine.HandleExternalTaskFailure(ctx.Param("id"), req.WorkerID, req.ErrorMessage, req.Retries, time.Duration(req.RetryTimeout)*time.Millisecond)
+	if err != nil {
+		return externalTaskError(err)
+	}
+	return ctx.JSON(http.StatusOK, "ok")
+}
+
+type extendExternalTaskLockRequest struct {
+	WorkerID    string `json:"worker_id"`
+	NewDuration int64  `json:"new_duration"` // 新的锁定时长(毫秒)
+}
+
+func (a *extendExternalTaskLockRequest) Validate() error {
+	if a.WorkerID == "" || a.NewDuration <= 0 {
+		return errors.New("无效的请求参数")
+	}
+	return nil
+}
+
+// ExtendExternalTaskLock 延长外部任务的锁定时间
+func (a *API) ExtendExternalTaskLock(ctx *gear.Context) error {
+	var req extendExternalTaskLockRequest
+	if err := ctx.ParseBody(&req); err != nil {
+		return gear.ErrBadRequest.From(err)
+	}
+
+	err := a.engine.ExtendExternalTaskLock(ctx.Param("id"), req.WorkerID, time.Duration(req.NewDuration)*time.Millisecond)
+	if err != nil {
+		return externalTaskError(err)
+	}
+	return ctx.JSON(http.StatusOK, "ok")
+}
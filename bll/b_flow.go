@@ -1,28 +1,61 @@
 package bll
 
 import (
+	"context"
+	"encoding/json"
 	"flow/model"
 	"flow/schema"
 	"flow/util"
 	"fmt"
-	"sync"
 	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 流程实例并发冲突时重新执行事务的最大次数
+const flowInstanceConflictRetries = 5
+
+// 定义外部任务错误
+var (
+	ErrExternalTaskNotFound  = errors.New("无效的外部任务")
+	ErrExternalTaskNotLocked = errors.New("外部任务未被当前工作者锁定")
 )
 
 // Flow 流程管理
 type Flow struct {
-	sync.RWMutex
-	FlowModel *model.Flow `inject:""`
+	FlowModel model.Store
+}
+
+// Transaction 在事务中执行流程操作
+// 最外层的事务因流程实例已被其他事务更新(如并行分支同时到达汇聚网关)而冲突时，重新执行整个事务
+func (a *Flow) Transaction(ctx context.Context, fn func(context.Context) error) error {
+	if model.InTransaction(ctx) {
+		return a.FlowModel.Transaction(ctx, fn)
+	}
+
+	for i := 0; ; i++ {
+		err := a.FlowModel.Transaction(ctx, fn)
+		if i < flowInstanceConflictRetries && isFlowInstanceConflict(err) {
+			continue
+		}
+		return err
+	}
+}
+
+// 检查是否为流程实例的并发更新冲突
+func isFlowInstanceConflict(err error) bool {
+	e, ok := errors.Cause(err).(*model.ConflictError)
+	return ok && e.Table == schema.FlowInstanceTableName
 }
 
 // GetFlow 获取流程数据
-func (a *Flow) GetFlow(recordID string) (*schema.Flow, error) {
-	return a.FlowModel.GetFlow(recordID)
+func (a *Flow) GetFlow(ctx context.Context, recordID string) (*schema.Flow, error) {
+	return a.FlowModel.GetFlow(ctx, recordID)
 }
 
 // GetFlowByCode 根据编号查询流程数据
-func (a *Flow) GetFlowByCode(code string) (*schema.Flow, error) {
-	return a.FlowModel.GetFlowByCode(code)
+func (a *Flow) GetFlowByCode(ctx context.Context, code string) (*schema.Flow, error) {
+	return a.FlowModel.GetFlowByCode(ctx, code)
 }
 
 // QueryFlowByCode 根据流程编号查询流程数据
@@ -31,54 +64,155 @@ func (a *Flow) QueryFlowByCode(flowCode string) ([]*schema.Flow, error) {
 }
 
 // CreateFlow 创建流程数据
-func (a *Flow) CreateFlow(flow *schema.Flow, nodes *schema.NodeOperating, forms *schema.FormOperating) error {
+func (a *Flow) CreateFlow(ctx context.Context, flow *schema.Flow, nodes *schema.NodeOperating, forms *schema.FormOperating) error {
 	if flow.Flag == 0 {
 		flow.Flag = 1
 	}
-	return a.FlowModel.CreateFlow(flow, nodes, forms)
+	return a.FlowModel.CreateFlow(ctx, flow, nodes, forms)
 }
 
 // GetNode 获取流程节点
-func (a *Flow) GetNode(recordID string) (*schema.Node, error) {
-	return a.FlowModel.GetNode(recordID)
+func (a *Flow) GetNode(ctx context.Context, recordID string) (*schema.Node, error) {
+	return a.FlowModel.GetNode(ctx, recordID)
+}
+
+// GetNodeByCode 根据流程内码和节点编号获取流程节点
+func (a *Flow) GetNodeByCode(ctx context.Context, flowID, nodeCode string) (*schema.Node, error) {
+	return a.FlowModel.GetNodeByCode(ctx, flowID, nodeCode)
 }
 
 // GetFlowInstance 获取流程实例
-func (a *Flow) GetFlowInstance(recordID string) (*schema.FlowInstance, error) {
-	return a.FlowModel.GetFlowInstance(recordID)
+func (a *Flow) GetFlowInstance(ctx context.Context, recordID string) (*schema.FlowInstance, error) {
+	return a.FlowModel.GetFlowInstance(ctx, recordID)
 }
 
 // GetFlowInstanceByNode 根据节点实例获取流程实例
-func (a *Flow) GetFlowInstanceByNode(nodeInstanceID string) (*schema.FlowInstance, error) {
-	return a.FlowModel.GetFlowInstanceByNode(nodeInstanceID)
+func (a *Flow) GetFlowInstanceByNode(ctx context.Context, nodeInstanceID string) (*schema.FlowInstance, error) {
+	return a.FlowModel.GetFlowInstanceByNode(ctx, nodeInstanceID)
 }
 
 // GetNodeInstance 获取流程节点实例
-func (a *Flow) GetNodeInstance(recordID string) (*schema.NodeInstance, error) {
-	return a.FlowModel.GetNodeInstance(recordID)
+func (a *Flow) GetNodeInstance(ctx context.Context, recordID string) (*schema.NodeInstance, error) {
+	return a.FlowModel.GetNodeInstance(ctx, recordID)
 }
 
 // QueryNodeRouters 查询节点路由
-func (a *Flow) QueryNodeRouters(sourceNodeID string) ([]*schema.NodeRouter, error) {
-	return a.FlowModel.QueryNodeRouters(sourceNodeID)
+func (a *Flow) QueryNodeRouters(ctx context.Context, sourceNodeID string) ([]*schema.NodeRouter, error) {
+	return a.FlowModel.QueryNodeRouters(ctx, sourceNodeID)
+}
+
+// QueryNodeRoutersByTarget 查询流入节点的路由
+func (a *Flow) QueryNodeRoutersByTarget(ctx context.Context, targetNodeID string) ([]*schema.NodeRouter, error) {
+	return a.FlowModel.QueryNodeRoutersByTarget(ctx, targetNodeID)
+}
+
+// QueryPendingNodeInstances 查询流程实例中待处理的节点实例
+func (a *Flow) QueryPendingNodeInstances(ctx context.Context, flowInstanceID string) ([]*schema.NodeInstance, error) {
+	return a.FlowModel.QueryPendingNodeInstances(ctx, flowInstanceID)
+}
+
+// QueryNodesByProperty 查询设定指定属性值的节点
+func (a *Flow) QueryNodesByProperty(ctx context.Context, name, value string) ([]*schema.Node, error) {
+	return a.FlowModel.QueryNodesByProperty(ctx, name, value)
+}
+
+// QueryPendingNodeInstancesByNode 查询节点的待处理节点实例
+func (a *Flow) QueryPendingNodeInstancesByNode(ctx context.Context, nodeID string) ([]*schema.NodeInstance, error) {
+	return a.FlowModel.QueryPendingNodeInstancesByNode(ctx, nodeID)
+}
+
+// CheckNodeReachable 检查从源节点出发(不经过目标节点)是否可以到达目标节点
+func (a *Flow) CheckNodeReachable(ctx context.Context, sourceNodeID, targetNodeID string) (bool, error) {
+	visited := map[string]bool{sourceNodeID: true}
+	queue := []string{sourceNodeID}
+	for len(queue) > 0 {
+		nodeID := queue[0]
+		queue = queue[1:]
+
+		routers, err := a.FlowModel.QueryNodeRouters(ctx, nodeID)
+		if err != nil {
+			return false, err
+		}
+
+		targets := make([]string, len(routers))
+		for i, r := range routers {
+			targets[i] = r.TargetNodeID
+		}
+
+		// 附加在节点上的边界事件同样可以流转
+		node, err := a.FlowModel.GetNode(ctx, nodeID)
+		if err != nil {
+			return false, err
+		} else if node != nil {
+			events, err := a.QueryBoundaryEvents(ctx, node)
+			if err != nil {
+				return false, err
+			}
+			for _, event := range events {
+				targets = append(targets, event.RecordID)
+			}
+		}
+
+		for _, target := range targets {
+			if target == targetNodeID {
+				return true, nil
+			} else if !visited[target] {
+				visited[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+	return false, nil
 }
 
 // QueryNodeAssignments 查询节点指派
-func (a *Flow) QueryNodeAssignments(nodeID string) ([]*schema.NodeAssignment, error) {
-	return a.FlowModel.QueryNodeAssignments(nodeID)
+func (a *Flow) QueryNodeAssignments(ctx context.Context, nodeID string) ([]*schema.NodeAssignment, error) {
+	return a.FlowModel.QueryNodeAssignments(ctx, nodeID)
 }
 
 // CreateNodeInstance 创建节点实例
-func (a *Flow) CreateNodeInstance(flowInstanceID, nodeID string, inputData []byte, candidates []string) (string, error) {
+// routerID 流入的路由内码(非经路由流转的节点实例为空)
+func (a *Flow) CreateNodeInstance(ctx context.Context, flowInstanceID, nodeID, routerID string, inputData []byte, candidates []string) (string, error) {
+	nodeInstance := &schema.NodeInstance{
+		RecordID:       util.UUID(),
+		FlowInstanceID: flowInstanceID,
+		NodeID:         nodeID,
+		RouterID:       routerID,
+		InputData:      string(inputData),
+		Status:         1,
+		Created:        time.Now().Unix(),
+	}
+	return a.createNodeInstance(ctx, nodeInstance, candidates)
+}
+
+// CreateLoopNodeInstance 创建多实例节点实例
+// loopID 多实例激活内码
+// loopCounter 多实例序号
+// collection 多实例集合
+func (a *Flow) CreateLoopNodeInstance(ctx context.Context, flowInstanceID, nodeID, routerID string, inputData []byte, candidates []string, loopID string, loopCounter int, collection []string) (string, error) {
+	loopData, _ := json.Marshal(collection)
 	nodeInstance := &schema.NodeInstance{
 		RecordID:       util.UUID(),
 		FlowInstanceID: flowInstanceID,
 		NodeID:         nodeID,
+		RouterID:       routerID,
 		InputData:      string(inputData),
 		Status:         1,
+		LoopID:         loopID,
+		LoopCounter:    int64(loopCounter),
+		LoopData:       string(loopData),
 		Created:        time.Now().Unix(),
 	}
+	return a.createNodeInstance(ctx, nodeInstance, candidates)
+}
+
+// QueryLoopNodeInstances 查询同一次激活的多实例节点实例
+func (a *Flow) QueryLoopNodeInstances(ctx context.Context, loopID string) ([]*schema.NodeInstance, error) {
+	return a.FlowModel.QueryLoopNodeInstances(ctx, loopID)
+}
 
+// 创建节点实例及节点候选人
+func (a *Flow) createNodeInstance(ctx context.Context, nodeInstance *schema.NodeInstance, candidates []string) (string, error) {
 	var nodeCandidates []*schema.NodeCandidate
 	for _, c := range candidates {
 		nodeCandidates = append(nodeCandidates, &schema.NodeCandidate{
@@ -89,7 +223,7 @@ func (a *Flow) CreateNodeInstance(flowInstanceID, nodeID string, inputData []byt
 		})
 	}
 
-	err := a.FlowModel.CreateNodeInstance(nodeInstance, nodeCandidates)
+	err := a.FlowModel.CreateNodeInstance(ctx, nodeInstance, nodeCandidates)
 	if err != nil {
 		return "", err
 	}
@@ -97,16 +231,12 @@ func (a *Flow) CreateNodeInstance(flowInstanceID, nodeID string, inputData []byt
 	return nodeInstance.RecordID, nil
 }
 
-// DoneNodeInstance 完成节点实例
-func (a *Flow) DoneNodeInstance(nodeInstanceID, processor string, outData []byte) error {
-	// 加锁保证节点实例的处理过程
-	a.Lock()
-	defer a.Unlock()
-
-	nodeInstance, err := a.FlowModel.GetNodeInstance(nodeInstanceID)
+// DoneNodeInstance 完成节点实例(按版本号更新，并发处理同一节点时返回model.ConflictError)
+func (a *Flow) DoneNodeInstance(ctx context.Context, nodeInstanceID, processor string, outData []byte) error {
+	nodeInstance, err := a.FlowModel.GetNodeInstance(ctx, nodeInstanceID)
 	if err != nil {
 		return err
-	} else if nodeInstance == nil || nodeInstance.Status == 2 {
+	} else if nodeInstance == nil || nodeInstance.Status != 1 {
 		return fmt.Errorf("无效的处理节点")
 	}
 
@@ -117,39 +247,136 @@ func (a *Flow) DoneNodeInstance(nodeInstanceID, processor string, outData []byte
 		"status":       2,
 		"updated":      time.Now().Unix(),
 	}
-	return a.FlowModel.UpdateNodeInstance(nodeInstanceID, info)
+	return a.FlowModel.UpdateNodeInstanceWithVersion(ctx, nodeInstanceID, 1, nodeInstance.Version, info)
+}
+
+// CancelNodeInstance 取消待处理的节点实例(如中断边界事件触发时)
+func (a *Flow) CancelNodeInstance(ctx context.Context, nodeInstanceID string) error {
+	nodeInstance, err := a.FlowModel.GetNodeInstance(ctx, nodeInstanceID)
+	if err != nil {
+		return err
+	} else if nodeInstance == nil || nodeInstance.Status != 1 {
+		return fmt.Errorf("无效的处理节点")
+	}
+
+	info := map[string]interface{}{
+		"status":  3,
+		"updated": time.Now().Unix(),
+	}
+	return a.FlowModel.UpdateNodeInstanceWithVersion(ctx, nodeInstanceID, 1, nodeInstance.Version, info)
+}
+
+// QueryBoundaryEvents 查询附加在节点上的边界事件
+func (a *Flow) QueryBoundaryEvents(ctx context.Context, node *schema.Node) ([]*schema.Node, error) {
+	items, err := a.FlowModel.QueryNodeByTypeCodeAndFlowIDs(ctx, "boundaryEvent", node.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*schema.Node
+	for _, item := range items {
+		prop, err := a.GetNodeProperty(ctx, item.RecordID)
+		if err != nil {
+			return nil, err
+		} else if prop["attached_to"] == node.Code {
+			events = append(events, item)
+		}
+	}
+	return events, nil
+}
+
+// SetNodeInstanceDueAt 设定节点实例的截止时间
+func (a *Flow) SetNodeInstanceDueAt(ctx context.Context, nodeInstanceID string, dueAt int64) error {
+	return a.FlowModel.UpdateNodeInstance(ctx, nodeInstanceID, map[string]interface{}{"due_at": dueAt})
 }
 
 // CheckFlowInstanceTodo 检查流程实例待办事项
-func (a *Flow) CheckFlowInstanceTodo(flowInstanceID string) (bool, error) {
-	return a.FlowModel.CheckFlowInstanceTodo(flowInstanceID)
+func (a *Flow) CheckFlowInstanceTodo(ctx context.Context, flowInstanceID string) (bool, error) {
+	return a.FlowModel.CheckFlowInstanceTodo(ctx, flowInstanceID)
 }
 
 // DoneFlowInstance 完成流程实例
-func (a *Flow) DoneFlowInstance(flowInstanceID string) error {
-	info := map[string]interface{}{
-		"status": 9,
+func (a *Flow) DoneFlowInstance(ctx context.Context, flowInstanceID string) error {
+	return a.updateFlowInstanceStatus(ctx, flowInstanceID, 9)
+}
+
+// StopFlowInstance 停止流程实例(取消待处理的节点实例，并停止进行中的子流程实例)
+func (a *Flow) StopFlowInstance(ctx context.Context, flowInstanceID string) error {
+	err := a.updateFlowInstanceStatus(ctx, flowInstanceID, 9)
+	if err != nil {
+		return err
+	}
+
+	// 取消待处理的节点实例并移除其定时，避免停止后仍有待办或定时继续流转
+	items, err := a.FlowModel.QueryPendingNodeInstances(ctx, flowInstanceID)
+	if err != nil {
+		return err
 	}
-	return a.FlowModel.UpdateFlowInstance(flowInstanceID, info)
+
+	for _, item := range items {
+		err = a.CancelNodeInstance(ctx, item.RecordID)
+		if err != nil {
+			return err
+		}
+
+		err = a.DeleteNodeTiming(ctx, item.RecordID)
+		if err != nil {
+			return err
+		}
+	}
+	return a.StopSubFlowInstances(ctx, flowInstanceID, "")
 }
 
-// StopFlowInstance 停止流程实例
-func (a *Flow) StopFlowInstance(flowInstanceID string) error {
-	info := map[string]interface{}{
-		"status": 9,
+// StopSubFlowInstances 停止进行中的子流程实例
+// parentNodeInstanceID 不为空时仅停止由该节点实例调用的子流程实例
+func (a *Flow) StopSubFlowInstances(ctx context.Context, flowInstanceID, parentNodeInstanceID string) error {
+	items, err := a.FlowModel.QuerySubFlowInstances(ctx, flowInstanceID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if parentNodeInstanceID != "" && item.ParentNodeInstanceID != parentNodeInstanceID {
+			continue
+		}
+
+		err = a.StopFlowInstance(ctx, item.RecordID)
+		if err != nil {
+			return err
+		}
 	}
-	return a.FlowModel.UpdateFlowInstance(flowInstanceID, info)
+	return nil
 }
 
-// LaunchFlowInstance2 发起流程实例（基于流程ID），返回流程实例、开始事件节点实例
-func (a *Flow) LaunchFlowInstance2(flowID, userID string, status int, inputData []byte) (*schema.FlowInstance, *schema.NodeInstance, error) {
-	node, err := a.GetNodeByFlowAndTypeCode(flowID, "startEvent")
+// LockFlowInstance 按版本号更新流程实例，同一流程实例的汇聚等处理在并发事务中依次执行
+// 其他事务已更新该流程实例时返回model.ConflictError(由最外层的Transaction重新执行)
+func (a *Flow) LockFlowInstance(ctx context.Context, flowInstanceID string) error {
+	return a.updateFlowInstance(ctx, flowInstanceID, map[string]interface{}{
+		"updated": time.Now().Unix(),
+	})
+}
+
+// 按版本号更新流程实例状态
+func (a *Flow) updateFlowInstanceStatus(ctx context.Context, flowInstanceID string, status int) error {
+	return a.updateFlowInstance(ctx, flowInstanceID, map[string]interface{}{
+		"status":  status,
+		"updated": time.Now().Unix(),
+	})
+}
+
+// 按版本号更新流程实例信息
+func (a *Flow) updateFlowInstance(ctx context.Context, flowInstanceID string, info map[string]interface{}) error {
+	flowInstance, err := a.FlowModel.GetFlowInstance(ctx, flowInstanceID)
 	if err != nil {
-		return nil, nil, err
-	} else if node == nil {
-		return nil, nil, fmt.Errorf("未知的流程节点")
+		return err
+	} else if flowInstance == nil {
+		return fmt.Errorf("无效的流程实例")
 	}
+	return a.FlowModel.UpdateFlowInstanceWithVersion(ctx, flowInstanceID, flowInstance.Status, flowInstance.Version, info)
+}
 
+// LaunchFlowInstance2 发起流程实例（基于流程ID），返回流程实例、开始事件节点实例
+func (a *Flow) LaunchFlowInstance2(ctx context.Context, flowID, userID string, status int, inputData []byte) (*schema.FlowInstance, *schema.NodeInstance, error) {
 	flowInstance := &schema.FlowInstance{
 		RecordID:   util.UUID(),
 		FlowID:     flowID,
@@ -158,6 +385,32 @@ func (a *Flow) LaunchFlowInstance2(flowID, userID string, status int, inputData
 		Status:     int64(status),
 		Created:    time.Now().Unix(),
 	}
+	return a.launchFlowInstance(ctx, flowInstance, inputData)
+}
+
+// LaunchSubFlowInstance 发起子流程实例(由调用活动或子流程节点实例调用)，返回子流程实例、开始事件节点实例
+func (a *Flow) LaunchSubFlowInstance(ctx context.Context, flowID string, parent *schema.FlowInstance, parentNodeInstanceID string, inputData []byte) (*schema.FlowInstance, *schema.NodeInstance, error) {
+	flowInstance := &schema.FlowInstance{
+		RecordID:             util.UUID(),
+		FlowID:               flowID,
+		Launcher:             parent.Launcher,
+		LaunchTime:           time.Now().Unix(),
+		Status:               1,
+		ParentID:             parent.RecordID,
+		ParentNodeInstanceID: parentNodeInstanceID,
+		Created:              time.Now().Unix(),
+	}
+	return a.launchFlowInstance(ctx, flowInstance, inputData)
+}
+
+// 创建流程实例及开始事件节点实例
+func (a *Flow) launchFlowInstance(ctx context.Context, flowInstance *schema.FlowInstance, inputData []byte) (*schema.FlowInstance, *schema.NodeInstance, error) {
+	node, err := a.getNoneStartEvent(ctx, flowInstance.FlowID)
+	if err != nil {
+		return nil, nil, err
+	} else if node == nil {
+		return nil, nil, fmt.Errorf("未知的流程节点")
+	}
 
 	nodeInstance := &schema.NodeInstance{
 		RecordID:       util.UUID(),
@@ -168,7 +421,7 @@ func (a *Flow) LaunchFlowInstance2(flowID, userID string, status int, inputData
 		Created:        flowInstance.Created,
 	}
 
-	err = a.FlowModel.CreateFlowInstance(flowInstance, nodeInstance)
+	err = a.FlowModel.CreateFlowInstance(ctx, flowInstance, nodeInstance)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -176,16 +429,34 @@ func (a *Flow) LaunchFlowInstance2(flowID, userID string, status int, inputData
 	return flowInstance, nodeInstance, nil
 }
 
+// 获取流程的空开始事件(消息及信号开始事件只由对应的消息或信号发起)
+func (a *Flow) getNoneStartEvent(ctx context.Context, flowID string) (*schema.Node, error) {
+	items, err := a.FlowModel.QueryNodeByTypeCodeAndFlowIDs(ctx, "startEvent", flowID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		prop, err := a.GetNodeProperty(ctx, item.RecordID)
+		if err != nil {
+			return nil, err
+		} else if prop["message_name"] == "" && prop["signal_name"] == "" {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
 // LaunchFlowInstance 发起流程实例
-func (a *Flow) LaunchFlowInstance(flowCode, nodeCode, launcher string, inputData []byte) (*schema.NodeInstance, error) {
-	flow, err := a.FlowModel.GetFlowByCode(flowCode)
+func (a *Flow) LaunchFlowInstance(ctx context.Context, flowCode, nodeCode, launcher string, inputData []byte) (*schema.NodeInstance, error) {
+	flow, err := a.FlowModel.GetFlowByCode(ctx, flowCode)
 	if err != nil {
 		return nil, err
 	} else if flow == nil {
 		return nil, nil
 	}
 
-	node, err := a.FlowModel.GetNodeByCode(flow.RecordID, nodeCode)
+	node, err := a.FlowModel.GetNodeByCode(ctx, flow.RecordID, nodeCode)
 	if err != nil {
 		return nil, err
 	} else if node == nil {
@@ -210,7 +481,7 @@ func (a *Flow) LaunchFlowInstance(flowCode, nodeCode, launcher string, inputData
 		Created:        flowInstance.Created,
 	}
 
-	err = a.FlowModel.CreateFlowInstance(flowInstance, nodeInstance)
+	err = a.FlowModel.CreateFlowInstance(ctx, flowInstance, nodeInstance)
 	if err != nil {
 		return nil, err
 	}
@@ -219,13 +490,13 @@ func (a *Flow) LaunchFlowInstance(flowCode, nodeCode, launcher string, inputData
 }
 
 // QueryNodeCandidates 查询节点候选人
-func (a *Flow) QueryNodeCandidates(nodeInstanceID string) ([]*schema.NodeCandidate, error) {
-	return a.FlowModel.QueryNodeCandidates(nodeInstanceID)
+func (a *Flow) QueryNodeCandidates(ctx context.Context, nodeInstanceID string) ([]*schema.NodeCandidate, error) {
+	return a.FlowModel.QueryNodeCandidates(ctx, nodeInstanceID)
 }
 
 // CheckNodeCandidate 检查节点候选人
-func (a *Flow) CheckNodeCandidate(nodeInstanceID, userID string) (bool, error) {
-	return a.FlowModel.CheckNodeCandidate(nodeInstanceID, userID)
+func (a *Flow) CheckNodeCandidate(ctx context.Context, nodeInstanceID, userID string) (bool, error) {
+	return a.FlowModel.CheckNodeCandidate(ctx, nodeInstanceID, userID)
 }
 
 // QueryTodo 查询用户的待办节点实例数据
@@ -295,7 +566,7 @@ func (a *Flow) UpdateFlowStatus(recordID string, status int) error {
 
 // QueryFlowVersion 查询流程版本数据
 func (a *Flow) QueryFlowVersion(recordID string) ([]*schema.FlowQueryResult, error) {
-	flow, err := a.FlowModel.GetFlow(recordID)
+	flow, err := a.FlowModel.GetFlow(context.Background(), recordID)
 	if err != nil {
 		return nil, err
 	} else if flow == nil {
@@ -321,13 +592,13 @@ func (a *Flow) GetFlowFormByNodeID(nodeID string) (*schema.Form, error) {
 }
 
 // QueryNodeByTypeCodeAndFlowIDs 根据节点类型和流程ID列表查询节点数据
-func (a *Flow) QueryNodeByTypeCodeAndFlowIDs(typeCode string, flowIDs ...string) ([]*schema.Node, error) {
-	return a.FlowModel.QueryNodeByTypeCodeAndFlowIDs(typeCode, flowIDs...)
+func (a *Flow) QueryNodeByTypeCodeAndFlowIDs(ctx context.Context, typeCode string, flowIDs ...string) ([]*schema.Node, error) {
+	return a.FlowModel.QueryNodeByTypeCodeAndFlowIDs(ctx, typeCode, flowIDs...)
 }
 
 // GetNodeByFlowAndTypeCode 根据流程ID和节点类型获取节点数据
-func (a *Flow) GetNodeByFlowAndTypeCode(flowID, typeCode string) (*schema.Node, error) {
-	return a.FlowModel.GetNodeByFlowAndTypeCode(flowID, typeCode)
+func (a *Flow) GetNodeByFlowAndTypeCode(ctx context.Context, flowID, typeCode string) (*schema.Node, error) {
+	return a.FlowModel.GetNodeByFlowAndTypeCode(ctx, flowID, typeCode)
 }
 
 // GetForm 获取流程表单
@@ -336,8 +607,8 @@ func (a *Flow) GetForm(formID string) (*schema.Form, error) {
 }
 
 // GetNodeProperty 获取节点属性
-func (a *Flow) GetNodeProperty(nodeID string) (map[string]string, error) {
-	items, err := a.FlowModel.QueryNodeProperty(nodeID)
+func (a *Flow) GetNodeProperty(ctx context.Context, nodeID string) (map[string]string, error) {
+	items, err := a.FlowModel.QueryNodeProperty(ctx, nodeID)
 	if err != nil {
 		return nil, err
 	}
@@ -350,14 +621,19 @@ func (a *Flow) GetNodeProperty(nodeID string) (map[string]string, error) {
 }
 
 // CreateNodeTiming 创建定时节点
-func (a *Flow) CreateNodeTiming(item *schema.NodeTiming) error {
+func (a *Flow) CreateNodeTiming(ctx context.Context, item *schema.NodeTiming) error {
 	item.ID = 0
-	return a.FlowModel.CreateNodeTiming(item)
+	return a.FlowModel.CreateNodeTiming(ctx, item)
 }
 
 // DeleteNodeTiming 删除定时节点
-func (a *Flow) DeleteNodeTiming(nodeInstanceID string) error {
-	return a.FlowModel.UpdateNodeTiming(nodeInstanceID, map[string]interface{}{"deleted": time.Now().Unix()})
+func (a *Flow) DeleteNodeTiming(ctx context.Context, nodeInstanceID string) error {
+	return a.FlowModel.UpdateNodeTiming(ctx, nodeInstanceID, map[string]interface{}{"deleted": time.Now().Unix()})
+}
+
+// DeleteNodeTimingByID 根据ID删除定时节点
+func (a *Flow) DeleteNodeTimingByID(ctx context.Context, id int64) error {
+	return a.FlowModel.UpdateNodeTimingByID(ctx, id, map[string]interface{}{"deleted": time.Now().Unix()})
 }
 
 // QueryExpiredNodeTiming 查询到期的定时节点
@@ -365,6 +641,154 @@ func (a *Flow) QueryExpiredNodeTiming() ([]*schema.NodeTiming, error) {
 	return a.FlowModel.QueryExpiredNodeTiming()
 }
 
+// ClaimNodeTiming 领取定时节点的租约，领取成功的引擎实例在租约期内独占处理该定时
+func (a *Flow) ClaimNodeTiming(item *schema.NodeTiming, owner string, lease time.Duration) (bool, error) {
+	leaseUntil := time.Now().Add(lease).Unix()
+	ok, err := a.FlowModel.ClaimNodeTiming(item.ID, owner, leaseUntil)
+	if err != nil || !ok {
+		return false, err
+	}
+	item.Owner = owner
+	item.LeaseUntil = leaseUntil
+	return true, nil
+}
+
+// DeleteClaimedNodeTiming 删除仍持有租约的定时节点，返回是否删除(租约已失效时不删除)
+func (a *Flow) DeleteClaimedNodeTiming(ctx context.Context, item *schema.NodeTiming) (bool, error) {
+	return a.FlowModel.UpdateClaimedNodeTiming(ctx, item.ID, item.Owner, map[string]interface{}{"deleted": time.Now().Unix()})
+}
+
+// FailNodeTiming 记录定时节点执行失败，未超过最大次数时在nextAt重试，否则转为死信(最大次数不大于0时不限制)
+// 租约已失效时不更新，由领取租约的引擎实例处理
+func (a *Flow) FailNodeTiming(item *schema.NodeTiming, cause error, maxAttempts int, nextAt int64) error {
+	lastError := []rune(cause.Error())
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+
+	info := map[string]interface{}{
+		"attempts":    item.Attempts + 1,
+		"last_error":  string(lastError),
+		"owner":       "",
+		"lease_until": 0,
+	}
+	if maxAttempts > 0 && item.Attempts+1 >= int64(maxAttempts) {
+		info["status"] = 1
+	} else {
+		info["expired_at"] = nextAt
+	}
+	_, err := a.FlowModel.UpdateClaimedNodeTiming(context.Background(), item.ID, item.Owner, info)
+	return err
+}
+
+// QueryDeadNodeTiming 查询死信状态的定时节点
+func (a *Flow) QueryDeadNodeTiming() ([]*schema.NodeTiming, error) {
+	return a.FlowModel.QueryDeadNodeTiming()
+}
+
+// RequeueNodeTiming 将死信状态的定时节点重新加入执行队列(清空失败次数及租约并立即执行)，返回是否重新入队(不是死信时不处理)
+func (a *Flow) RequeueNodeTiming(id int64) (bool, error) {
+	info := map[string]interface{}{
+		"status":      0,
+		"attempts":    0,
+		"last_error":  "",
+		"expired_at":  time.Now().Unix() - 1,
+		"owner":       "",
+		"lease_until": 0,
+	}
+	return a.FlowModel.UpdateDeadNodeTiming(context.Background(), id, info)
+}
+
+// CreateExternalTask 创建外部任务
+func (a *Flow) CreateExternalTask(ctx context.Context, flowInstanceID, nodeInstanceID, topic string) (*schema.ExternalTask, error) {
+	item := &schema.ExternalTask{
+		RecordID:       util.UUID(),
+		FlowInstanceID: flowInstanceID,
+		NodeInstanceID: nodeInstanceID,
+		Topic:          topic,
+		Created:        time.Now().Unix(),
+	}
+
+	err := a.FlowModel.CreateExternalTask(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// QueryUnlockedExternalTask 查询主题下待执行且未锁定的外部任务
+func (a *Flow) QueryUnlockedExternalTask(topic string, count int) ([]*schema.ExternalTask, error) {
+	return a.FlowModel.QueryUnlockedExternalTask(topic, count)
+}
+
+// LockExternalTask 为工作者锁定外部任务，锁定期内其他工作者无法领取该任务
+func (a *Flow) LockExternalTask(item *schema.ExternalTask, workerID string, lockDuration time.Duration) (bool, error) {
+	lockUntil := time.Now().Add(lockDuration).Unix()
+	ok, err := a.FlowModel.LockExternalTask(item.RecordID, workerID, lockUntil)
+	if err != nil || !ok {
+		return false, err
+	}
+	item.WorkerID = workerID
+	item.LockUntil = lockUntil
+	return true, nil
+}
+
+// GetLockedExternalTask 获取工作者锁定中的外部任务
+func (a *Flow) GetLockedExternalTask(ctx context.Context, recordID, workerID string) (*schema.ExternalTask, error) {
+	item, err := a.FlowModel.GetExternalTask(ctx, recordID)
+	if err != nil {
+		return nil, err
+	} else if item == nil || item.Status != 0 {
+		return nil, ErrExternalTaskNotFound
+	} else if item.WorkerID != workerID || item.LockUntil < time.Now().Unix() {
+		return nil, ErrExternalTaskNotLocked
+	}
+	return item, nil
+}
+
+// CompleteExternalTask 完成外部任务
+func (a *Flow) CompleteExternalTask(ctx context.Context, recordID string) error {
+	info := map[string]interface{}{
+		"status":  1,
+		"updated": time.Now().Unix(),
+	}
+	return a.FlowModel.UpdateExternalTask(ctx, recordID, info)
+}
+
+// FailExternalTask 记录外部任务执行失败，剩余重试次数大于0时在nextAt之后可重新领取，否则转为执行失败状态
+func (a *Flow) FailExternalTask(ctx context.Context, recordID, errorMessage string, retries int, nextAt int64) error {
+	msg := []rune(errorMessage)
+	if len(msg) > 1024 {
+		msg = msg[:1024]
+	}
+
+	info := map[string]interface{}{
+		"retries":       retries,
+		"error_message": string(msg),
+		"worker_id":     "",
+		"lock_until":    nextAt,
+		"updated":       time.Now().Unix(),
+	}
+	if retries <= 0 {
+		info["status"] = 2
+	}
+	return a.FlowModel.UpdateExternalTask(ctx, recordID, info)
+}
+
+// ExtendExternalTaskLock 延长外部任务的锁定时间
+func (a *Flow) ExtendExternalTaskLock(ctx context.Context, recordID string, lockUntil int64) error {
+	info := map[string]interface{}{
+		"lock_until": lockUntil,
+		"updated":    time.Now().Unix(),
+	}
+	return a.FlowModel.UpdateExternalTask(ctx, recordID, info)
+}
+
+// DeleteExternalTask 删除外部任务
+func (a *Flow) DeleteExternalTask(ctx context.Context, recordID string) error {
+	return a.FlowModel.UpdateExternalTask(ctx, recordID, map[string]interface{}{"deleted": time.Now().Unix()})
+}
+
 // QueryLaunchFlowInstanceResult 查询发起的流程实例数据
 func (a *Flow) QueryLaunchFlowInstanceResult(launcher, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error) {
 	return a.FlowModel.QueryLaunchFlowInstanceResult(launcher, typeCode, flowCode, lastID, count)
@@ -0,0 +1,190 @@
+package flow
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BusinessCalendar 工作日历(用于计算定时到期时间及任务截止时间)
+type BusinessCalendar interface {
+	// AddDays 计算从from开始经过days个工作日后的时间
+	AddDays(from time.Time, days int) time.Time
+	// AddDuration 计算从from开始经过工作时长d后的时间
+	AddDuration(from time.Time, d time.Duration) time.Time
+}
+
+// DefaultCalendar 默认的工作日历(全年无休，按自然时间计算)
+func DefaultCalendar() BusinessCalendar {
+	return defaultCalendar{}
+}
+
+type defaultCalendar struct{}
+
+func (defaultCalendar) AddDays(from time.Time, days int) time.Time {
+	return from.AddDate(0, 0, days)
+}
+
+func (defaultCalendar) AddDuration(from time.Time, d time.Duration) time.Time {
+	return from.Add(d)
+}
+
+// 工作日历向后查找的最大天数(避免日历配置异常时无限循环)
+const maxCalendarDays = 3660
+
+// WorkingPeriod 工作时段(如09:00-12:00)
+type WorkingPeriod struct {
+	Start string `json:"start"` // 开始时间(HH:MM)
+	End   string `json:"end"`   // 结束时间(HH:MM)
+
+	start, end time.Duration
+}
+
+// WorkingCalendar 按工作日、工作时段及节假日计算的工作日历
+type WorkingCalendar struct {
+	WorkingDays  []time.Weekday  `json:"working_days"`  // 工作日(0:周日 1:周一 ... 6:周六)
+	WorkingHours []WorkingPeriod `json:"working_hours"` // 工作时段
+	Holidays     []string        `json:"holidays"`      // 节假日(YYYY-MM-DD)
+	Workdays     []string        `json:"workdays"`      // 调休工作日(YYYY-MM-DD，非工作日中需要上班的日期)
+
+	location *time.Location
+	weekdays map[time.Weekday]bool
+	holidays map[string]bool
+	workdays map[string]bool
+}
+
+// LoadWorkingCalendar 从JSON文件加载工作日历(loc为空时使用本地时区)
+func LoadWorkingCalendar(name string, loc *time.Location) (*WorkingCalendar, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "读取工作日历文件发生错误")
+	}
+
+	var c WorkingCalendar
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "解析工作日历文件发生错误")
+	}
+
+	err = c.Init(loc)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Init 初始化工作日历(校验并解析工作时段)
+func (c *WorkingCalendar) Init(loc *time.Location) error {
+	if loc == nil {
+		loc = time.Local
+	}
+	c.location = loc
+
+	c.weekdays = make(map[time.Weekday]bool)
+	for _, d := range c.WorkingDays {
+		c.weekdays[d] = true
+	}
+
+	c.holidays = make(map[string]bool)
+	for _, d := range c.Holidays {
+		c.holidays[d] = true
+	}
+
+	c.workdays = make(map[string]bool)
+	for _, d := range c.Workdays {
+		c.workdays[d] = true
+	}
+
+	var last time.Duration
+	for i := range c.WorkingHours {
+		p := &c.WorkingHours[i]
+		start, err := parseClock(p.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(p.End)
+		if err != nil {
+			return err
+		}
+
+		if start >= end || start < last {
+			return errors.Errorf("无效的工作时段：%s-%s", p.Start, p.End)
+		}
+		p.start, p.end = start, end
+		last = end
+	}
+
+	if len(c.WorkingHours) == 0 || (len(c.weekdays) == 0 && len(c.workdays) == 0) {
+		return errors.New("工作日历未设定工作日或工作时段")
+	}
+	return nil
+}
+
+// 解析时刻(HH:MM)
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return 24 * time.Hour, nil
+		}
+		return 0, errors.Errorf("无效的时刻：%s", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// IsWorkingDay 检查是否为工作日
+func (c *WorkingCalendar) IsWorkingDay(t time.Time) bool {
+	day := t.In(c.location).Format("2006-01-02")
+	if c.workdays[day] {
+		return true
+	} else if c.holidays[day] {
+		return false
+	}
+	return c.weekdays[t.In(c.location).Weekday()]
+}
+
+// AddDays 计算从from开始经过days个工作日后的时间(保持时刻不变)
+func (c *WorkingCalendar) AddDays(from time.Time, days int) time.Time {
+	t := from.In(c.location)
+	for i, n := 0, 0; i < days && n < maxCalendarDays; i++ {
+		t = t.AddDate(0, 0, 1)
+		for n++; !c.IsWorkingDay(t) && n < maxCalendarDays; n++ {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return t
+}
+
+// AddDuration 计算从from开始经过工作时长d后的时间
+func (c *WorkingCalendar) AddDuration(from time.Time, d time.Duration) time.Time {
+	t := from.In(c.location)
+	if d <= 0 {
+		return t
+	}
+
+	for i := 0; i < maxCalendarDays; i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.location)
+		if c.IsWorkingDay(day) {
+			for _, p := range c.WorkingHours {
+				start, end := day.Add(p.start), day.Add(p.end)
+				if !t.Before(end) {
+					continue
+				} else if t.Before(start) {
+					t = start
+				}
+
+				avail := end.Sub(t)
+				if d <= avail {
+					return t.Add(d)
+				}
+				d -= avail
+				t = end
+			}
+		}
+
+		t = day.AddDate(0, 0, 1)
+	}
+	return t.Add(d)
+}
@@ -0,0 +1,76 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCalendar(t *testing.T) *WorkingCalendar {
+	name := filepath.Join(t.TempDir(), "calendar.json")
+	err := os.WriteFile(name, []byte(`{
+		"working_days": [1, 2, 3, 4, 5],
+		"working_hours": [{"start": "09:00", "end": "12:00"}, {"start": "13:00", "end": "18:00"}],
+		"holidays": ["2018-10-01"],
+		"workdays": ["2018-09-29"]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c, err := LoadWorkingCalendar(name, time.UTC)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return c
+}
+
+func TestWorkingCalendar(t *testing.T) {
+	c := newTestCalendar(t)
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2018, 9, day, hour, min, 0, 0, time.UTC)
+	}
+
+	for _, item := range []struct {
+		from     time.Time
+		d        time.Duration
+		expected time.Time
+	}{
+		{date(25, 10, 0), time.Hour, date(25, 11, 0)},
+		{date(25, 11, 0), 2 * time.Hour, date(25, 14, 0)},
+		{date(25, 7, 0), 30 * time.Minute, date(25, 9, 30)},
+		// 周五下午跨周末到周六调休日
+		{date(28, 17, 0), 2 * time.Hour, date(29, 10, 0)},
+		// 周六调休日下午跨周日及国庆假期
+		{date(29, 17, 0), 2 * time.Hour, time.Date(2018, 10, 2, 10, 0, 0, 0, time.UTC)},
+	} {
+		if v := c.AddDuration(item.from, item.d); !v.Equal(item.expected) {
+			t.Fatalf("无效的工作时长计算(%v+%v)：%v", item.from, item.d, v)
+		}
+	}
+
+	if v := c.AddDays(date(28, 10, 0), 2); !v.Equal(time.Date(2018, 10, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("无效的工作日计算：%v", v)
+	}
+
+	timer, err := ParseTimer(TimeDuration, "P1DT2H")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if v, _ := timer.Next(date(27, 17, 0), c); !v.Equal(date(29, 10, 0)) {
+		t.Fatalf("无效的定时到期时间：%v", v)
+	}
+}
+
+func TestWorkingCalendarInvalid(t *testing.T) {
+	for _, c := range []*WorkingCalendar{
+		{WorkingDays: []time.Weekday{time.Monday}},
+		{WorkingDays: []time.Weekday{time.Monday}, WorkingHours: []WorkingPeriod{{Start: "18:00", End: "09:00"}}},
+		{WorkingDays: []time.Weekday{time.Monday}, WorkingHours: []WorkingPeriod{{Start: "9点", End: "18:00"}}},
+	} {
+		if err := c.Init(nil); err == nil {
+			t.Fatalf("期望工作日历配置错误：%+v", c)
+		}
+	}
+}
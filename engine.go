@@ -5,12 +5,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"flow/bll"
+	"flow/model"
 	"flow/register"
 	"flow/schema"
 	"flow/service/db"
 	"flow/util"
 	"fmt"
-	"github.com/facebookgo/inject"
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"os"
@@ -28,8 +28,70 @@ type Logger interface {
 // AutoCallbackHandler 自动执行节点回调处理
 type AutoCallbackHandler func(action, flag, userID string, input []byte, result *HandleResult) error
 
+// MigrationMode 数据库迁移模式
+type MigrationMode int
+
+const (
+	// MigrationRun 启动时执行尚未执行的迁移(默认)
+	MigrationRun MigrationMode = iota
+	// MigrationVerify 启动时仅校验迁移是否已全部执行
+	MigrationVerify
+)
+
+type engineOptions struct {
+	migrationMode MigrationMode
+	timingOwner   string
+	timingLease   time.Duration
+	maxAttempts   int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+}
+
+// EngineOption 流程引擎配置
+type EngineOption func(*engineOptions)
+
+// EngineMigrationOption 数据库迁移模式
+func EngineMigrationOption(mode MigrationMode) EngineOption {
+	return func(opts *engineOptions) {
+		opts.migrationMode = mode
+	}
+}
+
+// EngineTimingOwnerOption 定时任务的租约持有者标识(默认为主机名、进程号及随机串)
+func EngineTimingOwnerOption(owner string) EngineOption {
+	return func(opts *engineOptions) {
+		opts.timingOwner = owner
+	}
+}
+
+// EngineTimingLeaseOption 定时任务的租约时长(默认5分钟，超过租约未完成的定时由其他引擎实例重新处理)
+func EngineTimingLeaseOption(lease time.Duration) EngineOption {
+	return func(opts *engineOptions) {
+		opts.timingLease = lease
+	}
+}
+
+// EngineTimingRetryOption 定时任务执行失败的重试配置
+// maxAttempts 最大执行次数(默认5次，超过后转为死信，不大于0时不限制)
+// backoff 首次重试的间隔(默认1分钟，之后每次翻倍)
+// maxBackoff 重试间隔的上限(默认1小时)
+func EngineTimingRetryOption(maxAttempts int, backoff, maxBackoff time.Duration) EngineOption {
+	return func(opts *engineOptions) {
+		opts.maxAttempts = maxAttempts
+		opts.backoff = backoff
+		opts.maxBackoff = maxBackoff
+	}
+}
+
+// 默认的定时任务租约持有者标识
+func defaultTimingOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), util.UUID()[:8])
+}
+
 // Engine 流程引擎
 type Engine struct {
+	opts         engineOptions
 	flowBll      *bll.Flow
 	parser       Parser
 	execer       Execer
@@ -39,35 +101,54 @@ type Engine struct {
 	timingWg     *sync.WaitGroup
 	getDBContext func(flag string) context.Context
 	autoCallback AutoCallbackHandler
+	calendar     BusinessCalendar
+
+	serviceLock     sync.RWMutex
+	serviceHandlers map[string]ServiceHandler
 }
 
 // Init 初始化流程引擎
-func (e *Engine) Init(parser Parser, execer Execer, sqlDB *sql.DB, trace bool) (*Engine, error) {
-
-	var (
-		g       inject.Graph
-		flowBll bll.Flow
-	)
+func (e *Engine) Init(parser Parser, execer Execer, sqlDB *sql.DB, trace bool, opts ...EngineOption) (*Engine, error) {
+	return e.InitWithDB(parser, execer, db.NewMySQLWithDB(sqlDB, trace), opts...)
+}
 
-	db := db.NewMySQLWithDB(sqlDB, trace)
-	err := g.Provide(&inject.Object{Value: db},
-		&inject.Object{Value: &flowBll})
-	if err != nil {
-		return e, err
+// InitWithDB 使用指定的数据库实例初始化流程引擎
+func (e *Engine) InitWithDB(parser Parser, execer Execer, db *db.DB, opts ...EngineOption) (*Engine, error) {
+	var o engineOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	err = g.Populate()
+	register.FlowDBMap(db)
+	var err error
+	switch o.migrationMode {
+	case MigrationVerify:
+		err = db.VerifyMigrations(register.FlowMigrations())
+	default:
+		err = db.Migrate(register.FlowMigrations())
+	}
 	if err != nil {
 		return e, err
 	}
 
-	register.FlowDBMap(db)
-	err = db.CreateTablesIfNotExists()
-	if err != nil {
-		return e, err
+	return e.InitWithStore(parser, execer, &model.Flow{DB: db}, opts...)
+}
+
+// InitWithStore 使用指定的流程存储初始化流程引擎
+func (e *Engine) InitWithStore(parser Parser, execer Execer, store model.Store, opts ...EngineOption) (*Engine, error) {
+	e.opts = engineOptions{
+		timingOwner: defaultTimingOwner(),
+		timingLease: 5 * time.Minute,
+		maxAttempts: 5,
+		backoff:     time.Minute,
+		maxBackoff:  time.Hour,
+	}
+	for _, opt := range opts {
+		opt(&e.opts)
 	}
 
-	e.flowBll = &flowBll
+	e.flowBll = &bll.Flow{FlowModel: store}
+	e.calendar = DefaultCalendar()
 	e.parser = parser
 	e.execer = execer
 	return e, nil
@@ -98,6 +179,11 @@ func (e *Engine) SetAutoCallback(callback AutoCallbackHandler) {
 	e.autoCallback = callback
 }
 
+// SetBusinessCalendar 设定工作日历(用于计算定时到期时间及任务截止时间)
+func (e *Engine) SetBusinessCalendar(calendar BusinessCalendar) {
+	e.calendar = calendar
+}
+
 // FlowBll 流程业务
 func (e *Engine) FlowBll() *bll.Flow {
 	return e.flowBll
@@ -141,24 +227,49 @@ func (e *Engine) handleTiming() error {
 	}
 
 	for _, item := range items {
-		err = e.handleExpiredNodeTiming(item)
+		// 领取租约，避免多个引擎实例重复处理同一定时
+		ok, err := e.flowBll.ClaimNodeTiming(item, e.opts.timingOwner, e.opts.timingLease)
 		if err != nil {
 			return err
+		} else if !ok {
+			continue
+		}
+
+		// 执行失败的定时按退避间隔重试，不影响其他定时的执行
+		err = e.handleExpiredNodeTiming(item)
+		if err != nil {
+			e.errorf("处理定时节点(%s)发生错误：%v", item.NodeInstanceID, err)
+			err = e.flowBll.FailNodeTiming(item, err, e.opts.maxAttempts, e.nextRetryTime(item.Attempts+1).Unix())
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+// 计算第n次失败后的重试时间(指数退避)
+func (e *Engine) nextRetryTime(attempts int64) time.Time {
+	backoff := e.opts.backoff
+	for i := int64(1); i < attempts && backoff < e.opts.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > e.opts.maxBackoff {
+		backoff = e.opts.maxBackoff
+	}
+	return time.Now().Add(backoff)
+}
+
 // 处理定时节点
 func (e *Engine) handleExpiredNodeTiming(item *schema.NodeTiming) error {
 	e.timingWg.Add(1)
 	defer e.timingWg.Done()
 
-	ni, err := e.flowBll.GetNodeInstance(item.NodeInstanceID)
+	ni, err := e.flowBll.GetNodeInstance(context.Background(), item.NodeInstanceID)
 	if err != nil {
 		return err
 	} else if ni == nil || ni.Status != 1 {
-		return nil
+		return e.deleteClaimedTiming(context.Background(), item)
 	}
 
 	ctx := context.Background()
@@ -166,6 +277,19 @@ func (e *Engine) handleExpiredNodeTiming(item *schema.NodeTiming) error {
 		ctx = fn(item.Flag)
 	}
 
+	// 边界定时事件沿边界事件的流出路径流转
+	if item.BoundaryNodeID != "" {
+		result, err := e.handleBoundaryTiming(ctx, item, ni)
+		if err != nil {
+			return err
+		}
+
+		if fn := e.autoCallback; fn != nil {
+			return fn("", item.Flag, item.Processor, []byte(ni.InputData), result)
+		}
+		return nil
+	}
+
 	if item.Input != "" {
 		var v map[string]interface{}
 		_ = json.Unmarshal([]byte(item.Input), &v)
@@ -184,12 +308,28 @@ func (e *Engine) handleExpiredNodeTiming(item *schema.NodeTiming) error {
 		ni.InputData = string(buf)
 	}
 
-	result, err := e.HandleFlow(ctx, item.NodeInstanceID, item.Processor, []byte(ni.InputData))
+	node, err := e.flowBll.GetNode(ctx, ni.NodeID)
 	if err != nil {
 		return err
+	} else if node == nil {
+		return ErrNotFound
 	}
 
-	err = e.flowBll.DeleteNodeTiming(item.NodeInstanceID)
+	// 定时的删除与节点处理在同一事务中，租约已失效时回滚
+	var result *HandleResult
+	err = e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		err := e.deleteClaimedTiming(ctx, item)
+		if err != nil {
+			return err
+		}
+
+		if node.TypeCode == IntermediateCatchEvent.String() {
+			result, err = e.continueFlow(ctx, item.NodeInstanceID, item.Processor, []byte(ni.InputData))
+		} else {
+			result, err = e.HandleFlow(ctx, item.NodeInstanceID, item.Processor, []byte(ni.InputData))
+		}
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -204,6 +344,150 @@ func (e *Engine) handleExpiredNodeTiming(item *schema.NodeTiming) error {
 	return nil
 }
 
+// 删除领取租约的定时节点(租约已失效时返回ErrLeaseExpired，回滚事务中的处理)
+func (e *Engine) deleteClaimedTiming(ctx context.Context, item *schema.NodeTiming) error {
+	ok, err := e.flowBll.DeleteClaimedNodeTiming(ctx, item)
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+// 处理边界定时事件(中断事件取消当前节点，非中断事件保留当前节点并继续循环定时)
+func (e *Engine) handleBoundaryTiming(ctx context.Context, item *schema.NodeTiming, nodeInstance *schema.NodeInstance) (*HandleResult, error) {
+	var result *HandleResult
+	err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		err := e.deleteClaimedTiming(ctx, item)
+		if err != nil {
+			return err
+		}
+
+		prop, err := e.flowBll.GetNodeProperty(ctx, item.BoundaryNodeID)
+		if err != nil {
+			return err
+		}
+
+		if prop["cancel_activity"] == "false" {
+			if item.Cycle != "" {
+				timer, err := ParseTimer(TimeCycle, item.Cycle)
+				if err != nil {
+					return err
+				}
+
+				err = e.addBoundaryTiming(ctx, nodeInstance.RecordID, item.BoundaryNodeID, timer)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			err = e.cancelNodeInstance(ctx, nodeInstance)
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err = e.triggerBoundaryEvent(ctx, nodeInstance, item.BoundaryNodeID, item.Processor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 取消节点实例(中断边界事件触发时)，移除节点的定时
+func (e *Engine) cancelNodeInstance(ctx context.Context, nodeInstance *schema.NodeInstance) error {
+	err := e.flowBll.CancelNodeInstance(ctx, nodeInstance.RecordID)
+	if err != nil {
+		return err
+	}
+
+	// 取消调用活动或子流程节点时同时停止其子流程实例
+	err = e.flowBll.StopSubFlowInstances(ctx, nodeInstance.FlowInstanceID, nodeInstance.RecordID)
+	if err != nil {
+		return err
+	}
+
+	return e.flowBll.DeleteNodeTiming(ctx, nodeInstance.RecordID)
+}
+
+// 从附加在节点实例上的边界事件开始流转
+func (e *Engine) triggerBoundaryEvent(ctx context.Context, nodeInstance *schema.NodeInstance, boundaryNodeID, userID string) (*HandleResult, error) {
+	instanceID, err := e.flowBll.CreateNodeInstance(ctx, nodeInstance.FlowInstanceID, boundaryNodeID, "", []byte(nodeInstance.InputData), nil)
+	if err != nil {
+		return nil, err
+	}
+	return e.nextFlowHandle(ctx, instanceID, userID, []byte(nodeInstance.InputData))
+}
+
+// 为节点实例附加的边界定时事件加入定时
+func (e *Engine) addBoundaryTimings(ctx context.Context, node *schema.Node, nodeInstance *schema.NodeInstance) error {
+	events, err := e.flowBll.QueryBoundaryEvents(ctx, node)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		prop, err := e.flowBll.GetNodeProperty(ctx, event.RecordID)
+		if err != nil {
+			return err
+		} else if prop["timing"] == "" {
+			continue
+		}
+
+		timer, err := ParseTimer(TimerType(prop["timing_type"]), prop["timing"])
+		if err != nil {
+			return err
+		}
+
+		err = e.addBoundaryTiming(ctx, nodeInstance.RecordID, event.RecordID, timer)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 加入边界定时事件的定时(循环定时记录剩余的循环定义)
+func (e *Engine) addBoundaryTiming(ctx context.Context, nodeInstanceID, boundaryNodeID string, timer *Timer) error {
+	expiredAt, ok := timer.Next(time.Now(), e.calendar)
+	if !ok {
+		return nil
+	}
+
+	nt := &schema.NodeTiming{
+		NodeInstanceID: nodeInstanceID,
+		BoundaryNodeID: boundaryNodeID,
+		ExpiredAt:      expiredAt.Unix(),
+		Created:        time.Now().Unix(),
+	}
+	if next := timer.Repeat(); next != nil {
+		nt.Cycle = next.Value
+	}
+	if v, ok := FromFlagContext(ctx); ok {
+		nt.Flag = v
+	}
+	return e.flowBll.CreateNodeTiming(ctx, nt)
+}
+
+// QueryDeadNodeTimings 查询执行失败次数超过上限的定时节点(死信)
+func (e *Engine) QueryDeadNodeTimings() ([]*schema.NodeTiming, error) {
+	return e.flowBll.QueryDeadNodeTiming()
+}
+
+// RequeueNodeTiming 将死信定时节点重新加入执行队列(定时不存在或不是死信时返回ErrNotFound)
+func (e *Engine) RequeueNodeTiming(id int64) error {
+	ok, err := e.flowBll.RequeueNodeTiming(id)
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // StopTiming 停止定时器
 func (e *Engine) StopTiming() {
 	if !e.timingStart {
@@ -373,14 +657,19 @@ func (e *Engine) parseOperating(flow *schema.Flow, nodeResults []*NodeResult) (*
 
 	for _, n := range nodeResults {
 		for _, r := range n.Routers {
-			nodeOperating.RouterGroup = append(nodeOperating.RouterGroup, &schema.NodeRouter{
-				RecordID:     util.UUID(),
-				SourceNodeID: getNodeRecordID(n.NodeID),
-				TargetNodeID: getNodeRecordID(r.TargetNodeID),
-				Expression:   r.Expression,
-				Explain:      r.Explain,
-				Created:      flow.Created,
-			})
+			router := &schema.NodeRouter{
+				RecordID:        util.UUID(),
+				SourceNodeID:    getNodeRecordID(n.NodeID),
+				TargetNodeID:    getNodeRecordID(r.TargetNodeID),
+				Expression:      r.Expression,
+				Explain:         r.Explain,
+				IsDefaultTarget: 2,
+				Created:         flow.Created,
+			}
+			if r.IsDefault {
+				router.IsDefaultTarget = 1
+			}
+			nodeOperating.RouterGroup = append(nodeOperating.RouterGroup, router)
 		}
 
 		// 增加节点属性
@@ -405,8 +694,22 @@ func (e *Engine) CreateFlow(data []byte) (string, error) {
 		return "", err
 	}
 
+	// 流程及内嵌子流程在同一事务中创建，任一创建失败时不保留已创建的子流程
+	var flowID string
+	err = e.flowBll.Transaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		flowID, err = e.createFlow(ctx, data, result)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return flowID, nil
+}
+
+func (e *Engine) createFlow(ctx context.Context, data []byte, result *ParseResult) (string, error) {
 	// 检查流程是否存在，如果存在则检查版本号是否一致，如果不一致则创建新流程
-	oldFlow, err := e.flowBll.GetFlowByCode(result.FlowID)
+	oldFlow, err := e.flowBll.GetFlowByCode(ctx, result.FlowID)
 	if err != nil {
 		return "", err
 	} else if oldFlow != nil {
@@ -425,6 +728,11 @@ func (e *Engine) CreateFlow(data []byte) (string, error) {
 		Created:  time.Now().Unix(),
 	}
 
+	err = e.createSubFlows(ctx, flow, result)
+	if err != nil {
+		return "", err
+	}
+
 	nodeOperating, formOperating := e.parseOperating(flow, result.Nodes)
 
 	// 解析节点表单数据
@@ -450,13 +758,47 @@ func (e *Engine) CreateFlow(data []byte) (string, error) {
 		}
 	}
 
-	err = e.flowBll.CreateFlow(flow, nodeOperating, formOperating)
+	err = e.flowBll.CreateFlow(ctx, flow, nodeOperating, formOperating)
 	if err != nil {
 		return "", err
 	}
 	return flow.RecordID, nil
 }
 
+// 创建内嵌子流程(标志为子流程)，子流程节点的sub_flow_id属性关联子流程内码
+func (e *Engine) createSubFlows(ctx context.Context, parent *schema.Flow, result *ParseResult) error {
+	for _, sub := range result.SubProcesses {
+		flow := &schema.Flow{
+			RecordID: util.UUID(),
+			Code:     fmt.Sprintf("%s.%s", parent.Code, sub.FlowID),
+			Name:     sub.FlowName,
+			Version:  parent.Version,
+			Flag:     2,
+			ParentID: parent.RecordID,
+			Status:   parent.Status,
+			Created:  parent.Created,
+		}
+
+		for _, node := range result.Nodes {
+			if node.NodeID == sub.FlowID {
+				node.Properties = append(node.Properties, &PropertyResult{Name: "sub_flow_id", Value: flow.RecordID})
+			}
+		}
+
+		err := e.createSubFlows(ctx, flow, sub)
+		if err != nil {
+			return err
+		}
+
+		nodeOperating, formOperating := e.parseOperating(flow, sub.Nodes)
+		err = e.flowBll.CreateFlow(ctx, flow, nodeOperating, formOperating)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // HandleResult 处理结果
 type HandleResult struct {
 	IsEnd        bool                 `json:"is_end"`        // 是否结束
@@ -476,7 +818,7 @@ type NextNode struct {
 	NodeInstance *schema.NodeInstance // 节点实例
 }
 
-func (e *Engine) nextFlowHandle(ctx context.Context, nodeInstanceID, userID string, inputData []byte) (*HandleResult, error) {
+func (e *Engine) nextFlowHandle(ctx context.Context, nodeInstanceID, userID string, inputData []byte, options ...NodeRouterOption) (*HandleResult, error) {
 	var result HandleResult
 
 	var onNextNode = OnNextNodeOption(func(node *schema.Node, nodeInstance *schema.NodeInstance, nodeCandidates []*schema.NodeCandidate) {
@@ -496,7 +838,7 @@ func (e *Engine) nextFlowHandle(ctx context.Context, nodeInstanceID, userID stri
 		result.IsEnd = true
 	})
 
-	nr, err := new(NodeRouter).Init(ctx, e, nodeInstanceID, inputData, onNextNode, onFlowEnd)
+	nr, err := new(NodeRouter).Init(ctx, e, nodeInstanceID, inputData, append(options, onNextNode, onFlowEnd)...)
 	if err != nil {
 		return nil, err
 	}
@@ -509,30 +851,59 @@ func (e *Engine) nextFlowHandle(ctx context.Context, nodeInstanceID, userID stri
 
 	if !result.IsEnd {
 		for _, item := range result.NextNodes {
-			prop, verr := e.flowBll.GetNodeProperty(item.Node.RecordID)
+			prop, verr := e.flowBll.GetNodeProperty(ctx, item.Node.RecordID)
 			if verr != nil {
 				return nil, verr
 			}
 
+			err = e.addBoundaryTimings(ctx, item.Node, item.NodeInstance)
+			if err != nil {
+				return nil, err
+			}
+
+			// 检查节点是否设定截止时间，如果设定则按工作日历计算
+			if v := prop["due_date"]; v != "" {
+				timer, verr := ParseTimer("", v)
+				if verr != nil {
+					return nil, verr
+				}
+
+				if dueAt, ok := timer.Next(time.Now(), e.calendar); ok {
+					err = e.flowBll.SetNodeInstanceDueAt(ctx, item.NodeInstance.RecordID, dueAt.Unix())
+					if err != nil {
+						return nil, err
+					}
+					item.NodeInstance.DueAt = dueAt.Unix()
+				}
+			}
+
 			// 检查节点是否设定定时器，如果设定则加入定时
 			if v := prop["timing"]; v != "" {
-				expired, verr := strconv.Atoi(v)
-				if verr == nil && expired > 0 {
+				timer, verr := ParseTimer(TimerType(prop["timing_type"]), v)
+				if verr != nil {
+					return nil, verr
+				}
+
+				if expiredAt, ok := timer.Next(time.Now(), e.calendar); ok {
 					nt := &schema.NodeTiming{
 						NodeInstanceID: item.NodeInstance.RecordID,
-						Processor:      item.CandidateIDs[0],
 						Input:          prop["timing_input"],
-						ExpiredAt:      time.Now().Add(time.Duration(expired) * time.Minute).Unix(),
+						ExpiredAt:      expiredAt.Unix(),
 						Created:        time.Now().Unix(),
 					}
 
+					// 中间捕获事件没有候选人，到期后由引擎直接流转
+					if len(item.CandidateIDs) > 0 {
+						nt.Processor = item.CandidateIDs[0]
+					}
+
 					if v, ok := FromFlagContext(ctx); ok {
 						nt.Flag = v
 					}
 
-					err = e.flowBll.CreateNodeTiming(nt)
+					err = e.flowBll.CreateNodeTiming(ctx, nt)
 					if err != nil {
-						e.errorf("%+v", err)
+						return nil, err
 					}
 				}
 			}
@@ -548,23 +919,48 @@ func (e *Engine) nextFlowHandle(ctx context.Context, nodeInstanceID, userID stri
 // userID 发起人
 // inputData 输入数据
 func (e *Engine) StartFlow(ctx context.Context, flowCode, nodeCode, userID string, inputData []byte) (*HandleResult, error) {
-	nodeInstance, err := e.flowBll.LaunchFlowInstance(flowCode, nodeCode, userID, inputData)
+	var result *HandleResult
+	err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		nodeInstance, err := e.flowBll.LaunchFlowInstance(ctx, flowCode, nodeCode, userID, inputData)
+		if err != nil {
+			return err
+		} else if nodeInstance == nil {
+			return errors.New("未找到流程信息")
+		}
+
+		// 消息及信号开始事件只由对应的消息或信号发起
+		prop, err := e.flowBll.GetNodeProperty(ctx, nodeInstance.NodeID)
+		if err != nil {
+			return err
+		} else if prop["message_name"] != "" || prop["signal_name"] != "" {
+			return errors.Errorf("开始事件(%s)只能由对应的消息或信号发起", nodeCode)
+		}
+
+		result, err = e.nextFlowHandle(ctx, nodeInstance.RecordID, userID, inputData)
+		return err
+	})
 	if err != nil {
 		return nil, err
-	} else if nodeInstance == nil {
-		return nil, errors.New("未找到流程信息")
 	}
-
-	return e.nextFlowHandle(ctx, nodeInstance.RecordID, userID, inputData)
+	return result, nil
 }
 
 // LaunchFlow 发起流程（基于流程ID）
 func (e *Engine) LaunchFlow(ctx context.Context, flowID, userID string, inputData []byte) (*HandleResult, error) {
-	_, ni, err := e.flowBll.LaunchFlowInstance2(flowID, userID, 1, inputData)
+	var result *HandleResult
+	err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		_, ni, err := e.flowBll.LaunchFlowInstance2(ctx, flowID, userID, 1, inputData)
+		if err != nil {
+			return err
+		}
+
+		result, err = e.nextFlowHandle(ctx, ni.RecordID, userID, inputData)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return e.nextFlowHandle(ctx, ni.RecordID, userID, inputData)
+	return result, nil
 }
 
 // HandleFlow 处理流程节点
@@ -572,52 +968,84 @@ func (e *Engine) LaunchFlow(ctx context.Context, flowID, userID string, inputDat
 // userID 处理人
 // inputData 输入数据
 func (e *Engine) HandleFlow(ctx context.Context, nodeInstanceID, userID string, inputData []byte) (*HandleResult, error) {
-	// 检查是否是节点候选人
-	exists, err := e.flowBll.CheckNodeCandidate(nodeInstanceID, userID)
+	var result *HandleResult
+	err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		// 检查是否是节点候选人
+		exists, err := e.flowBll.CheckNodeCandidate(ctx, nodeInstanceID, userID)
+		if err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("无效的节点处理人")
+		}
+
+		result, err = e.continueFlow(ctx, nodeInstanceID, userID, inputData)
+		return err
+	})
 	if err != nil {
 		return nil, err
-	} else if !exists {
-		return nil, fmt.Errorf("无效的节点处理人")
 	}
+	return result, nil
+}
+
+// 完成待处理的节点并继续流转(不检查节点候选人)
+func (e *Engine) continueFlow(ctx context.Context, nodeInstanceID, userID string, inputData []byte) (*HandleResult, error) {
+	var result *HandleResult
+	err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		nodeInstance, err := e.flowBll.GetNodeInstance(ctx, nodeInstanceID)
+		if err != nil {
+			return err
+		} else if nodeInstance == nil || nodeInstance.Status != 1 {
+			return fmt.Errorf("无效的处理节点")
+		}
 
-	nodeInstance, err := e.flowBll.GetNodeInstance(nodeInstanceID)
+		result, err = e.nextFlowHandle(ctx, nodeInstanceID, userID, inputData)
+		if err != nil {
+			return err
+		}
+
+		// 节点已处理，移除节点的定时(包括边界定时事件)
+		return e.flowBll.DeleteNodeTiming(ctx, nodeInstanceID)
+	})
 	if err != nil {
 		return nil, err
-	} else if nodeInstance == nil || nodeInstance.Status != 1 {
-		return nil, fmt.Errorf("无效的处理节点")
 	}
-
-	return e.nextFlowHandle(ctx, nodeInstanceID, userID, inputData)
+	return result, nil
 }
 
 // StopFlow 停止流程
 func (e *Engine) StopFlow(nodeInstanceID string, allowStop func(*schema.FlowInstance) bool) error {
-	flowInstance, err := e.flowBll.GetFlowInstanceByNode(nodeInstanceID)
-	if err != nil {
-		return err
-	} else if flowInstance == nil {
-		return errors.New("流程不存在")
-	}
+	return e.flowBll.Transaction(context.Background(), func(ctx context.Context) error {
+		flowInstance, err := e.flowBll.GetFlowInstanceByNode(ctx, nodeInstanceID)
+		if err != nil {
+			return err
+		} else if flowInstance == nil {
+			return errors.New("流程不存在")
+		}
 
-	if allowStop != nil && !allowStop(flowInstance) {
-		return errors.New("不允许停止流程")
-	}
+		if allowStop != nil && !allowStop(flowInstance) {
+			return errors.New("不允许停止流程")
+		}
 
-	return e.flowBll.StopFlowInstance(flowInstance.RecordID)
+		return e.flowBll.StopFlowInstance(ctx, flowInstance.RecordID)
+	})
 }
 
 // StopFlowInstance 停止流程实例
 func (e *Engine) StopFlowInstance(flowInstanceID string, allowStop func(*schema.FlowInstance) bool) error {
-	flowInstance, err := e.flowBll.GetFlowInstance(flowInstanceID)
-	if err != nil {
-		return err
-	}
+	return e.flowBll.Transaction(context.Background(), func(ctx context.Context) error {
+		flowInstance, err := e.flowBll.GetFlowInstance(ctx, flowInstanceID)
+		if err != nil {
+			return err
+		} else if flowInstance == nil {
+			return errors.New("流程不存在")
+		}
 
-	if allowStop != nil && !allowStop(flowInstance) {
-		return errors.New("不允许停止流程")
-	}
+		if allowStop != nil && !allowStop(flowInstance) {
+			return errors.New("不允许停止流程")
+		}
 
-	return e.flowBll.StopFlowInstance(flowInstanceID)
+		return e.flowBll.StopFlowInstance(ctx, flowInstanceID)
+	})
 }
 
 // QueryTodoFlows 查询流程待办数据
@@ -640,7 +1068,7 @@ func (e *Engine) QueryDoneFlowIDs(flowCode, userID string) ([]string, error) {
 
 // QueryNodeCandidates 查询节点实例的候选人ID列表
 func (e *Engine) QueryNodeCandidates(nodeInstanceID string) ([]string, error) {
-	candidates, err := e.flowBll.QueryNodeCandidates(nodeInstanceID)
+	candidates, err := e.flowBll.QueryNodeCandidates(context.Background(), nodeInstanceID)
 	if err != nil {
 		return nil, err
 	}
@@ -656,5 +1084,5 @@ func (e *Engine) QueryNodeCandidates(nodeInstanceID string) ([]string, error) {
 
 // GetNodeInstance 获取节点实例
 func (e *Engine) GetNodeInstance(nodeInstanceID string) (*schema.NodeInstance, error) {
-	return e.flowBll.GetNodeInstance(nodeInstanceID)
+	return e.flowBll.GetNodeInstance(context.Background(), nodeInstanceID)
 }
@@ -0,0 +1,1064 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flow/model"
+	"flow/schema"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandleTimingRetryAndDeadLetter(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory(),
+		EngineTimingRetryOption(2, time.Minute, time.Hour))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	e.timingWg = new(sync.WaitGroup)
+
+	err = e.LoadFile("test_data/leave.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	inputData, _ := json.Marshal(map[string]interface{}{"day": 1, "bzr": "T002"})
+	result, err := e.StartFlow(context.Background(), "process_leave_test", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// 定时的处理人不是节点候选人，每次执行都会失败
+	item := &schema.NodeTiming{
+		NodeInstanceID: result.NextNodes[0].NodeInstance.RecordID,
+		Processor:      "T003",
+		ExpiredAt:      time.Now().Unix() - 1,
+	}
+	err = e.flowBll.CreateNodeTiming(context.Background(), item)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.handleTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	items, err := e.flowBll.QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 0 {
+		t.Fatalf("失败的定时应延迟重试：%+v", items)
+	}
+
+	// 模拟到达重试时间
+	err = e.flowBll.FlowModel.UpdateNodeTimingByID(context.Background(), item.ID, map[string]interface{}{"expired_at": time.Now().Unix() - 1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.handleTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	dead, err := e.QueryDeadNodeTimings()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError == "" {
+		t.Fatalf("无效的死信定时：%+v", dead)
+	}
+
+	err = e.RequeueNodeTiming(dead[0].ID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	items, err = e.flowBll.QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 1 || items[0].Attempts != 0 {
+		t.Fatalf("无效的重新入队定时：%+v", items)
+	}
+
+	// 等待执行的定时及不存在的定时不能重新入队
+	for _, id := range []int64{dead[0].ID, dead[0].ID + 100} {
+		err = e.RequeueNodeTiming(id)
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("非死信定时不应重新入队：%v", err)
+		}
+	}
+}
+
+func TestNextRetryTime(t *testing.T) {
+	e := &Engine{opts: engineOptions{backoff: time.Minute, maxBackoff: 5 * time.Minute}}
+
+	for attempts, expected := range map[int64]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		4: 5 * time.Minute,
+		9: 5 * time.Minute,
+	} {
+		d := time.Until(e.nextRetryTime(attempts))
+		if d < expected-time.Second || d > expected {
+			t.Fatalf("无效的重试间隔(%d)：%v", attempts, d)
+		}
+	}
+}
+
+func TestBoundaryTimerEvent(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	e.timingWg = new(sync.WaitGroup)
+
+	err = e.LoadFile("test_data/boundary_timer.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	inputData, _ := json.Marshal(map[string]interface{}{"approver": "T002", "manager": "T003"})
+	result, err := e.StartFlow(ctx, "process_boundary_timer", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_approve" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+	approveID := result.NextNodes[0].NodeInstance.RecordID
+
+	// 模拟审批节点的边界定时全部到期，仅保留非中断的催办定时
+	err = e.flowBll.FlowModel.UpdateNodeTiming(ctx, approveID, map[string]interface{}{"expired_at": time.Now().Unix() - 1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	items, err := e.flowBll.QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 2 {
+		t.Fatalf("无效的边界定时：%+v", items)
+	}
+
+	var timeout *schema.NodeTiming
+	for _, item := range items {
+		if item.BoundaryNodeID == "" {
+			t.Fatalf("无效的边界定时：%+v", item)
+		} else if item.Cycle == "" {
+			timeout = item
+		} else if item.Cycle != "R1/PT1H" {
+			t.Fatalf("无效的循环定时：%+v", item)
+		}
+	}
+	err = e.flowBll.FlowModel.UpdateNodeTimingByID(ctx, timeout.ID, map[string]interface{}{"expired_at": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.handleTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ni, err := e.flowBll.GetNodeInstance(ctx, approveID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if ni.Status != 1 {
+		t.Fatalf("非中断边界事件不应取消节点：%+v", ni)
+	}
+
+	todos, err := e.QueryTodoFlows("process_boundary_timer", "T002")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 2 {
+		t.Fatalf("无效的待办数量：%d", len(todos))
+	}
+
+	// 中断边界事件取消审批节点并转由上级审批
+	err = e.flowBll.FlowModel.UpdateNodeTiming(ctx, approveID, map[string]interface{}{"expired_at": time.Now().Unix() - 1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.handleTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ni, err = e.flowBll.GetNodeInstance(ctx, approveID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if ni.Status != 3 {
+		t.Fatalf("中断边界事件应取消节点：%+v", ni)
+	}
+
+	todos, err = e.QueryTodoFlows("process_boundary_timer", "T003")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 1 {
+		t.Fatalf("无效的待办数量：%d", len(todos))
+	}
+
+	items, err = e.flowBll.QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 0 {
+		t.Fatalf("节点取消后应移除边界定时：%+v", items)
+	}
+}
+
+func TestIntermediateTimerCatchEvent(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	e.timingWg = new(sync.WaitGroup)
+
+	err = e.LoadFile("test_data/catch_timer.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	inputData, _ := json.Marshal(map[string]interface{}{"approver": "T002"})
+	result, err := e.StartFlow(ctx, "process_catch_timer", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_wait" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+	waitID := result.NextNodes[0].NodeInstance.RecordID
+
+	todos, err := e.QueryTodoFlows("process_catch_timer", "T002")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 0 {
+		t.Fatalf("定时未到期时不应流转：%d", len(todos))
+	}
+
+	// 模拟定时到期
+	err = e.flowBll.FlowModel.UpdateNodeTiming(ctx, waitID, map[string]interface{}{"expired_at": time.Now().Unix() - 1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.handleTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ni, err := e.flowBll.GetNodeInstance(ctx, waitID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if ni.Status != 2 {
+		t.Fatalf("定时到期后应完成等待节点：%+v", ni)
+	}
+
+	todos, err = e.QueryTodoFlows("process_catch_timer", "T002")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 1 {
+		t.Fatalf("无效的待办数量：%d", len(todos))
+	}
+}
+
+func TestServiceTask(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/service_task.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	inputData, _ := json.Marshal(map[string]interface{}{"day": 3, "approver": "T002"})
+	_, err = e.StartFlow(ctx, "process_service_task", "node_start", "T001", inputData)
+	if err == nil {
+		t.Fatal("未注册处理函数时应返回错误")
+	}
+
+	e.RegisterServiceHandler("scoreApply", func(ctx context.Context, task *ServiceTaskInfo) (map[string]interface{}, error) {
+		if task.Node.Code != "node_score" {
+			t.Fatalf("无效的服务任务：%+v", task.Node)
+		}
+		day, _ := task.Input["day"].(float64)
+		return map[string]interface{}{"score": 100 - day*20}, nil
+	})
+
+	result, err := e.StartFlow(ctx, "process_service_task", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_approve" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(result.NextNodes[0].NodeInstance.InputData), &input)
+	if input["score"] != float64(40) || input["approver"] != "T002" {
+		t.Fatalf("处理结果未合并到流程数据：%+v", input)
+	}
+
+	inputData, _ = json.Marshal(map[string]interface{}{"day": 1})
+	result, err = e.StartFlow(ctx, "process_service_task", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !result.IsEnd {
+		t.Fatalf("流程应直接结束：%s", result.String())
+	}
+}
+
+func TestExternalTask(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/external_task.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	inputData, _ := json.Marshal(map[string]interface{}{"amount": 100})
+	result, err := e.StartFlow(ctx, "process_external_task", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_check" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	tasks, err := e.FetchAndLock("credit-check", "worker1", 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(tasks) != 1 || tasks[0].Input["amount"] != float64(100) {
+		t.Fatalf("无效的外部任务：%+v", tasks)
+	}
+	task := tasks[0]
+
+	// 锁定期内其他工作者无法领取
+	tasks, err = e.FetchAndLock("credit-check", "worker2", 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(tasks) != 0 {
+		t.Fatalf("已锁定的任务不应被领取：%+v", tasks)
+	}
+
+	err = e.ExtendExternalTaskLock(task.RecordID, "worker2", time.Minute)
+	if err == nil {
+		t.Fatal("非锁定的工作者不能延长锁定")
+	}
+
+	// 执行失败后等待重试时间到达再重新领取
+	err = e.HandleExternalTaskFailure(task.RecordID, "worker1", "服务不可用", 2, 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	time.Sleep(time.Second)
+	tasks, err = e.FetchAndLock("credit-check", "worker2", 10, time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(tasks) != 1 || tasks[0].Retries != 2 || tasks[0].ErrorMessage != "服务不可用" {
+		t.Fatalf("失败的任务应可重新领取：%+v", tasks)
+	}
+
+	_, err = e.CompleteExternalTask(ctx, task.RecordID, "worker1", nil)
+	if err == nil {
+		t.Fatal("非锁定的工作者不能完成任务")
+	}
+
+	result, err = e.CompleteExternalTask(ctx, task.RecordID, "worker2", map[string]interface{}{"approver": "T002"})
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_approve" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	todos, err := e.QueryTodoFlows("process_external_task", "T002")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 1 {
+		t.Fatalf("无效的待办数量：%d", len(todos))
+	}
+}
+
+func TestScriptTask(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/script_task.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	inputData, _ := json.Marshal(map[string]interface{}{
+		"approver": "T002",
+		"items":    []map[string]interface{}{{"day": 2}, {"day": 3}},
+	})
+	result, err := e.StartFlow(ctx, "process_script_task", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_approve" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(result.NextNodes[0].NodeInstance.InputData), &input)
+	if input["total_days"] != float64(5) || input["launcher"] != "T001" {
+		t.Fatalf("脚本结果未合并到流程数据：%+v", input)
+	}
+
+	inputData, _ = json.Marshal(map[string]interface{}{
+		"items": []map[string]interface{}{{"day": 1}},
+	})
+	result, err = e.StartFlow(ctx, "process_script_task", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !result.IsEnd {
+		t.Fatalf("流程应直接结束：%s", result.String())
+	}
+}
+
+func TestCallActivity(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, name := range []string{"test_data/sub_approve.bpmn", "test_data/call_activity.bpmn"} {
+		err = e.LoadFile(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	ctx := context.Background()
+	inputData, _ := json.Marshal(map[string]interface{}{"day": 3})
+	result, err := e.StartFlow(ctx, "process_call_activity", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if result.IsEnd || len(result.NextNodes) != 2 {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	subNode := result.NextNodes[0]
+	if subNode.Node.Code != "node_sub_approve" || len(subNode.CandidateIDs) != 1 || subNode.CandidateIDs[0] != "T002" {
+		t.Fatalf("无效的子流程节点：%s", result.String())
+	} else if result.NextNodes[1].Node.Code != "node_call" {
+		t.Fatalf("调用活动应等待子流程结束：%s", result.String())
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(subNode.NodeInstance.InputData), &input)
+	if input["days"] != float64(3) || input["day"] != nil {
+		t.Fatalf("子流程的输入变量映射错误：%+v", input)
+	}
+
+	subFlowInstance, err := e.flowBll.GetFlowInstance(ctx, subNode.NodeInstance.FlowInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if subFlowInstance.ParentNodeInstanceID != result.NextNodes[1].NodeInstance.RecordID ||
+		subFlowInstance.Launcher != "T001" {
+		t.Fatalf("子流程实例未关联父级流程实例：%+v", subFlowInstance)
+	}
+
+	inputData, _ = json.Marshal(map[string]interface{}{"result": "pass"})
+	result, err = e.HandleFlow(ctx, subNode.NodeInstance.RecordID, "T002", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if result.IsEnd || len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_confirm" {
+		t.Fatalf("子流程结束后应继续父级流程：%s", result.String())
+	}
+
+	input = nil
+	_ = json.Unmarshal([]byte(result.NextNodes[0].NodeInstance.InputData), &input)
+	if input["day"] != float64(3) || input["approve_result"] != "pass" {
+		t.Fatalf("子流程的输出变量映射错误：%+v", input)
+	}
+
+	subFlowInstance, err = e.flowBll.GetFlowInstance(ctx, subFlowInstance.RecordID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if subFlowInstance.Status != 9 {
+		t.Fatalf("子流程实例应已结束：%+v", subFlowInstance)
+	}
+
+	// 停止父级流程实例时同时停止子流程实例
+	result, err = e.StartFlow(ctx, "process_call_activity", "node_start", "T001", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	subNodeInstanceID := result.NextNodes[0].NodeInstance.RecordID
+	err = e.flowBll.CreateNodeTiming(ctx, &schema.NodeTiming{NodeInstanceID: subNodeInstanceID, ExpiredAt: time.Now().Unix() - 1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.StopFlowInstance(result.FlowInstance.RecordID, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	subFlowInstance, err = e.flowBll.GetFlowInstance(ctx, result.NextNodes[0].NodeInstance.FlowInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if subFlowInstance.Status != 9 {
+		t.Fatalf("子流程实例应已停止：%+v", subFlowInstance)
+	}
+
+	// 子流程实例待处理的节点实例被取消，其定时被移除
+	subNodeInstance, err := e.flowBll.GetNodeInstance(ctx, subNodeInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if subNodeInstance.Status != 3 {
+		t.Fatalf("子流程实例的节点实例应已取消：%+v", subNodeInstance)
+	}
+
+	timings, err := e.flowBll.QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(timings) != 0 {
+		t.Fatalf("子流程实例的定时应已移除：%+v", timings)
+	}
+}
+
+func TestEmbeddedSubProcess(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/sub_process.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	flow, err := e.flowBll.GetFlowByCode(ctx, "process_sub_process.node_sub")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if flow != nil {
+		t.Fatalf("子流程不应作为主流程查询：%+v", flow)
+	}
+
+	inputData, _ := json.Marshal(map[string]interface{}{"day": 3})
+	result, err := e.StartFlow(ctx, "process_sub_process", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if result.IsEnd || len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_confirm" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	} else if result.FlowInstance.ParentID != "" {
+		t.Fatalf("无效的流程实例：%s", result.String())
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(result.NextNodes[0].NodeInstance.InputData), &input)
+	if input["day"] != float64(3) || input["total"] != float64(6) {
+		t.Fatalf("子流程的变量未合并到流程数据：%+v", input)
+	}
+}
+
+func TestInclusiveGateway(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/inclusive_gateway.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	start := func(amount int, contract bool) *HandleResult {
+		inputData, _ := json.Marshal(map[string]interface{}{"amount": amount, "contract": contract})
+		result, err := e.StartFlow(ctx, "process_inclusive_gateway", "node_start", "T001", inputData)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return result
+	}
+	handle := func(item *NextNode, userID string, input map[string]interface{}) *HandleResult {
+		inputData, _ := json.Marshal(input)
+		result, err := e.HandleFlow(ctx, item.NodeInstance.RecordID, userID, inputData)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return result
+	}
+
+	// 两个分支都激活时，汇聚等待两个分支都完成
+	result := start(2000, true)
+	if len(result.NextNodes) != 2 || result.NextNodes[0].Node.Code != "node_finance" || result.NextNodes[1].Node.Code != "node_legal" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+	legal := result.NextNodes[1]
+
+	result = handle(result.NextNodes[0], "T002", map[string]interface{}{"finance": "pass"})
+	if result.IsEnd || len(result.NextNodes) != 0 {
+		t.Fatalf("汇聚应等待法务审批：%s", result.String())
+	}
+
+	result = handle(legal, "T003", map[string]interface{}{"legal": "pass"})
+	if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_confirm" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(result.NextNodes[0].NodeInstance.InputData), &input)
+	if input["finance"] != "pass" || input["legal"] != "pass" {
+		t.Fatalf("汇聚未合并分支数据：%+v", input)
+	}
+
+	// 仅激活一个分支时，汇聚不等待未激活的分支
+	result = start(2000, false)
+	if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_finance" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	result = handle(result.NextNodes[0], "T002", map[string]interface{}{"finance": "pass"})
+	if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_confirm" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	// 等待中的分支流向其他结束事件后，汇聚继续流转
+	result = start(2000, true)
+	finance := result.NextNodes[0]
+
+	result = handle(result.NextNodes[1], "T003", map[string]interface{}{"legal": "pass"})
+	if len(result.NextNodes) != 0 {
+		t.Fatalf("汇聚应等待财务审批：%s", result.String())
+	}
+
+	result = handle(finance, "T002", map[string]interface{}{"finance": "reject"})
+	if result.IsEnd || len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_confirm" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+}
+
+func TestParallelGatewayJoin(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/parallel_join.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	handle := func(item *NextNode, userID string) *HandleResult {
+		inputData, _ := json.Marshal(map[string]interface{}{item.Node.Code: userID})
+		result, err := e.HandleFlow(ctx, item.NodeInstance.RecordID, userID, inputData)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return result
+	}
+	codes := func(result *HandleResult) string {
+		var s []string
+		for _, item := range result.NextNodes {
+			s = append(s, item.Node.Code)
+		}
+		return strings.Join(s, ",")
+	}
+
+	// 脚本任务分支不停留，汇聚1等待人工任务分支
+	result, err := e.StartFlow(ctx, "process_parallel_join", "node_start", "T001", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if codes(result) != "node_notice,node_a" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+	notice := result.NextNodes[0]
+
+	// 无关分支的待办(知会)不阻塞汇聚
+	result = handle(result.NextNodes[1], "T002")
+	if codes(result) != "node_c,node_d" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(result.NextNodes[0].NodeInstance.InputData), &input)
+	if input["b_done"] != true || input["node_a"] != "T002" {
+		t.Fatalf("汇聚未合并分支数据：%+v", input)
+	}
+	nodeD := result.NextNodes[1]
+
+	result = handle(result.NextNodes[0], "T003")
+	if result.IsEnd || len(result.NextNodes) != 0 {
+		t.Fatalf("汇聚2应等待会签D：%s", result.String())
+	}
+
+	result = handle(nodeD, "T004")
+	if codes(result) != "node_confirm" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+	confirm := result.NextNodes[0]
+
+	result = handle(notice, "T005")
+	if result.IsEnd {
+		t.Fatalf("流程还有待办，不应结束：%s", result.String())
+	}
+
+	result = handle(confirm, "T001")
+	if !result.IsEnd {
+		t.Fatalf("流程应结束：%s", result.String())
+	}
+}
+
+// 模拟其他服务实例先提交了同一流程实例的处理：锁定流程实例时返回冲突
+type conflictStore struct {
+	model.Store
+	conflicts int
+}
+
+func (s *conflictStore) UpdateFlowInstanceWithVersion(ctx context.Context, recordID string, status, version int64, info map[string]interface{}) error {
+	if _, ok := info["status"]; !ok && s.conflicts > 0 {
+		s.conflicts--
+		return &ConflictError{Table: schema.FlowInstanceTableName, RecordID: recordID, Version: version}
+	}
+	return s.Store.UpdateFlowInstanceWithVersion(ctx, recordID, status, version, info)
+}
+
+func TestParallelGatewayJoinConflict(t *testing.T) {
+	store := &conflictStore{Store: model.NewMemory()}
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), store)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/parallel_join.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	result, err := e.StartFlow(ctx, "process_parallel_join", "node_start", "T001", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	nodeA := result.NextNodes[1]
+
+	// 冲突超过重试次数时返回冲突错误，处理全部回滚
+	store.conflicts = 100
+	_, err = e.HandleFlow(ctx, nodeA.NodeInstance.RecordID, "T002", nil)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("应返回并发冲突错误：%v", err)
+	}
+
+	// 汇聚时流程实例已被其他事务更新，重新执行整个事务
+	store.conflicts = 1
+	result, err = e.HandleFlow(ctx, nodeA.NodeInstance.RecordID, "T002", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if store.conflicts != 0 {
+		t.Fatalf("汇聚应锁定流程实例")
+	} else if len(result.NextNodes) != 2 {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	items, err := e.flowBll.QueryPendingNodeInstances(ctx, result.FlowInstance.RecordID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 3 {
+		t.Fatalf("重新执行前的处理应回滚，待处理节点数量：%d", len(items))
+	}
+}
+
+func TestMultiInstanceUserTask(t *testing.T) {
+	store := &conflictStore{Store: model.NewMemory()}
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), store)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/multi_instance.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	input := map[string]interface{}{
+		"signers":   []string{"T002", "T003", "T004", "T005"},
+		"reviewers": []string{"T006", "T007"},
+	}
+	inputData, _ := json.Marshal(input)
+	candidates := func(item *NextNode) string {
+		return strings.Join(item.CandidateIDs, ",")
+	}
+	handle := func(item *NextNode, userID string) *HandleResult {
+		result, err := e.HandleFlow(ctx, item.NodeInstance.RecordID, userID, inputData)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return result
+	}
+
+	// 并行会签按集合同时创建全部实例，候选人由元素变量计算
+	result, err := e.StartFlow(ctx, "process_multi_instance", "node_start", "T001", inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 4 {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+	signs := result.NextNodes
+	for i, item := range signs {
+		if item.Node.Code != "node_countersign" || candidates(item) != input["signers"].([]string)[i] {
+			t.Fatalf("无效的会签实例：%s", result.String())
+		}
+	}
+
+	result = handle(signs[0], "T002")
+	if len(result.NextNodes) != 0 {
+		t.Fatalf("会签未满足完成条件：%s", result.String())
+	}
+
+	// 半数完成后满足完成条件，取消其余会签实例(统计前锁定流程实例，冲突时重新执行)
+	store.conflicts = 1
+	result = handle(signs[1], "T003")
+	if len(result.NextNodes) != 1 || candidates(result.NextNodes[0]) != "T006" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	} else if store.conflicts != 0 {
+		t.Fatalf("并行多实例完成时应锁定流程实例")
+	}
+	_, err = e.HandleFlow(ctx, signs[2].NodeInstance.RecordID, "T004", inputData)
+	if err == nil {
+		t.Fatalf("已取消的会签实例不能处理")
+	}
+
+	// 顺序会签依次创建实例，全部完成后继续流转
+	result = handle(result.NextNodes[0], "T006")
+	if len(result.NextNodes) != 1 || candidates(result.NextNodes[0]) != "T007" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	} else if result.NextNodes[0].NodeInstance.LoopCounter != 1 {
+		t.Fatalf("无效的循环序号：%d", result.NextNodes[0].NodeInstance.LoopCounter)
+	}
+
+	result = handle(result.NextNodes[0], "T007")
+	if !result.IsEnd {
+		t.Fatalf("流程应结束：%s", result.String())
+	}
+}
+
+func TestCorrelateMessage(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/message_event.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	correlate := func(name, orderID string, vars map[string]interface{}) *HandleResult {
+		var keys map[string]interface{}
+		if orderID != "" {
+			keys = map[string]interface{}{"order_id": orderID}
+		}
+		result, err := e.CorrelateMessage(ctx, name, keys, vars)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return result
+	}
+
+	// 消息开始事件发起流程实例，关联变量保存到流程数据
+	order1 := correlate("order_created", "A001", map[string]interface{}{"owner": "T001"})
+	if len(order1.NextNodes) != 1 || order1.NextNodes[0].Node.Code != "node_payment" {
+		t.Fatalf("无效的下一节点：%s", order1.String())
+	}
+	order2 := correlate("order_created", "A002", map[string]interface{}{"owner": "T002"})
+
+	// 多个流程实例等待同一消息时需要指定关联变量
+	_, err = e.CorrelateMessage(ctx, "payment_received", nil, nil)
+	var cerr *MessageCorrelationError
+	if !errors.As(err, &cerr) || cerr.Count != 2 {
+		t.Fatalf("消息应关联到多个节点：%v", err)
+	}
+
+	result := correlate("payment_received", "A001", map[string]interface{}{"paid": true})
+	if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_signed" ||
+		result.FlowInstance.RecordID != order1.FlowInstance.RecordID {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	_, err = e.CorrelateMessage(ctx, "document_signed", map[string]interface{}{"order_id": "A002"}, nil)
+	if !errors.As(err, &cerr) || cerr.Count != 0 {
+		t.Fatalf("消息不应关联到节点：%v", err)
+	}
+
+	result = correlate("document_signed", "A001", nil)
+	if len(result.NextNodes) != 1 || strings.Join(result.NextNodes[0].CandidateIDs, ",") != "T001" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(result.NextNodes[0].NodeInstance.InputData), &input)
+	if input["paid"] != true || input["order_id"] != "A001" {
+		t.Fatalf("消息变量未合并到流程数据：%+v", input)
+	}
+
+	// 人工任务上名为message的扩展属性不是消息引用
+	_, err = e.CorrelateMessage(ctx, "document_signed", map[string]interface{}{"order_id": "A001"}, nil)
+	if !errors.As(err, &cerr) || cerr.Count != 0 {
+		t.Fatalf("消息不应关联到人工任务：%v", err)
+	}
+
+	result = correlate("payment_received", "", nil)
+	if result.FlowInstance.RecordID != order2.FlowInstance.RecordID {
+		t.Fatalf("消息应关联到订单A002：%s", result.String())
+	}
+}
+
+func TestBroadcastSignal(t *testing.T) {
+	store := model.NewMemory()
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), store)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, name := range []string{"test_data/signal_catch.bpmn", "test_data/signal_start.bpmn", "test_data/signal_throw.bpmn"} {
+		err = e.LoadFile(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	ctx := context.Background()
+	start := func(flowCode string) *HandleResult {
+		result, err := e.StartFlow(ctx, flowCode, "node_start", "T001", nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return result
+	}
+	codes := func(results []*HandleResult) string {
+		var s []string
+		for _, result := range results {
+			for _, item := range result.NextNodes {
+				s = append(s, item.Node.Code)
+			}
+		}
+		return strings.Join(s, ",")
+	}
+
+	// 广播信号继续流转所有等待该信号的流程实例
+	start("process_signal_catch")
+	start("process_signal_catch")
+	results, err := e.BroadcastSignal(ctx, "audit_finished", map[string]interface{}{"audited": true})
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if codes(results) != "node_approve,node_approve" {
+		t.Fatalf("无效的下一节点：%s", codes(results))
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal([]byte(results[0].NextNodes[0].NodeInstance.InputData), &input)
+	if input["audited"] != true {
+		t.Fatalf("信号变量未合并到流程数据：%+v", input)
+	}
+	approve := results[0].NextNodes[0]
+
+	// 中间抛出事件广播信号
+	start("process_signal_catch")
+	if result := start("process_signal_throw"); !result.IsEnd {
+		t.Fatalf("流程应结束：%s", result.String())
+	}
+
+	todos, err := e.QueryTodoFlows("process_signal_catch", "T002")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 3 {
+		t.Fatalf("无效的待办数量：%d", len(todos))
+	}
+
+	// 信号边界事件中断待处理的审批，信号开始事件发起新的流程实例
+	results, err = e.BroadcastSignal(ctx, "policy_changed", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if codes(results) != "node_reroute,node_reroute,node_reroute,node_notice" {
+		t.Fatalf("无效的下一节点：%s", codes(results))
+	}
+
+	_, err = e.HandleFlow(ctx, approve.NodeInstance.RecordID, "T002", nil)
+	if err == nil {
+		t.Fatalf("已取消的审批不能处理")
+	}
+
+	// 单个流程实例处理失败不影响其他流程实例，并返回处理失败的目标
+	broken := start("process_signal_catch").NextNodes[0].NodeInstance
+	start("process_signal_catch")
+	err = store.UpdateNodeInstance(ctx, broken.RecordID, map[string]interface{}{"input_data": "{"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	results, err = e.BroadcastSignal(ctx, "audit_finished", map[string]interface{}{"audited": true})
+	var signalErr *SignalBroadcastError
+	if !errors.As(err, &signalErr) {
+		t.Fatalf("应返回信号广播错误：%v", err)
+	} else if len(signalErr.Failures) != 1 || signalErr.Failures[0].FlowInstanceID != broken.FlowInstanceID {
+		t.Fatalf("无效的处理失败目标：%+v", signalErr.Failures)
+	} else if codes(results) != "node_approve" {
+		t.Fatalf("无效的下一节点：%s", codes(results))
+	}
+
+	// 已有事务中广播信号时，失败目标的写入无法单独回滚
+	err = e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		_, err := e.BroadcastSignal(ctx, "audit_finished", nil)
+		return err
+	})
+	if err == nil {
+		t.Fatal("不能在已有事务中广播信号")
+	}
+}
+
+func TestExclusiveGatewayDefaultFlow(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, name := range []string{"test_data/exclusive_default.bpmn", "test_data/exclusive_no_path.bpmn"} {
+		err = e.LoadFile(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	ctx := context.Background()
+	for day, code := range map[int]string{5: "node_long", 2: "node_medium", 1: "node_other"} {
+		inputData, _ := json.Marshal(map[string]interface{}{"day": day})
+		result, err := e.StartFlow(ctx, "process_exclusive_default", "node_start", "T001", inputData)
+		if err != nil {
+			t.Fatal(err.Error())
+		} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != code {
+			t.Fatalf("请假%d天应流转到%s：%s", day, code, result.String())
+		}
+	}
+
+	inputData, _ := json.Marshal(map[string]interface{}{"day": 1})
+	_, err = e.StartFlow(ctx, "process_exclusive_no_path", "node_start", "T001", inputData)
+
+	var pathErr *NoOutgoingPathError
+	if !errors.As(err, &pathErr) || pathErr.NodeCode != "node_check" {
+		t.Fatalf("无效的错误：%v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"flow/expression"
+	"fmt"
 )
 
 // Execer 表达式执行器
@@ -13,6 +14,9 @@ type Execer interface {
 
 	// 执行表达式返回字符串切片类型的值
 	ExecReturnStringSlice(ctx context.Context, exp, params []byte) ([]string, error)
+
+	// 执行脚本返回map类型的值(脚本作为函数体执行，使用return返回结果)
+	ExecReturnMap(ctx context.Context, script, params []byte) (map[string]interface{}, error)
 }
 
 // NewQLangExecer 创建基于qlang的表达式执行器
@@ -50,3 +54,18 @@ func (*execer) ExecReturnStringSlice(ctx context.Context, exp, params []byte) ([
 	}
 	return expression.ExecParamSliceStr(ctx, string(exp), m)
 }
+
+func (*execer) ExecReturnMap(ctx context.Context, script, params []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := json.Unmarshal(params, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := fmt.Sprintf("fn() {\n%s\n}()", script)
+	expCtx, ok := FromExpContext(ctx)
+	if ok {
+		return expression.ExecParamMap(expCtx, exp, m)
+	}
+	return expression.ExecParamMap(ctx, exp, m)
+}
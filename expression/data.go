@@ -72,7 +72,45 @@ func (d OutData) SliceStr() ([]string, error) {
 	if ok {
 		return r, nil
 	}
-	return nil, errors.Errorf("返回值的类型错误:%s", r)
+
+	// 元素均为字符串的切片(如流程数据中的JSON数组)逐项转换，空切片无法确定元素类型
+	if items, ok := d.Result.([]interface{}); ok && len(items) > 0 {
+		r = make([]string, 0, len(items))
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("返回值的类型错误:%v", d.Result)
+			}
+			r = append(r, s)
+		}
+		return r, nil
+	}
+	return nil, errors.Errorf("返回值的类型错误:%v", d.Result)
+}
+
+// Map 获取map类型数据
+func (d OutData) Map() (map[string]interface{}, error) {
+	if d.IsUndefined() {
+		return nil, errors.Errorf("未定义变量：spec.Undefined")
+	}
+	if d.IsNil() {
+		return nil, nil
+	}
+	r, ok := d.Result.(map[string]interface{})
+	if ok {
+		return r, nil
+	}
+
+	// 值类型相同的map(如map[string]int)逐项转换
+	v := reflect.ValueOf(d.Result)
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+		r = make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			r[key.String()] = v.MapIndex(key).Interface()
+		}
+		return r, nil
+	}
+	return nil, errors.Errorf("返回值的类型错误:%v", d.Result)
 }
 
 // Float 获取浮点数类型数据
@@ -346,3 +346,16 @@ func (t *testExpression) execslicestr(exp string) ([]string, error) {
 	}
 	return out.SliceStr()
 }
+
+func Test_ExecParamError(t *testing.T) {
+	// 表达式执行错误时返回错误(此前忽略错误继续转换空结果)
+	_, err := expression.ExecParamBool(context.Background(), `]`, nil)
+	if err == nil {
+		t.Error("ExecParamBool() 期望表达式语法错误")
+	}
+
+	_, err = expression.ExecParamSliceStr(context.Background(), `]`, nil)
+	if err == nil {
+		t.Error("ExecParamSliceStr() 期望表达式语法错误")
+	}
+}
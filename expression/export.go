@@ -45,6 +45,11 @@ func ExecParamSliceStr(ctx context.Context, exp string, vars map[string]interfac
 	return SliceStr(ExecParam(ctx, exp, vars))
 }
 
+// ExecParamMap 执行表达式，返回map
+func ExecParamMap(ctx context.Context, exp string, vars map[string]interface{}) (map[string]interface{}, error) {
+	return Map(ExecParam(ctx, exp, vars))
+}
+
 // ExecPredefineVar 执行表达式,传入预编译参数
 func ExecPredefineVar(ctx context.Context, exp string, key string, predefinestr string) (*OutData, error) {
 	ectx := CreateExpContext(ctx)
@@ -70,16 +75,25 @@ func ExecBool(ctx ExpContext, exp string) (bool, error) {
 // Bool 返回布尔值
 func Bool(d *OutData, err ...error) (bool, error) {
 
-	if len(err) > 1 && err[0] != nil {
+	if len(err) > 0 && err[0] != nil {
 		return false, err[0]
 	}
 	return d.Bool()
 }
 
+// Map 返回map
+func Map(d *OutData, err ...error) (map[string]interface{}, error) {
+
+	if len(err) > 0 && err[0] != nil {
+		return nil, err[0]
+	}
+	return d.Map()
+}
+
 // SliceStr 返回字符串切片
 func SliceStr(d *OutData, err ...error) ([]string, error) {
 
-	if len(err) > 1 && err[0] != nil {
+	if len(err) > 0 && err[0] != nil {
 		return nil, err[0]
 	}
 	return d.SliceStr()
@@ -0,0 +1,135 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"flow/bll"
+	"flow/schema"
+	"time"
+)
+
+// 外部任务的服务任务类型(camunda:type="external")
+const externalServiceType = "external"
+
+// 定义外部任务错误
+var (
+	ErrExternalTaskNotFound  = bll.ErrExternalTaskNotFound  // 外部任务不存在或已不再等待执行
+	ErrExternalTaskNotLocked = bll.ErrExternalTaskNotLocked // 外部任务未被当前工作者锁定或锁定已过期
+)
+
+// LockedExternalTask 已锁定的外部任务
+type LockedExternalTask struct {
+	*schema.ExternalTask
+	Input map[string]interface{} `json:"input"` // 流程数据
+}
+
+// FetchAndLock 领取并锁定主题下的外部任务
+// topic 主题
+// workerID 工作者标识
+// max 最多领取的任务数
+// lockDuration 锁定时长(超过锁定时长未完成的任务可被其他工作者重新领取)
+func (e *Engine) FetchAndLock(topic, workerID string, max int, lockDuration time.Duration) ([]*LockedExternalTask, error) {
+	if max <= 0 {
+		return nil, nil
+	}
+
+	items, err := e.flowBll.QueryUnlockedExternalTask(topic, max)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	var tasks []*LockedExternalTask
+	for _, item := range items {
+		ok, err := e.flowBll.LockExternalTask(item, workerID, lockDuration)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		ni, err := e.flowBll.GetNodeInstance(ctx, item.NodeInstanceID)
+		if err != nil {
+			return nil, err
+		} else if ni == nil || ni.Status != 1 {
+			// 节点已不再等待处理(如被中断边界事件取消)，移除外部任务
+			err = e.flowBll.DeleteExternalTask(ctx, item.RecordID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		task := &LockedExternalTask{
+			ExternalTask: item,
+			Input:        make(map[string]interface{}),
+		}
+		if ni.InputData != "" {
+			_ = json.Unmarshal([]byte(ni.InputData), &task.Input)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// CompleteExternalTask 完成外部任务，vars合并到流程数据后继续流转
+// taskID 外部任务内码
+// workerID 锁定任务的工作者标识
+// vars 任务的输出变量
+func (e *Engine) CompleteExternalTask(ctx context.Context, taskID, workerID string, vars map[string]interface{}) (*HandleResult, error) {
+	var result *HandleResult
+	err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		item, err := e.flowBll.GetLockedExternalTask(ctx, taskID, workerID)
+		if err != nil {
+			return err
+		}
+
+		ni, err := e.flowBll.GetNodeInstance(ctx, item.NodeInstanceID)
+		if err != nil {
+			return err
+		} else if ni == nil {
+			return ErrNotFound
+		}
+
+		inputData, err := mergeInputData([]byte(ni.InputData), vars)
+		if err != nil {
+			return err
+		}
+
+		err = e.flowBll.CompleteExternalTask(ctx, taskID)
+		if err != nil {
+			return err
+		}
+
+		result, err = e.continueFlow(ctx, item.NodeInstanceID, workerID, inputData)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// HandleExternalTaskFailure 处理外部任务执行失败
+// retries 剩余重试次数(不大于0时任务转为执行失败状态，不再被领取)
+// retryTimeout 重新领取前的等待时间
+func (e *Engine) HandleExternalTaskFailure(taskID, workerID, errorMessage string, retries int, retryTimeout time.Duration) error {
+	return e.flowBll.Transaction(context.Background(), func(ctx context.Context) error {
+		_, err := e.flowBll.GetLockedExternalTask(ctx, taskID, workerID)
+		if err != nil {
+			return err
+		}
+		return e.flowBll.FailExternalTask(ctx, taskID, errorMessage, retries, time.Now().Add(retryTimeout).Unix())
+	})
+}
+
+// ExtendExternalTaskLock 延长外部任务的锁定时间(从当前时间开始计算)
+func (e *Engine) ExtendExternalTaskLock(taskID, workerID string, lockDuration time.Duration) error {
+	return e.flowBll.Transaction(context.Background(), func(ctx context.Context) error {
+		_, err := e.flowBll.GetLockedExternalTask(ctx, taskID, workerID)
+		if err != nil {
+			return err
+		}
+		return e.flowBll.ExtendExternalTaskLock(ctx, taskID, time.Now().Add(lockDuration).Unix())
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"flow/expression/sql"
+	"flow/model"
 	"flow/schema"
 	"flow/service/db"
 	"net/http"
@@ -15,17 +16,31 @@ var (
 
 // Init 初始化流程配置
 func Init(opts ...db.Option) {
-	db, trace, err := db.NewMySQL(opts...)
+	db, err := db.NewDB(opts...)
 	if err != nil {
 		panic(err)
 	}
 
-	e, err := new(Engine).Init(NewXMLParser(), NewQLangExecer(), db, trace)
+	InitWithDB(db)
+}
+
+// InitWithDB 使用指定的数据库实例初始化流程配置
+func InitWithDB(db *db.DB, opts ...EngineOption) {
+	e, err := new(Engine).InitWithDB(NewXMLParser(), NewQLangExecer(), db, opts...)
+	if err != nil {
+		panic(err)
+	}
+	engine = e
+	sql.Reg(db.Db)
+}
+
+// InitWithStore 使用指定的流程存储初始化流程配置(不依赖数据库连接)
+func InitWithStore(store model.Store, opts ...EngineOption) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), store, opts...)
 	if err != nil {
 		panic(err)
 	}
 	engine = e
-	sql.Reg(db)
 }
 
 // SetParser 设定解析器
@@ -38,6 +53,16 @@ func SetExecer(execer Execer) {
 	engine.SetExecer(execer)
 }
 
+// SetBusinessCalendar 设定工作日历
+func SetBusinessCalendar(calendar BusinessCalendar) {
+	engine.SetBusinessCalendar(calendar)
+}
+
+// RegisterServiceHandler 注册服务任务处理函数
+func RegisterServiceHandler(name string, handler ServiceHandler) {
+	engine.RegisterServiceHandler(name, handler)
+}
+
 // LoadFile 加载流程文件数据
 func LoadFile(name string) error {
 	return engine.LoadFile(name)
@@ -0,0 +1,737 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flow"
+	"flow/schema"
+	"flow/service/db"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 创建基于数据库的流程引擎(MySQL/PostgreSQL使用已有的测试库，测试数据带有随机后缀以免冲突)
+func newDBEngine(t *testing.T, opts ...db.Option) *flow.Engine {
+	d, err := db.NewDB(opts...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { d.Close() })
+
+	e, err := new(flow.Engine).InitWithDB(flow.NewXMLParser(), flow.NewQLangExecer(), d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/leave.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return e
+}
+
+// 测试的数据库方言(MySQL/PostgreSQL需要设置测试连接串环境变量)
+var testDialects = []string{db.DialectSQLite, db.DialectMySQL, db.DialectPostgres}
+
+// 获取方言对应的数据库配置(SQLite使用临时文件，避免:memory:在多连接下数据不共享)
+// SQLite仅使用一个连接，事务中未使用事务的查询会因等待连接而阻塞
+func testDBOptions(t *testing.T, dialect string) []db.Option {
+	var dsn string
+	switch dialect {
+	case db.DialectSQLite:
+		return []db.Option{db.SetDialect(dialect), db.SetDSN(filepath.Join(t.TempDir(), "flow.db")), db.SetMaxOpenConns(1)}
+	case db.DialectMySQL:
+		dsn = os.Getenv("FLOW_TEST_MYSQL_DSN")
+	case db.DialectPostgres:
+		dsn = os.Getenv("FLOW_TEST_POSTGRES_DSN")
+	}
+	if dsn == "" {
+		// CI中设置FLOW_TEST_REQUIRE_DB，未配置数据库时测试失败而不是跳过
+		if os.Getenv("FLOW_TEST_REQUIRE_DB") != "" {
+			t.Fatalf("未设置%s的测试连接串", dialect)
+		}
+		t.Skipf("未设置%s的测试连接串", dialect)
+	}
+	return []db.Option{db.SetDialect(dialect), db.SetDSN(dsn)}
+}
+
+// 在各数据库方言下执行测试
+func runDBTest(t *testing.T, fn func(*testing.T, *flow.Engine)) {
+	for _, dialect := range testDialects {
+		t.Run(dialect, func(t *testing.T) {
+			fn(t, newDBEngine(t, testDBOptions(t, dialect)...))
+		})
+	}
+}
+
+func TestDBLeaveBzrApprovalPass(t *testing.T) {
+	runDBTest(t, testDBLeaveBzrApprovalPass)
+}
+
+func TestDBLargeBPMN(t *testing.T) {
+	runDBTest(t, testDBLargeBPMN)
+}
+
+func testDBLeaveBzrApprovalPass(t *testing.T, e *flow.Engine) {
+	var (
+		ctx      = context.Background()
+		flowCode = "process_leave_test"
+		suffix   = strconv.FormatInt(time.Now().UnixNano(), 36)
+		launcher = "T001-" + suffix
+		bzr      = "T002-" + suffix
+	)
+
+	input := map[string]interface{}{
+		"day": 1,
+		"bzr": bzr,
+	}
+	inputData, _ := json.Marshal(input)
+
+	// 开始流程
+	result, err := e.StartFlow(ctx, flowCode, "node_start", launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if result.NextNodes[0].CandidateIDs[0] != bzr {
+		t.Fatalf("无效的下一级流转：%s", result.String())
+	}
+
+	// 查询待办
+	todos, err := e.QueryTodoFlows(flowCode, bzr)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 1 {
+		t.Fatalf("无效的待办数据：%d", len(todos))
+	}
+
+	// 处理流程（通过）
+	input["action"] = "pass"
+	inputData, _ = json.Marshal(input)
+	result, err = e.HandleFlow(ctx, todos[0].RecordID, bzr, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !result.IsEnd {
+		t.Fatalf("无效的处理结果：%s", result.String())
+	}
+
+	// 查询已办及历史
+	dones, err := e.FlowBll().QueryDone("", flowCode, bzr, 0, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(dones) != 1 || dones[0].FlowStatus != 9 {
+		t.Fatalf("无效的已办数据：%+v", dones)
+	}
+
+	histories, err := e.QueryFlowHistory(todos[0].FlowInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(histories) == 0 {
+		t.Fatal("未查询到流程历史数据")
+	}
+
+	// 分页查询流程
+	total, flows, err := e.FlowBll().QueryAllFlowPage(schema.FlowQueryParam{Code: flowCode}, 1, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if total == 0 || len(flows) == 0 {
+		t.Fatalf("无效的流程分页数据：%d", total)
+	}
+
+	_, flows, err = e.FlowBll().QueryGroupFlowPage(schema.FlowQueryParam{}, 1, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(flows) == 0 {
+		t.Fatalf("无效的流程分组数据：%d", len(flows))
+	}
+}
+
+func TestSQLiteMigration(t *testing.T) {
+	d, err := db.NewDB(
+		db.SetDialect(db.DialectSQLite),
+		db.SetDSN(filepath.Join(t.TempDir(), "flow.db")),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer d.Close()
+
+	// 模拟旧版本创建的定时表(缺少flag列)
+	_, err = d.Exec("CREATE TABLE f_node_timing (id integer not null primary key autoincrement, node_instance_id varchar(255), processor varchar(36), input varchar(1024), expired_at integer, created integer, deleted integer)")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = new(flow.Engine).InitWithDB(flow.NewXMLParser(), flow.NewQLangExecer(), d, flow.EngineMigrationOption(flow.MigrationVerify))
+	if err == nil {
+		t.Fatal("期望未执行迁移的校验错误")
+	}
+
+	_, err = new(flow.Engine).InitWithDB(flow.NewXMLParser(), flow.NewQLangExecer(), d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	exists, err := d.HasColumn(schema.NodeTimingTableName, "flag")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !exists {
+		t.Fatal("未添加定时标志列")
+	}
+
+	exists, err = d.HasIndex(schema.FlowTableName, "uk_f_flow_code_version_deleted")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !exists {
+		t.Fatal("未创建流程版本唯一索引")
+	}
+
+	exists, err = d.HasIndex(schema.NodeRouterTableName, "idx_f_node_router_target_node_id")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !exists {
+		t.Fatal("未创建节点路由目标节点索引")
+	}
+
+	exists, err = d.HasIndex(schema.NodeInstanceTableName, "idx_f_node_instance_node_id_status")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !exists {
+		t.Fatal("未创建节点实例按节点及状态查询的索引")
+	}
+
+	_, err = new(flow.Engine).InitWithDB(flow.NewXMLParser(), flow.NewQLangExecer(), d, flow.EngineMigrationOption(flow.MigrationVerify))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// 创建流程失败时，已创建的内嵌子流程应随事务回滚
+func TestSQLiteCreateFlowRollback(t *testing.T) {
+	d, err := db.NewDB(
+		db.SetDialect(db.DialectSQLite),
+		db.SetDSN(filepath.Join(t.TempDir(), "flow.db")),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer d.Close()
+
+	e, err := new(flow.Engine).InitWithDB(flow.NewXMLParser(), flow.NewQLangExecer(), d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// 插入父级流程(标志为1)时失败
+	_, err = d.Exec("CREATE TRIGGER f_flow_insert_fail BEFORE INSERT ON f_flow WHEN NEW.flag=1 BEGIN SELECT RAISE(ABORT, 'fail'); END")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	data, err := os.ReadFile("test_data/sub_process.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = e.CreateFlow(data)
+	if err == nil {
+		t.Fatal("期望创建流程失败")
+	}
+
+	n, err := d.SelectInt(fmt.Sprintf("SELECT COUNT(*) FROM %s", schema.FlowTableName))
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if n != 0 {
+		t.Fatalf("存在未回滚的子流程：%d", n)
+	}
+}
+
+func TestDBConcurrentMigration(t *testing.T) {
+	for _, dialect := range testDialects {
+		t.Run(dialect, func(t *testing.T) {
+			opts := testDBOptions(t, dialect)
+
+			// 模拟多个实例同时启动执行迁移
+			errs := make(chan error, 4)
+			for i := 0; i < cap(errs); i++ {
+				go func() {
+					d, err := db.NewDB(opts...)
+					if err != nil {
+						errs <- err
+						return
+					}
+					defer d.Close()
+
+					_, err = new(flow.Engine).InitWithDB(flow.NewXMLParser(), flow.NewQLangExecer(), d)
+					errs <- err
+				}()
+			}
+			for i := 0; i < cap(errs); i++ {
+				if err := <-errs; err != nil {
+					t.Fatal(err.Error())
+				}
+			}
+
+			d, err := db.NewDB(opts...)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			defer d.Close()
+
+			// 迁移后的表结构包含结构体映射的全部列
+			for table, item := range map[string]interface{}{
+				schema.FlowTableName:           schema.Flow{},
+				schema.NodeTableName:           schema.Node{},
+				schema.NodeRouterTableName:     schema.NodeRouter{},
+				schema.NodeAssignmentTableName: schema.NodeAssignment{},
+				schema.NodePropertyTableName:   schema.NodeProperty{},
+				schema.FlowInstanceTableName:   schema.FlowInstance{},
+				schema.NodeInstanceTableName:   schema.NodeInstance{},
+				schema.NodeTimingTableName:     schema.NodeTiming{},
+				schema.ExternalTaskTableName:   schema.ExternalTask{},
+				schema.NodeCandidateTableName:  schema.NodeCandidate{},
+				schema.FormTableName:           schema.Form{},
+			} {
+				v := reflect.TypeOf(item)
+				for i := 0; i < v.NumField(); i++ {
+					column := strings.Split(v.Field(i).Tag.Get("db"), ",")[0]
+					exists, err := d.HasColumn(table, column)
+					if err != nil {
+						t.Fatal(err.Error())
+					} else if !exists {
+						t.Fatalf("迁移后缺少数据列：%s.%s", table, column)
+					}
+				}
+			}
+		})
+	}
+}
+
+func testDBLargeBPMN(t *testing.T, e *flow.Engine) {
+	var (
+		ctx      = context.Background()
+		flowCode = "process_large_test"
+		launcher = "L001-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	)
+
+	// Camunda Modeler导出的流程文件(含表单、网关及流程图)
+	data, err := ioutil.ReadFile("test_data/large_approval.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(data) < 300*1024 {
+		t.Fatalf("无效的流程文件大小：%d", len(data))
+	}
+
+	flowID, err := e.CreateFlow(data)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	item, err := e.FlowBll().GetFlow(context.Background(), flowID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if item.XML != string(data) {
+		t.Fatalf("流程文件被截断：%d/%d", len(item.XML), len(data))
+	}
+
+	// 发起流程(输入数据超过旧的1024字节限制)
+	inputData, _ := json.Marshal(map[string]interface{}{
+		"memo": strings.Repeat("报销说明", 20000),
+	})
+	result, err := e.StartFlow(ctx, flowCode, "StartEvent_1", launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].NodeInstance == nil {
+		t.Fatalf("无效的下一级流转：%s", result.String())
+	}
+
+	nodeInstance, err := e.GetNodeInstance(result.NextNodes[0].NodeInstance.RecordID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if nodeInstance.InputData != string(inputData) {
+		t.Fatalf("输入数据被截断：%d/%d", len(nodeInstance.InputData), len(inputData))
+	}
+
+	// 审核退回时流转到报销申请
+	inputData, _ = json.Marshal(map[string]interface{}{"action": "back"})
+	result, err = e.HandleFlow(ctx, nodeInstance.RecordID, launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "Task_14e2y9l" {
+		t.Fatalf("无效的下一级流转：%s", result.String())
+	}
+}
+
+func TestDBRollbackOnRoutingError(t *testing.T) {
+	runDBTest(t, testDBRollbackOnRoutingError)
+}
+
+// 流转条件表达式执行失败时，当前节点的完成状态应随事务回滚
+func testDBRollbackOnRoutingError(t *testing.T, e *flow.Engine) {
+	var (
+		ctx      = context.Background()
+		flowCode = "process_leave_test"
+		suffix   = strconv.FormatInt(time.Now().UnixNano(), 36)
+		launcher = "R001-" + suffix
+		bzr      = "R002-" + suffix
+	)
+
+	input := map[string]interface{}{
+		"day": 2,
+		"bzr": bzr,
+	}
+	inputData, _ := json.Marshal(input)
+
+	result, err := e.StartFlow(ctx, flowCode, "node_start", launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	nodeInstanceID := result.NextNodes[0].NodeInstance.RecordID
+
+	// 流转条件为input.day>1，传入非数值的天数使其执行失败
+	input["action"] = "pass"
+	input["day"] = map[string]interface{}{"value": 2}
+	inputData, _ = json.Marshal(input)
+	_, err = e.HandleFlow(ctx, nodeInstanceID, bzr, inputData)
+	if err == nil {
+		t.Fatal("期望流转条件执行错误")
+	}
+
+	nodeInstance, err := e.GetNodeInstance(nodeInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if nodeInstance.Status != 1 || nodeInstance.Processor != "" {
+		t.Fatalf("节点实例未回滚：%+v", nodeInstance)
+	}
+
+	histories, err := e.QueryFlowHistory(nodeInstance.FlowInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, item := range histories {
+		if item.NodeCode == "node_user_fdy" {
+			t.Fatalf("存在未回滚的后续节点：%+v", item)
+		}
+	}
+}
+
+func TestDBStopFlow(t *testing.T) {
+	runDBTest(t, testDBStopFlow)
+}
+
+// 按节点实例停止流程，待处理的节点实例随之取消
+func testDBStopFlow(t *testing.T, e *flow.Engine) {
+	var (
+		ctx      = context.Background()
+		suffix   = strconv.FormatInt(time.Now().UnixNano(), 36)
+		launcher = "S001-" + suffix
+	)
+
+	inputData, _ := json.Marshal(map[string]interface{}{"day": 1, "bzr": "S002-" + suffix})
+	result, err := e.StartFlow(ctx, "process_leave_test", "node_start", launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	nodeInstanceID := result.NextNodes[0].NodeInstance.RecordID
+
+	err = e.StopFlow(nodeInstanceID, func(flowInstance *schema.FlowInstance) bool {
+		return flowInstance.Launcher == launcher
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	nodeInstance, err := e.GetNodeInstance(nodeInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if nodeInstance.Status != 3 {
+		t.Fatalf("待处理的节点实例未取消：%+v", nodeInstance)
+	}
+}
+
+func TestDBNodeInstanceConflict(t *testing.T) {
+	runDBTest(t, testDBNodeInstanceConflict)
+}
+
+// 模拟两个服务实例读取到同一版本的节点实例后先后完成
+func testDBNodeInstanceConflict(t *testing.T, e *flow.Engine) {
+	var (
+		ctx      = context.Background()
+		flowCode = "process_leave_test"
+		suffix   = strconv.FormatInt(time.Now().UnixNano(), 36)
+		launcher = "C001-" + suffix
+		bzr      = "C002-" + suffix
+	)
+
+	inputData, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": bzr,
+	})
+	result, err := e.StartFlow(ctx, flowCode, "node_start", launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	nodeInstance := result.NextNodes[0].NodeInstance
+
+	store := e.FlowBll().FlowModel
+	info := map[string]interface{}{"processor": bzr, "status": 2}
+	err = store.UpdateNodeInstanceWithVersion(ctx, nodeInstance.RecordID, 1, nodeInstance.Version, info)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = store.UpdateNodeInstanceWithVersion(ctx, nodeInstance.RecordID, 1, nodeInstance.Version, info)
+	var cerr *flow.ConflictError
+	if !errors.As(err, &cerr) || cerr.RecordID != nodeInstance.RecordID {
+		t.Fatalf("期望并发更新冲突错误：%v", err)
+	}
+}
+
+func TestDBClaimNodeTiming(t *testing.T) {
+	runDBTest(t, testDBClaimNodeTiming)
+}
+
+// 多个引擎实例领取同一到期定时，只有一个领取成功
+func testDBClaimNodeTiming(t *testing.T, e *flow.Engine) {
+	item := &schema.NodeTiming{
+		NodeInstanceID: "T-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		ExpiredAt:      time.Now().Add(-time.Minute).Unix(),
+		Created:        time.Now().Unix(),
+	}
+	err := e.FlowBll().CreateNodeTiming(context.Background(), item)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer e.FlowBll().DeleteNodeTiming(context.Background(), item.NodeInstanceID)
+
+	items, err := e.FlowBll().QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var claimed, lost []*schema.NodeTiming
+	for _, owner := range []string{"E001", "E002"} {
+		for _, v := range items {
+			if v.NodeInstanceID != item.NodeInstanceID {
+				continue
+			}
+			c := *v
+			ok, err := e.FlowBll().ClaimNodeTiming(&c, owner, time.Minute)
+			if err != nil {
+				t.Fatal(err.Error())
+			} else if ok {
+				claimed = append(claimed, &c)
+			} else {
+				c.Owner = owner
+				lost = append(lost, &c)
+			}
+		}
+	}
+	if len(claimed) != 1 || len(lost) != 1 {
+		t.Fatalf("无效的领取次数：%d", len(claimed))
+	}
+
+	// 未持有租约的引擎实例不能标记失败或删除定时
+	err = e.FlowBll().FailNodeTiming(lost[0], errors.New("失败"), 3, time.Now().Unix())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ok, err := e.FlowBll().DeleteClaimedNodeTiming(context.Background(), lost[0])
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if ok {
+		t.Fatal("未持有租约时不应删除定时")
+	}
+
+	ok, err = e.FlowBll().DeleteClaimedNodeTiming(context.Background(), claimed[0])
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !ok {
+		t.Fatal("持有租约时删除定时失败")
+	}
+
+	// 其他引擎实例查询到定时后，定时已被持有租约的实例转为死信，不能再领取执行
+	item.ID, item.NodeInstanceID = 0, item.NodeInstanceID+"-dead"
+	err = e.FlowBll().CreateNodeTiming(context.Background(), item)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer e.FlowBll().DeleteNodeTiming(context.Background(), item.NodeInstanceID)
+
+	listed := *item
+	ok, err = e.FlowBll().ClaimNodeTiming(item, "E001", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("领取定时失败：%v", err)
+	}
+
+	err = e.FlowBll().FailNodeTiming(item, errors.New("失败"), 1, time.Now().Unix())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ok, err = e.FlowBll().ClaimNodeTiming(&listed, "E002", time.Minute)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if ok {
+		t.Fatal("死信定时不应被领取")
+	}
+}
+
+func TestDBLockExternalTask(t *testing.T) {
+	runDBTest(t, testDBLockExternalTask)
+}
+
+// 多个工作者领取同一外部任务，只有一个锁定成功
+func testDBLockExternalTask(t *testing.T, e *flow.Engine) {
+	topic := "T-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	item, err := e.FlowBll().CreateExternalTask(context.Background(), "F001", "N001", topic)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer e.FlowBll().DeleteExternalTask(context.Background(), item.RecordID)
+
+	items, err := e.FlowBll().QueryUnlockedExternalTask(topic, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 1 {
+		t.Fatalf("无效的外部任务数量：%d", len(items))
+	}
+
+	var locked int
+	for _, worker := range []string{"W001", "W002"} {
+		c := *items[0]
+		ok, err := e.FlowBll().LockExternalTask(&c, worker, time.Minute)
+		if err != nil {
+			t.Fatal(err.Error())
+		} else if ok {
+			locked++
+		}
+	}
+	if locked != 1 {
+		t.Fatalf("无效的锁定次数：%d", locked)
+	}
+
+	_, err = e.FlowBll().GetLockedExternalTask(context.Background(), item.RecordID, "W001")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestDBCallActivity(t *testing.T) {
+	runDBTest(t, testDBCallActivity)
+}
+
+// 调用活动发起子流程实例，停止父级流程实例时同时停止子流程实例
+func testDBCallActivity(t *testing.T, e *flow.Engine) {
+	for _, name := range []string{"test_data/sub_approve.bpmn", "test_data/call_activity.bpmn", "test_data/sub_process.bpmn"} {
+		err := e.LoadFile(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	ctx := context.Background()
+	launcher := "T001-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	inputData, _ := json.Marshal(map[string]interface{}{"day": 3})
+	result, err := e.StartFlow(ctx, "process_call_activity", "node_start", launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 2 || result.NextNodes[0].Node.Code != "node_sub_approve" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	err = e.StopFlowInstance(result.FlowInstance.RecordID, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	subFlowInstance, err := e.FlowBll().GetFlowInstance(ctx, result.NextNodes[0].NodeInstance.FlowInstanceID)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if subFlowInstance.ParentID != result.FlowInstance.RecordID || subFlowInstance.Status != 9 {
+		t.Fatalf("子流程实例应已停止：%+v", subFlowInstance)
+	}
+
+	result, err = e.StartFlow(ctx, "process_sub_process", "node_start", launcher, inputData)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_confirm" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+}
+
+func TestDBLaunchNoneStartEvent(t *testing.T) {
+	runDBTest(t, testDBLaunchNoneStartEvent)
+}
+
+// 流程同时存在空开始事件及消息开始事件时，按流程ID发起从空开始事件流转
+func testDBLaunchNoneStartEvent(t *testing.T, e *flow.Engine) {
+	err := e.LoadFile("test_data/mixed_start.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	f, err := e.FlowBll().GetFlowByCode(ctx, "process_mixed_start")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result, err := e.LaunchFlow(ctx, f.RecordID, "T001", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_repair" {
+		t.Fatalf("应从空开始事件发起：%s", result.String())
+	}
+
+	// 消息开始事件不能按节点编号直接发起
+	_, err = e.StartFlow(ctx, "process_mixed_start", "node_message_start", "T001", nil)
+	if err == nil {
+		t.Fatal("消息开始事件不应直接发起")
+	}
+
+	todos, err := e.QueryTodoFlows("process_mixed_start", "T002")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(todos) != 1 {
+		t.Fatalf("无效的待办数量：%d", len(todos))
+	}
+}
+
+func TestDBCorrelateMessage(t *testing.T) {
+	runDBTest(t, testDBCorrelateMessage)
+}
+
+// 消息开始事件发起流程实例，按关联变量查找等待消息的节点实例
+func testDBCorrelateMessage(t *testing.T, e *flow.Engine) {
+	err := e.LoadFile("test_data/message_event.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	keys := map[string]interface{}{"order_id": "A-" + strconv.FormatInt(time.Now().UnixNano(), 36)}
+	result, err := e.CorrelateMessage(ctx, "order_created", keys, map[string]interface{}{"owner": "T001"})
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_payment" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+
+	result, err = e.CorrelateMessage(ctx, "payment_received", keys, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 || result.NextNodes[0].Node.Code != "node_signed" {
+		t.Fatalf("无效的下一节点：%s", result.String())
+	}
+}
@@ -1,18 +1,36 @@
 package flow_test
 
 import (
+	"context"
 	"encoding/json"
 	"flow"
-	"flow/service/db"
-	_ "github.com/go-sql-driver/mysql"
+	"flow/expression"
+	_ "flow/expression/builtin"
+	"flow/model"
 	"testing"
 )
 
+// 测试用的申请审批人(对应test_data/flows_test_apply_users.sql)
+var testApplyUsers = []map[string]interface{}{
+	{"user_id": "A002", "launcher": "A001"},
+	{"user_id": "A003", "launcher": "A001"},
+}
+
 func init() {
-	flow.Init(
-		db.SetDSN("root:password@tcp(10.31.0.220:34616)/flow_test?charset=utf8"),
-		db.SetTrace(false),
-	)
+	flow.InitWithStore(model.NewMemory())
+
+	// 使用内存数据模拟SQL查询
+	expression.GlobalImport("sqlctx", map[string]interface{}{
+		"Query": func(ctx context.Context, query string, args ...interface{}) []map[string]interface{} {
+			var out []map[string]interface{}
+			for _, item := range testApplyUsers {
+				if len(args) > 0 && item["launcher"] == args[0] {
+					out = append(out, item)
+				}
+			}
+			return out
+		},
+	})
 
 	err := flow.LoadFile("test_data/leave.bpmn")
 	if err != nil {
@@ -372,7 +390,7 @@ func TestLeaveRepeatedBack(t *testing.T) {
 
 	// 处理流程（退回）
 	input["action"] = "back"
-	result, err = flow.HandleFlow(todos[0].RecordID, fdy, input)
+	result, err = flow.HandleFlow(todos[0].RecordID, yld, input)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -384,7 +402,7 @@ func TestLeaveRepeatedBack(t *testing.T) {
 	}
 
 	// 处理流程
-	result, err = flow.HandleFlow(todos[0].RecordID, fdy, input)
+	result, err = flow.HandleFlow(todos[0].RecordID, launcher, input)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -2,23 +2,26 @@ module flow
 
 go 1.21.2
 
+require (
+	github.com/LyricTian/retry v0.0.0-20171017083003-4f244cadd8eb
+	github.com/beevik/etree v1.4.1
+	github.com/fatih/structs v1.1.0
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/lib/pq v1.12.3
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/pkg/errors v0.9.1
+	github.com/satori/go.uuid v1.2.0
+	github.com/teambition/gear v1.27.3
+	github.com/xushiwei/qlang v1.5.3
+	gopkg.in/gorp.v2 v2.2.0
+)
+
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/LyricTian/retry v0.0.0-20171017083003-4f244cadd8eb // indirect
-	github.com/beevik/etree v1.4.1 // indirect
-	github.com/facebookgo/inject v0.0.0-20180706035515-f23751cae28b // indirect
-	github.com/facebookgo/structtag v0.0.0-20150214074306-217e25fb9691 // indirect
-	github.com/fatih/structs v1.1.0 // indirect
 	github.com/go-http-utils/cookie v1.3.1 // indirect
 	github.com/go-http-utils/negotiator v1.0.0 // indirect
-	github.com/go-sql-driver/mysql v1.8.1 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
 	github.com/qiniu/text v1.9.2 // indirect
-	github.com/satori/go.uuid v1.2.0 // indirect
-	github.com/teambition/gear v1.27.3 // indirect
 	github.com/teambition/trie-mux v1.5.2 // indirect
-	github.com/xushiwei/qlang v1.5.3 // indirect
 	golang.org/x/net v0.14.0 // indirect
 	golang.org/x/text v0.12.0 // indirect
-	gopkg.in/gorp.v2 v2.2.0 // indirect
 )
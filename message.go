@@ -0,0 +1,180 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"flow/schema"
+	"fmt"
+	"reflect"
+)
+
+// MessageCorrelationError 消息关联错误(没有等待该消息的节点或消息开始事件，或者关联到多个节点)
+type MessageCorrelationError struct {
+	MessageName string // 消息名称
+	Count       int    // 关联到的等待节点数量
+}
+
+func (e *MessageCorrelationError) Error() string {
+	if e.Count == 0 {
+		return fmt.Sprintf("消息(%s)没有可关联的节点", e.MessageName)
+	}
+	return fmt.Sprintf("消息(%s)关联到%d个等待的节点", e.MessageName, e.Count)
+}
+
+// CorrelateMessage 关联消息
+// 按消息名称查找等待该消息的节点实例(消息中间捕获事件或接收任务)，correlationKeys按流程数据中的变量(如业务单号)匹配，
+// 关联到一个节点实例时将variables合并到流程数据后继续流转；没有等待的节点实例时按消息开始事件发起新的流程实例
+// name 消息名称
+// correlationKeys 关联变量
+// variables 合并到流程数据的变量
+func (e *Engine) CorrelateMessage(ctx context.Context, name string, correlationKeys, variables map[string]interface{}) (*HandleResult, error) {
+	var result *HandleResult
+	err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+		items, starts, err := e.queryMessageReceivers(ctx, name, correlationKeys)
+		if err != nil {
+			return err
+		}
+
+		if len(items) == 1 {
+			inputData, err := mergeInputData([]byte(items[0].InputData), variables)
+			if err != nil {
+				return err
+			}
+
+			result, err = e.continueFlow(ctx, items[0].RecordID, "", inputData)
+			return err
+		} else if len(items) > 1 {
+			return &MessageCorrelationError{MessageName: name, Count: len(items)}
+		} else if len(starts) != 1 {
+			return &MessageCorrelationError{MessageName: name, Count: len(starts)}
+		}
+
+		// 关联变量作为新流程实例的数据，以便后续消息关联
+		inputData, err := mergeInputData(nil, correlationKeys)
+		if err != nil {
+			return err
+		}
+		inputData, err = mergeInputData(inputData, variables)
+		if err != nil {
+			return err
+		}
+
+		result, err = e.startEventFlow(ctx, starts[0], inputData)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 查询等待消息并且流程数据与关联变量匹配的节点实例，以及最新版本流程中的消息开始事件
+func (e *Engine) queryMessageReceivers(ctx context.Context, name string, correlationKeys map[string]interface{}) ([]*schema.NodeInstance, []*schema.Node, error) {
+	nodes, err := e.flowBll.QueryNodesByProperty(ctx, "message_name", name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var items []*schema.NodeInstance
+	var starts []*schema.Node
+	for _, node := range nodes {
+		if node.TypeCode == StartEvent.String() {
+			latest, err := e.isLatestFlow(ctx, node.FlowID)
+			if err != nil {
+				return nil, nil, err
+			} else if latest {
+				starts = append(starts, node)
+			}
+			continue
+		}
+
+		nodeInstances, err := e.flowBll.QueryPendingNodeInstancesByNode(ctx, node.RecordID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, ni := range nodeInstances {
+			if !matchVariables(ni.InputData, correlationKeys) {
+				continue
+			}
+
+			active, err := e.isActiveFlowInstance(ctx, ni.FlowInstanceID)
+			if err != nil {
+				return nil, nil, err
+			} else if active {
+				items = append(items, ni)
+			}
+		}
+	}
+	return items, starts, nil
+}
+
+// 检查流程是否是同一编号的最新可用版本(不包括内嵌子流程)
+func (e *Engine) isLatestFlow(ctx context.Context, flowID string) (bool, error) {
+	flow, err := e.flowBll.GetFlow(ctx, flowID)
+	if err != nil {
+		return false, err
+	} else if flow == nil || flow.Flag == 2 {
+		return false, nil
+	}
+
+	latest, err := e.flowBll.GetFlowByCode(ctx, flow.Code)
+	if err != nil {
+		return false, err
+	}
+	return latest != nil && latest.RecordID == flow.RecordID, nil
+}
+
+// 检查流程实例是否进行中
+func (e *Engine) isActiveFlowInstance(ctx context.Context, flowInstanceID string) (bool, error) {
+	flowInstance, err := e.flowBll.GetFlowInstance(ctx, flowInstanceID)
+	if err != nil {
+		return false, err
+	}
+	return flowInstance != nil && flowInstance.Status == 1, nil
+}
+
+// 由消息或信号开始事件发起流程实例(没有发起人，开始事件后的人工任务不自动完成)
+func (e *Engine) startEventFlow(ctx context.Context, node *schema.Node, inputData []byte) (*HandleResult, error) {
+	flow, err := e.flowBll.GetFlow(ctx, node.FlowID)
+	if err != nil {
+		return nil, err
+	} else if flow == nil {
+		return nil, ErrNotFound
+	}
+
+	nodeInstance, err := e.flowBll.LaunchFlowInstance(ctx, flow.Code, node.Code, "", inputData)
+	if err != nil {
+		return nil, err
+	} else if nodeInstance == nil {
+		return nil, ErrNotFound
+	}
+	return e.nextFlowHandle(ctx, nodeInstance.RecordID, "", inputData, AutoStartOption(false))
+}
+
+// 检查流程数据中的变量是否与关联变量全部匹配(按JSON值比较)
+func matchVariables(inputData string, keys map[string]interface{}) bool {
+	if len(keys) == 0 {
+		return true
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(inputData), &data); err != nil {
+		return false
+	}
+
+	for k, v := range keys {
+		val, ok := data[k]
+		if !ok {
+			return false
+		}
+
+		var expected interface{}
+		buf, _ := json.Marshal(v)
+		_ = json.Unmarshal(buf, &expected)
+		if !reflect.DeepEqual(val, expected) {
+			return false
+		}
+	}
+	return true
+}
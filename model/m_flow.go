@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"flow/schema"
 	"flow/service/db"
@@ -13,51 +14,77 @@ import (
 
 // Flow 流程管理
 type Flow struct {
-	DB *db.DB `inject:""`
+	DB *db.DB
 }
 
-// CreateFlow 创建流程数据
-func (a *Flow) CreateFlow(flow *schema.Flow, nodes *schema.NodeOperating, forms *schema.FormOperating) error {
+// Transaction 在事务中执行(上下文中已存在事务时直接复用)
+func (a *Flow) Transaction(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := fromTransContext(ctx); ok {
+		return fn(ctx)
+	}
+
 	tran, err := a.DB.Begin()
 	if err != nil {
-		return errors.Wrapf(err, "创建流程基础数据开启事物发生错误")
+		return errors.Wrapf(err, "开启事务发生错误")
 	}
 
-	err = tran.Insert(flow)
+	err = fn(newTransContext(ctx, tran))
 	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "插入流程数据发生错误")
+		if rerr := tran.Rollback(); rerr != nil {
+			return errors.Wrapf(rerr, "回滚事务发生错误：%s", err.Error())
+		}
+		return err
 	}
 
-	if list := nodes.All(); len(list) > 0 {
-		err = tran.Insert(list...)
-		if err != nil {
-			_ = tran.Rollback()
-			return errors.Wrapf(err, "插入节点数据发生错误")
+	err = tran.Commit()
+	if err != nil {
+		return errors.Wrapf(err, "提交事务发生错误")
+	}
+	return nil
+}
+
+// 获取上下文中的事务，不存在时使用数据库连接
+func (a *Flow) getExecutor(ctx context.Context) db.Executor {
+	if v, ok := fromTransContext(ctx); ok {
+		if tran, ok := v.(*db.Trans); ok {
+			return tran
 		}
 	}
+	return a.DB
+}
 
-	if list := forms.All(); len(list) > 0 {
-		err = tran.Insert(list...)
+// CreateFlow 创建流程数据
+func (a *Flow) CreateFlow(ctx context.Context, flow *schema.Flow, nodes *schema.NodeOperating, forms *schema.FormOperating) error {
+	return a.Transaction(ctx, func(ctx context.Context) error {
+		tran := a.getExecutor(ctx)
+		err := tran.Insert(flow)
 		if err != nil {
-			_ = tran.Rollback()
-			return errors.Wrapf(err, "插入表单数据发生错误")
+			return errors.Wrapf(err, "插入流程数据发生错误")
 		}
-	}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程基础数据提交事物发生错误")
-	}
-	return nil
+		if list := nodes.All(); len(list) > 0 {
+			err = tran.Insert(list...)
+			if err != nil {
+				return errors.Wrapf(err, "插入节点数据发生错误")
+			}
+		}
+
+		if list := forms.All(); len(list) > 0 {
+			err = tran.Insert(list...)
+			if err != nil {
+				return errors.Wrapf(err, "插入表单数据发生错误")
+			}
+		}
+		return nil
+	})
 }
 
 // GetFlow 获取流程数据
-func (a *Flow) GetFlow(recordID string) (*schema.Flow, error) {
+func (a *Flow) GetFlow(ctx context.Context, recordID string) (*schema.Flow, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND record_id=? LIMIT 1", schema.FlowTableName)
 
 	var flow schema.Flow
-	err := a.DB.SelectOne(&flow, query, recordID)
+	err := a.getExecutor(ctx).SelectOne(&flow, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -69,11 +96,11 @@ func (a *Flow) GetFlow(recordID string) (*schema.Flow, error) {
 }
 
 // GetFlowByCode 根据编号查询流程数据
-func (a *Flow) GetFlowByCode(code string) (*schema.Flow, error) {
+func (a *Flow) GetFlowByCode(ctx context.Context, code string) (*schema.Flow, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND flag=1 AND status=1 AND code=? ORDER BY version DESC LIMIT 1", schema.FlowTableName)
 
 	var flow schema.Flow
-	err := a.DB.SelectOne(&flow, query, code)
+	err := a.getExecutor(ctx).SelectOne(&flow, query, code)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -98,11 +125,11 @@ func (a *Flow) QueryFlowByCode(flowCode string) ([]*schema.Flow, error) {
 }
 
 // GetNode 获取流程节点
-func (a *Flow) GetNode(recordID string) (*schema.Node, error) {
+func (a *Flow) GetNode(ctx context.Context, recordID string) (*schema.Node, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND record_id=?", schema.NodeTableName)
 
 	var item schema.Node
-	err := a.DB.SelectOne(&item, query, recordID)
+	err := a.getExecutor(ctx).SelectOne(&item, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -114,11 +141,11 @@ func (a *Flow) GetNode(recordID string) (*schema.Node, error) {
 }
 
 // GetNodeByCode 根据节点编号获取流程节点
-func (a *Flow) GetNodeByCode(flowID, nodeCode string) (*schema.Node, error) {
+func (a *Flow) GetNodeByCode(ctx context.Context, flowID, nodeCode string) (*schema.Node, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND flow_id=? AND code=? ORDER BY order_num LIMIT 1", schema.NodeTableName)
 
 	var item schema.Node
-	err := a.DB.SelectOne(&item, query, flowID, nodeCode)
+	err := a.getExecutor(ctx).SelectOne(&item, query, flowID, nodeCode)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -130,11 +157,11 @@ func (a *Flow) GetNodeByCode(flowID, nodeCode string) (*schema.Node, error) {
 }
 
 // GetFlowInstance 获取流程实例
-func (a *Flow) GetFlowInstance(recordID string) (*schema.FlowInstance, error) {
+func (a *Flow) GetFlowInstance(ctx context.Context, recordID string) (*schema.FlowInstance, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND record_id=? LIMIT 1", schema.FlowInstanceTableName)
 
 	var item schema.FlowInstance
-	err := a.DB.SelectOne(&item, query, recordID)
+	err := a.getExecutor(ctx).SelectOne(&item, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -146,11 +173,11 @@ func (a *Flow) GetFlowInstance(recordID string) (*schema.FlowInstance, error) {
 }
 
 // GetFlowInstanceByNode 根据节点实例获取流程实例
-func (a *Flow) GetFlowInstanceByNode(nodeInstanceID string) (*schema.FlowInstance, error) {
+func (a *Flow) GetFlowInstanceByNode(ctx context.Context, nodeInstanceID string) (*schema.FlowInstance, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND record_id IN (SELECT flow_instance_id FROM %s WHERE deleted=0 AND record_id=?) LIMIT 1", schema.FlowInstanceTableName, schema.NodeInstanceTableName)
 
 	var item schema.FlowInstance
-	err := a.DB.SelectOne(&item, query, nodeInstanceID)
+	err := a.getExecutor(ctx).SelectOne(&item, query, nodeInstanceID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -162,11 +189,11 @@ func (a *Flow) GetFlowInstanceByNode(nodeInstanceID string) (*schema.FlowInstanc
 }
 
 // GetNodeInstance 获取流程节点实例
-func (a *Flow) GetNodeInstance(recordID string) (*schema.NodeInstance, error) {
+func (a *Flow) GetNodeInstance(ctx context.Context, recordID string) (*schema.NodeInstance, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND record_id=? LIMIT 1", schema.NodeInstanceTableName)
 
 	var item schema.NodeInstance
-	err := a.DB.SelectOne(&item, query, recordID)
+	err := a.getExecutor(ctx).SelectOne(&item, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -178,11 +205,24 @@ func (a *Flow) GetNodeInstance(recordID string) (*schema.NodeInstance, error) {
 }
 
 // QueryNodeRouters 查询节点路由
-func (a *Flow) QueryNodeRouters(sourceNodeID string) ([]*schema.NodeRouter, error) {
-	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND source_node_id=?", schema.NodeRouterTableName)
+func (a *Flow) QueryNodeRouters(ctx context.Context, sourceNodeID string) ([]*schema.NodeRouter, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND source_node_id=? ORDER BY id", schema.NodeRouterTableName)
 
 	var items []*schema.NodeRouter
-	_, err := a.DB.Select(&items, query, sourceNodeID)
+	_, err := a.getExecutor(ctx).Select(&items, query, sourceNodeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询节点路由发生错误")
+	}
+
+	return items, nil
+}
+
+// QueryNodeRoutersByTarget 查询流入节点的路由
+func (a *Flow) QueryNodeRoutersByTarget(ctx context.Context, targetNodeID string) ([]*schema.NodeRouter, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND target_node_id=?", schema.NodeRouterTableName)
+
+	var items []*schema.NodeRouter
+	_, err := a.getExecutor(ctx).Select(&items, query, targetNodeID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点路由发生错误")
 	}
@@ -191,11 +231,11 @@ func (a *Flow) QueryNodeRouters(sourceNodeID string) ([]*schema.NodeRouter, erro
 }
 
 // QueryNodeAssignments 查询节点指派
-func (a *Flow) QueryNodeAssignments(nodeID string) ([]*schema.NodeAssignment, error) {
+func (a *Flow) QueryNodeAssignments(ctx context.Context, nodeID string) ([]*schema.NodeAssignment, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND node_id=?", schema.NodeAssignmentTableName)
 
 	var items []*schema.NodeAssignment
-	_, err := a.DB.Select(&items, query, nodeID)
+	_, err := a.getExecutor(ctx).Select(&items, query, nodeID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点指派发生错误")
 	}
@@ -204,107 +244,123 @@ func (a *Flow) QueryNodeAssignments(nodeID string) ([]*schema.NodeAssignment, er
 }
 
 // CreateNodeInstance 创建流程节点实例
-func (a *Flow) CreateNodeInstance(nodeInstance *schema.NodeInstance, nodeCandidates []*schema.NodeCandidate) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程节点实例开启事物发生错误")
-	}
-
-	err = tran.Insert(nodeInstance)
-	if err != nil {
-		err = tran.Rollback()
+func (a *Flow) CreateNodeInstance(ctx context.Context, nodeInstance *schema.NodeInstance, nodeCandidates []*schema.NodeCandidate) error {
+	return a.Transaction(ctx, func(ctx context.Context) error {
+		tran := a.getExecutor(ctx)
+		err := tran.Insert(nodeInstance)
 		if err != nil {
-			return errors.Wrapf(err, "创建流程节点实例回滚事物发生错误")
+			return errors.Wrapf(err, "插入流程节点实例数据发生错误")
 		}
-		return errors.Wrapf(err, "插入流程节点实例数据发生错误")
-	}
 
-	for _, c := range nodeCandidates {
-		err = tran.Insert(c)
-		if err != nil {
-			err = tran.Rollback()
+		for _, c := range nodeCandidates {
+			err = tran.Insert(c)
 			if err != nil {
-				return errors.Wrapf(err, "创建流程节点实例回滚事物发生错误")
+				return errors.Wrapf(err, "插入流程节点候选人数据发生错误")
 			}
-			return errors.Wrapf(err, "插入流程节点候选人数据发生错误")
 		}
-	}
+		return nil
+	})
+}
 
-	err = tran.Commit()
+// UpdateNodeInstance 更新节点实例信息
+func (a *Flow) UpdateNodeInstance(ctx context.Context, recordID string, info map[string]interface{}) error {
+	query, args := a.DB.UpdateSQL(schema.NodeInstanceTableName, db.M{"record_id": recordID}, db.M(info))
+	_, err := a.getExecutor(ctx).Exec(query, args...)
 	if err != nil {
-		return errors.Wrapf(err, "创建流程节点实例提交事物发生错误")
+		return errors.Wrapf(err, "更新节点实例信息发生错误")
 	}
 	return nil
 }
 
-// UpdateNodeInstance 更新节点实例信息
-func (a *Flow) UpdateNodeInstance(recordID string, info map[string]interface{}) error {
-	_, err := a.DB.UpdateByPK(schema.NodeInstanceTableName, db.M{"record_id": recordID}, db.M(info))
+// UpdateNodeInstanceWithVersion 按状态及版本号更新节点实例信息(版本号递增，未更新时返回ConflictError)
+func (a *Flow) UpdateNodeInstanceWithVersion(ctx context.Context, recordID string, status, version int64, info map[string]interface{}) error {
+	return a.updateWithVersion(ctx, schema.NodeInstanceTableName, recordID, status, version, info)
+}
+
+// 按状态及版本号更新数据
+func (a *Flow) updateWithVersion(ctx context.Context, table, recordID string, status, version int64, info map[string]interface{}) error {
+	m := db.M{"version": version + 1}
+	for k, v := range info {
+		m[k] = v
+	}
+
+	query, args := a.DB.UpdateSQL(table, db.M{"record_id": recordID, "status": status, "version": version}, m)
+	result, err := a.getExecutor(ctx).Exec(query, args...)
 	if err != nil {
-		return errors.Wrapf(err, "更新节点实例信息发生错误")
+		return errors.Wrapf(err, "更新数据(%s)发生错误", table)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "获取数据(%s)更新行数发生错误", table)
+	} else if n == 0 {
+		return &ConflictError{Table: table, RecordID: recordID, Version: version}
 	}
 	return nil
 }
 
 // CheckFlowInstanceTodo 检查流程实例待办事项
-func (a *Flow) CheckFlowInstanceTodo(flowInstanceID string) (bool, error) {
+func (a *Flow) CheckFlowInstanceTodo(ctx context.Context, flowInstanceID string) (bool, error) {
 	query := fmt.Sprintf("SELECT count(*) FROM %s WHERE deleted=0 AND status=1 AND flow_instance_id=?", schema.NodeInstanceTableName)
-	n, err := a.DB.SelectInt(query, flowInstanceID)
+	n, err := a.getExecutor(ctx).SelectInt(query, flowInstanceID)
 	if err != nil {
 		return false, errors.Wrapf(err, "检查流程待办事项发生错误")
 	}
 	return n > 0, nil
 }
 
+// QuerySubFlowInstances 查询进行中的子流程实例
+func (a *Flow) QuerySubFlowInstances(ctx context.Context, parentID string) ([]*schema.FlowInstance, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=1 AND parent_id=?", schema.FlowInstanceTableName)
+
+	var items []*schema.FlowInstance
+	_, err := a.getExecutor(ctx).Select(&items, query, parentID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询子流程实例发生错误")
+	}
+	return items, nil
+}
+
 // UpdateFlowInstance 更新流程实例信息
-func (a *Flow) UpdateFlowInstance(recordID string, info map[string]interface{}) error {
-	_, err := a.DB.UpdateByPK(schema.FlowInstanceTableName, db.M{"record_id": recordID}, db.M(info))
+func (a *Flow) UpdateFlowInstance(ctx context.Context, recordID string, info map[string]interface{}) error {
+	query, args := a.DB.UpdateSQL(schema.FlowInstanceTableName, db.M{"record_id": recordID}, db.M(info))
+	_, err := a.getExecutor(ctx).Exec(query, args...)
 	if err != nil {
 		return errors.Wrapf(err, "更新流程实例信息发生错误")
 	}
 	return nil
 }
 
-// CreateFlowInstance 创建流程实例
-func (a *Flow) CreateFlowInstance(flowInstance *schema.FlowInstance, nodeInstances ...*schema.NodeInstance) error {
-	tran, err := a.DB.Begin()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程实例开启事物发生错误")
-	}
+// UpdateFlowInstanceWithVersion 按状态及版本号更新流程实例信息(版本号递增，未更新时返回ConflictError)
+func (a *Flow) UpdateFlowInstanceWithVersion(ctx context.Context, recordID string, status, version int64, info map[string]interface{}) error {
+	return a.updateWithVersion(ctx, schema.FlowInstanceTableName, recordID, status, version, info)
+}
 
-	err = tran.Insert(flowInstance)
-	if err != nil {
-		err = tran.Rollback()
+// CreateFlowInstance 创建流程实例
+func (a *Flow) CreateFlowInstance(ctx context.Context, flowInstance *schema.FlowInstance, nodeInstances ...*schema.NodeInstance) error {
+	return a.Transaction(ctx, func(ctx context.Context) error {
+		tran := a.getExecutor(ctx)
+		err := tran.Insert(flowInstance)
 		if err != nil {
-			return errors.Wrapf(err, "创建流程实例回滚事物发生错误")
+			return errors.Wrapf(err, "插入流程实例数据发生错误")
 		}
-		return errors.Wrapf(err, "插入流程实例数据发生错误")
-	}
 
-	for _, n := range nodeInstances {
-		err = tran.Insert(n)
-		if err != nil {
-			err = tran.Rollback()
+		for _, n := range nodeInstances {
+			err = tran.Insert(n)
 			if err != nil {
-				return errors.Wrapf(err, "创建流程实例回滚事物发生错误")
+				return errors.Wrapf(err, "插入流程节点实例数据发生错误")
 			}
-			return errors.Wrapf(err, "插入流程节点实例数据发生错误")
 		}
-	}
-
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程实例提交事物发生错误")
-	}
-	return nil
+		return nil
+	})
 }
 
 // QueryNodeCandidates 查询节点候选人
-func (a *Flow) QueryNodeCandidates(nodeInstanceID string) ([]*schema.NodeCandidate, error) {
+func (a *Flow) QueryNodeCandidates(ctx context.Context, nodeInstanceID string) ([]*schema.NodeCandidate, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND node_instance_id=?", schema.NodeCandidateTableName)
 
 	var items []*schema.NodeCandidate
-	_, err := a.DB.Select(&items, query, nodeInstanceID)
+	_, err := a.getExecutor(ctx).Select(&items, query, nodeInstanceID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点候选人发生错误")
 	}
@@ -313,10 +369,10 @@ func (a *Flow) QueryNodeCandidates(nodeInstanceID string) ([]*schema.NodeCandida
 }
 
 // CheckNodeCandidate 检查节点候选人
-func (a *Flow) CheckNodeCandidate(nodeInstanceID, userID string) (bool, error) {
+func (a *Flow) CheckNodeCandidate(ctx context.Context, nodeInstanceID, userID string) (bool, error) {
 	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE deleted=0 AND node_instance_id=? AND candidate_id=?", schema.NodeCandidateTableName)
 
-	n, err := a.DB.SelectInt(query, nodeInstanceID, userID)
+	n, err := a.getExecutor(ctx).SelectInt(query, nodeInstanceID, userID)
 	if err != nil {
 		return false, errors.Wrapf(err, "检查节点候选人发生错误")
 	}
@@ -333,13 +389,13 @@ func (a *Flow) QueryTodo(typeCode, flowCode, userID string, count int) ([]*schem
 		  ni.flow_instance_id,
 		  ni.input_data,
 		  ni.node_id,
-		  f.data 'form_data',
-		  f.type_code 'form_type',
+		  f.data AS form_data,
+		  f.type_code AS form_type,
 		  fi.launcher,
 		  fi.launch_time,
-			n.code 'node_code',
-			n.name 'node_name',
-			fw.name 'flow_name'
+			n.code AS node_code,
+			n.name AS node_name,
+			fw.name AS flow_name
 		FROM %s ni
 		  JOIN %s fi ON ni.flow_instance_id = fi.record_id AND fi.deleted = ni.deleted
 		  LEFT JOIN %s n ON ni.node_id = n.record_id AND n.deleted = ni.deleted
@@ -374,13 +430,13 @@ func (a *Flow) GetTodoByID(nodeInstanceID string) (*schema.FlowTodoResult, error
 		  ni.flow_instance_id,
 		  ni.input_data,
 		  ni.node_id,
-		  f.data 'form_data',
-		  f.type_code 'form_type',
+		  f.data AS form_data,
+		  f.type_code AS form_type,
 		  fi.launcher,
 		  fi.launch_time,
-			n.code 'node_code',
-			n.name 'node_name',
-			fw.name 'flow_name'
+			n.code AS node_code,
+			n.name AS node_name,
+			fw.name AS flow_name
 		FROM %s ni
 		  JOIN %s fi ON ni.flow_instance_id = fi.record_id AND fi.deleted = ni.deleted
 		  LEFT JOIN %s n ON ni.node_id = n.record_id AND n.deleted = ni.deleted
@@ -412,14 +468,14 @@ func (a *Flow) GetDoneByID(nodeInstanceID string) (*schema.FlowDoneResult, error
 	ni.flow_instance_id,
 	ni.out_data,
 	ni.process_time,
-	f.data 'form_data',
-	f.type_code 'form_type',
-	fi.status 'flow_status',
+	f.data AS form_data,
+	f.type_code AS form_type,
+	fi.status AS flow_status,
 	fi.launcher,
 	fi.launch_time,
-	n.record_id 'node_id',
-	n.name 'node_name',
-	fw.name 'flow_name'`
+	n.record_id AS node_id,
+	n.name AS node_name,
+	fw.name AS flow_name`
 
 	query := fmt.Sprintf("SELECT %s FROM %s %s", fieldsSelect, table, where)
 
@@ -461,14 +517,14 @@ func (a *Flow) QueryDone(typeCode, flowCode, userID string, lastTime int64, coun
 	ni.flow_instance_id,
 	ni.out_data,
 	ni.process_time,
-	f.data 'form_data',
-	f.type_code 'form_type',
-	fi.status 'flow_status',
+	f.data AS form_data,
+	f.type_code AS form_type,
+	fi.status AS flow_status,
 	fi.launcher,
 	fi.launch_time,
-	n.record_id 'node_id',
-	n.name 'node_name',
-	fw.name 'flow_name'`
+	n.record_id AS node_id,
+	n.name AS node_name,
+	fw.name AS flow_name`
 
 	query := fmt.Sprintf("SELECT %s FROM %s %s ORDER BY ni.process_time DESC LIMIT %d", fieldsSelect, table, where, count)
 
@@ -552,11 +608,11 @@ func (a *Flow) QueryHistory(flowInstanceID string) ([]*schema.FlowHistoryResult,
 		ni.input_data,
 		ni.out_data,
 		ni.status,
-		n.record_id 'node_id',
-		n.code 'node_code',
-		n.name 'node_name',
-		f.data 'form_data',
-		f.type_code 'form_type'
+		n.record_id AS node_id,
+		n.code AS node_code,
+		n.name AS node_name,
+		f.data AS form_data,
+		f.type_code AS form_type
 		FROM %s ni JOIN %s n ON ni.node_id=n.record_id AND n.deleted=ni.deleted
 		LEFT JOIN %s f ON n.form_id = f.record_id AND f.deleted = n.deleted
 		WHERE ni.deleted=0 AND ni.flow_instance_id=? AND n.type_code='userTask'
@@ -612,7 +668,7 @@ func (a *Flow) QueryFlowIDsByType(typeCodes ...string) ([]string, error) {
 
 // QueryFlowByIDs 根据流程ID查询流程数据
 func (a *Flow) QueryFlowByIDs(flowIDs []string) ([]*schema.FlowQueryResult, error) {
-	query := fmt.Sprintf("SELECT code,MAX(version)'version' FROM %s WHERE deleted=0 AND flag=1 AND status=1 AND record_id IN(?)  GROUP BY code ORDER BY code", schema.FlowTableName)
+	query := fmt.Sprintf("SELECT code,MAX(version) AS version FROM %s WHERE deleted=0 AND flag=1 AND status=1 AND record_id IN(?)  GROUP BY code ORDER BY code", schema.FlowTableName)
 
 	query, args, err := a.DB.In(query, flowIDs)
 	if err != nil {
@@ -655,7 +711,7 @@ func (a *Flow) QueryFlowByIDs(flowIDs []string) ([]*schema.FlowQueryResult, erro
 
 // GetFlowFormByNodeID 获取流程节点表单
 func (a *Flow) GetFlowFormByNodeID(nodeID string) (*schema.Form, error) {
-	node, err := a.GetNode(nodeID)
+	node, err := a.GetNode(context.Background(), nodeID)
 	if err != nil {
 		return nil, err
 	} else if node == nil || node.FormID == "" {
@@ -666,7 +722,7 @@ func (a *Flow) GetFlowFormByNodeID(nodeID string) (*schema.Form, error) {
 }
 
 // QueryNodeByTypeCodeAndFlowIDs 根据节点类型和流程ID列表查询节点数据
-func (a *Flow) QueryNodeByTypeCodeAndFlowIDs(typeCode string, flowIDs ...string) ([]*schema.Node, error) {
+func (a *Flow) QueryNodeByTypeCodeAndFlowIDs(ctx context.Context, typeCode string, flowIDs ...string) ([]*schema.Node, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND type_code=? AND flow_id IN(?)", schema.NodeTableName)
 	query, args, err := a.DB.In(query, typeCode, flowIDs)
 	if err != nil {
@@ -674,7 +730,7 @@ func (a *Flow) QueryNodeByTypeCodeAndFlowIDs(typeCode string, flowIDs ...string)
 	}
 
 	var items []*schema.Node
-	_, err = a.DB.Select(&items, query, args...)
+	_, err = a.getExecutor(ctx).Select(&items, query, args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "根据节点类型和流程ID列表查询节点数据发生错误")
 	}
@@ -683,11 +739,11 @@ func (a *Flow) QueryNodeByTypeCodeAndFlowIDs(typeCode string, flowIDs ...string)
 
 // GetNodeByFlowAndTypeCode 根据流程ID和节点类型获取节点数据
 // 准备废弃，请使用（QueryNodeByTypeCodeAndFlowIDs）代替
-func (a *Flow) GetNodeByFlowAndTypeCode(flowID, typeCode string) (*schema.Node, error) {
+func (a *Flow) GetNodeByFlowAndTypeCode(ctx context.Context, flowID, typeCode string) (*schema.Node, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND flow_id=? AND type_code=?", schema.NodeTableName)
 
 	var item schema.Node
-	err := a.DB.SelectOne(&item, query, flowID, typeCode)
+	err := a.getExecutor(ctx).SelectOne(&item, query, flowID, typeCode)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -723,11 +779,11 @@ func (a *Flow) Update(recordID string, info map[string]interface{}) error {
 }
 
 // QueryNodeProperty 查询节点属性
-func (a *Flow) QueryNodeProperty(nodeID string) ([]*schema.NodeProperty, error) {
+func (a *Flow) QueryNodeProperty(ctx context.Context, nodeID string) ([]*schema.NodeProperty, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND node_id=?", schema.NodePropertyTableName)
 
 	var items []*schema.NodeProperty
-	_, err := a.DB.Select(&items, query, nodeID)
+	_, err := a.getExecutor(ctx).Select(&items, query, nodeID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点属性发生错误")
 	}
@@ -735,9 +791,22 @@ func (a *Flow) QueryNodeProperty(nodeID string) ([]*schema.NodeProperty, error)
 	return items, nil
 }
 
+// QueryNodesByProperty 查询设定指定属性值的节点
+func (a *Flow) QueryNodesByProperty(ctx context.Context, name, value string) ([]*schema.Node, error) {
+	query := fmt.Sprintf("SELECT n.* FROM %s n JOIN %s p ON p.node_id=n.record_id WHERE n.deleted=0 AND p.deleted=0 AND p.name=? AND p.value=? ORDER BY n.id",
+		schema.NodeTableName, schema.NodePropertyTableName)
+
+	var items []*schema.Node
+	_, err := a.getExecutor(ctx).Select(&items, query, name, value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "根据属性查询节点发生错误")
+	}
+	return items, nil
+}
+
 // CreateNodeTiming 创建定时节点
-func (a *Flow) CreateNodeTiming(item *schema.NodeTiming) error {
-	err := a.DB.Insert(item)
+func (a *Flow) CreateNodeTiming(ctx context.Context, item *schema.NodeTiming) error {
+	err := a.getExecutor(ctx).Insert(item)
 	if err != nil {
 		return errors.Wrapf(err, "创建节点定时发生错误")
 	}
@@ -745,30 +814,163 @@ func (a *Flow) CreateNodeTiming(item *schema.NodeTiming) error {
 }
 
 // UpdateNodeTiming 更新定时节点
-func (a *Flow) UpdateNodeTiming(nodeInstanceID string, info map[string]interface{}) error {
-	_, err := a.DB.UpdateByPK(schema.NodeTimingTableName, db.M{"node_instance_id": nodeInstanceID}, db.M(info))
+func (a *Flow) UpdateNodeTiming(ctx context.Context, nodeInstanceID string, info map[string]interface{}) error {
+	query, args := a.DB.UpdateSQL(schema.NodeTimingTableName, db.M{"node_instance_id": nodeInstanceID}, db.M(info))
+	_, err := a.getExecutor(ctx).Exec(query, args...)
 	if err != nil {
 		return errors.Wrapf(err, "更新节点定时发生错误")
 	}
 	return nil
 }
 
-// QueryExpiredNodeTiming 查询到期的定时节点
+// QueryExpiredNodeTiming 查询到期的定时节点(不包含租约未到期的定时)
 func (a *Flow) QueryExpiredNodeTiming() ([]*schema.NodeTiming, error) {
-	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND expired_at < ? ORDER BY expired_at", schema.NodeTimingTableName)
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=0 AND expired_at < ? AND lease_until < ? ORDER BY expired_at", schema.NodeTimingTableName)
 
+	now := time.Now().Unix()
 	var items []*schema.NodeTiming
-	_, err := a.DB.Select(&items, query, time.Now().Unix())
+	_, err := a.DB.Select(&items, query, now, now)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询到期的节点定时发生错误")
 	}
 	return items, nil
 }
 
+// ClaimNodeTiming 领取定时节点的租约(租约未到期时领取失败)
+func (a *Flow) ClaimNodeTiming(id int64, owner string, leaseUntil int64) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET owner=?,lease_until=? WHERE id=? AND deleted=0 AND status=0 AND lease_until < ?", schema.NodeTimingTableName)
+	result, err := a.DB.Exec(query, owner, leaseUntil, id, time.Now().Unix())
+	if err != nil {
+		return false, errors.Wrapf(err, "领取节点定时发生错误")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "领取节点定时发生错误")
+	}
+	return n > 0, nil
+}
+
+// UpdateNodeTimingByID 根据ID更新定时节点
+func (a *Flow) UpdateNodeTimingByID(ctx context.Context, id int64, info map[string]interface{}) error {
+	query, args := a.DB.UpdateSQL(schema.NodeTimingTableName, db.M{"id": id}, db.M(info))
+	_, err := a.getExecutor(ctx).Exec(query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "更新节点定时发生错误")
+	}
+	return nil
+}
+
+// UpdateClaimedNodeTiming 更新仍由owner持有租约的定时节点，返回是否更新(租约已过期或被其他引擎实例领取时不更新)
+func (a *Flow) UpdateClaimedNodeTiming(ctx context.Context, id int64, owner string, info map[string]interface{}) (bool, error) {
+	query, args := a.DB.UpdateSQL(schema.NodeTimingTableName, db.M{"id": id, "owner": owner, "deleted": 0}, db.M(info))
+	query = fmt.Sprintf("%s AND lease_until>=?", query)
+	result, err := a.getExecutor(ctx).Exec(query, append(args, time.Now().Unix())...)
+	if err != nil {
+		return false, errors.Wrapf(err, "更新节点定时发生错误")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "更新节点定时发生错误")
+	}
+	return n > 0, nil
+}
+
+// UpdateDeadNodeTiming 更新死信状态的定时节点，返回是否更新(定时不存在、已删除或不是死信时不更新)
+func (a *Flow) UpdateDeadNodeTiming(ctx context.Context, id int64, info map[string]interface{}) (bool, error) {
+	query, args := a.DB.UpdateSQL(schema.NodeTimingTableName, db.M{"id": id, "status": 1, "deleted": 0}, db.M(info))
+	result, err := a.getExecutor(ctx).Exec(query, args...)
+	if err != nil {
+		return false, errors.Wrapf(err, "更新死信节点定时发生错误")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "更新死信节点定时发生错误")
+	}
+	return n > 0, nil
+}
+
+// QueryDeadNodeTiming 查询死信状态的定时节点
+func (a *Flow) QueryDeadNodeTiming() ([]*schema.NodeTiming, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=1 ORDER BY id", schema.NodeTimingTableName)
+
+	var items []*schema.NodeTiming
+	_, err := a.DB.Select(&items, query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询死信节点定时发生错误")
+	}
+	return items, nil
+}
+
+// CreateExternalTask 创建外部任务
+func (a *Flow) CreateExternalTask(ctx context.Context, item *schema.ExternalTask) error {
+	err := a.getExecutor(ctx).Insert(item)
+	if err != nil {
+		return errors.Wrapf(err, "创建外部任务发生错误")
+	}
+	return nil
+}
+
+// GetExternalTask 获取外部任务
+func (a *Flow) GetExternalTask(ctx context.Context, recordID string) (*schema.ExternalTask, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND record_id=? LIMIT 1", schema.ExternalTaskTableName)
+
+	var item schema.ExternalTask
+	err := a.getExecutor(ctx).SelectOne(&item, query, recordID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "获取外部任务发生错误")
+	}
+	return &item, nil
+}
+
+// QueryUnlockedExternalTask 查询主题下待执行且未锁定的外部任务
+func (a *Flow) QueryUnlockedExternalTask(topic string, count int) ([]*schema.ExternalTask, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=0 AND topic=? AND lock_until < ? ORDER BY id LIMIT %d", schema.ExternalTaskTableName, count)
+
+	var items []*schema.ExternalTask
+	_, err := a.DB.Select(&items, query, topic, time.Now().Unix())
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询外部任务发生错误")
+	}
+	return items, nil
+}
+
+// LockExternalTask 锁定外部任务(任务已被锁定时返回false)
+func (a *Flow) LockExternalTask(recordID, workerID string, lockUntil int64) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET worker_id=?,lock_until=?,updated=? WHERE record_id=? AND deleted=0 AND status=0 AND lock_until < ?", schema.ExternalTaskTableName)
+
+	now := time.Now().Unix()
+	result, err := a.DB.Exec(query, workerID, lockUntil, now, recordID, now)
+	if err != nil {
+		return false, errors.Wrapf(err, "锁定外部任务发生错误")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "锁定外部任务发生错误")
+	}
+	return n > 0, nil
+}
+
+// UpdateExternalTask 更新外部任务
+func (a *Flow) UpdateExternalTask(ctx context.Context, recordID string, info map[string]interface{}) error {
+	query, args := a.DB.UpdateSQL(schema.ExternalTaskTableName, db.M{"record_id": recordID}, db.M(info))
+	_, err := a.getExecutor(ctx).Exec(query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "更新外部任务发生错误")
+	}
+	return nil
+}
+
 // QueryLaunchFlowInstanceResult 查询发起的流程实例数据
 func (a *Flow) QueryLaunchFlowInstanceResult(launcher, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error) {
 	var args []interface{}
-	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code 'flow_code',f.name 'flow_name' FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0", schema.FlowInstanceTableName, schema.FlowTableName)
+	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code AS flow_code,f.name AS flow_name FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0", schema.FlowInstanceTableName, schema.FlowTableName)
 	query = fmt.Sprintf("%s AND fi.launcher=?", query)
 	args = append(args, launcher)
 
@@ -800,7 +1002,7 @@ func (a *Flow) QueryLaunchFlowInstanceResult(launcher, typeCode, flowCode string
 // QueryTodoFlowInstanceResult 查询待办的流程实例数据
 func (a *Flow) QueryTodoFlowInstanceResult(userID, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error) {
 	var args []interface{}
-	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code 'flow_code',f.name 'flow_name' FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0 AND fi.status = 1", schema.FlowInstanceTableName, schema.FlowTableName)
+	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code AS flow_code,f.name AS flow_name FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0 AND fi.status = 1", schema.FlowInstanceTableName, schema.FlowTableName)
 	// query = fmt.Sprintf("%s AND fi.launcher!=?", query)
 	// args = append(args, userID)
 	query = fmt.Sprintf("%s AND fi.record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=1 AND record_id IN(SELECT node_instance_id FROM %s WHERE deleted=0 AND candidate_id=?))", query, schema.NodeInstanceTableName, schema.NodeCandidateTableName)
@@ -834,7 +1036,7 @@ func (a *Flow) QueryTodoFlowInstanceResult(userID, typeCode, flowCode string, la
 // QueryHandleFlowInstanceResult 查询处理的流程实例结果
 func (a *Flow) QueryHandleFlowInstanceResult(processor, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error) {
 	var args []interface{}
-	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code 'flow_code',f.name 'flow_name' FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0", schema.FlowInstanceTableName, schema.FlowTableName)
+	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code AS flow_code,f.name AS flow_name FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0", schema.FlowInstanceTableName, schema.FlowTableName)
 	query = fmt.Sprintf("%s AND fi.launcher!=?", query)
 	args = append(args, processor)
 	query = fmt.Sprintf("%s AND fi.record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=2 AND processor=?)", query, schema.NodeInstanceTableName)
@@ -868,7 +1070,7 @@ func (a *Flow) QueryHandleFlowInstanceResult(processor, typeCode, flowCode strin
 // QueryLastNodeInstances 查询流程实例的最后一个节点实例
 func (a *Flow) QueryLastNodeInstances(flowInstanceIDs []string) ([]*schema.NodeInstance, error) {
 	errMsg := "查询流程实例的最后一个节点实例发生错误"
-	query := fmt.Sprintf("SELECT MAX(id)'id' FROM %s WHERE deleted=0 AND flow_instance_id IN(?) GROUP BY flow_instance_id", schema.NodeInstanceTableName)
+	query := fmt.Sprintf("SELECT MAX(id) AS id FROM %s WHERE deleted=0 AND flow_instance_id IN(?) GROUP BY flow_instance_id", schema.NodeInstanceTableName)
 	query, args, err := a.DB.In(query, flowInstanceIDs)
 	if err != nil {
 		return nil, errors.Wrapf(err, errMsg)
@@ -904,6 +1106,42 @@ func (a *Flow) QueryLastNodeInstances(flowInstanceIDs []string) ([]*schema.NodeI
 	return items, nil
 }
 
+// QueryPendingNodeInstances 查询流程实例中待处理的节点实例
+func (a *Flow) QueryPendingNodeInstances(ctx context.Context, flowInstanceID string) ([]*schema.NodeInstance, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=1 AND flow_instance_id=? ORDER BY id", schema.NodeInstanceTableName)
+
+	var items []*schema.NodeInstance
+	_, err := a.getExecutor(ctx).Select(&items, query, flowInstanceID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询待处理的节点实例发生错误")
+	}
+	return items, nil
+}
+
+// QueryLoopNodeInstances 查询同一次激活的多实例节点实例
+func (a *Flow) QueryLoopNodeInstances(ctx context.Context, loopID string) ([]*schema.NodeInstance, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND loop_id=? ORDER BY id", schema.NodeInstanceTableName)
+
+	var items []*schema.NodeInstance
+	_, err := a.getExecutor(ctx).Select(&items, query, loopID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询多实例节点实例发生错误")
+	}
+	return items, nil
+}
+
+// QueryPendingNodeInstancesByNode 查询节点的待处理节点实例
+func (a *Flow) QueryPendingNodeInstancesByNode(ctx context.Context, nodeID string) ([]*schema.NodeInstance, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=1 AND node_id=? ORDER BY id", schema.NodeInstanceTableName)
+
+	var items []*schema.NodeInstance
+	_, err := a.getExecutor(ctx).Select(&items, query, nodeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询节点的待处理节点实例发生错误")
+	}
+	return items, nil
+}
+
 // QueryLastNodeInstance 查询节点实例
 func (a *Flow) QueryLastNodeInstance(flowInstanceID string) (*schema.NodeInstance, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND flow_instance_id=? ORDER BY id DESC LIMIT 1", schema.NodeInstanceTableName)
@@ -958,7 +1196,7 @@ func (a *Flow) QueryAllFlowPage(params schema.FlowQueryParam, pageIndex, pageSiz
 
 	query := fmt.Sprintf("SELECT id,record_id,created,code,name,version FROM %s %s ORDER BY id DESC", schema.FlowTableName, where)
 	if pageIndex > 0 && pageSize > 0 {
-		query = fmt.Sprintf("%s limit %d,%d", query, (pageIndex-1)*pageSize, pageSize)
+		query = fmt.Sprintf("%s LIMIT %d OFFSET %d", query, pageSize, (pageIndex-1)*pageSize)
 	}
 
 	var items []*schema.FlowQueryResult
@@ -997,7 +1235,7 @@ func (a *Flow) QueryGroupFlowPage(params schema.FlowQueryParam, pageIndex, pageS
 		args = append(args, v)
 	}
 
-	query := fmt.Sprintf("SELECT code,MAX(version)'version' FROM %s %s GROUP BY code ORDER BY code", schema.FlowTableName, where)
+	query := fmt.Sprintf("SELECT code,MAX(version) AS version FROM %s %s GROUP BY code ORDER BY code", schema.FlowTableName, where)
 
 	var items []*schema.Flow
 	_, err := a.DB.Select(&items, query, args...)
@@ -1081,20 +1319,21 @@ func (a *Flow) QueryFlowVersion(code string) ([]*schema.FlowQueryResult, error)
 // QueryTodoWebFlowInstanceResult web查询待办的流程实例数据
 func (a *Flow) QueryTodoWebFlowInstanceResult(userID, typeCode, flowCode string, count int, ParamSearchList map[string]string) ([]*schema.FlowWebInstanceResult, int64, error) {
 	var args []interface{}
-	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code 'flow_code',f.name 'flow_name' FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0 AND fi.status = 1 AND f.record_id NOT IN (select flow_id from f_flow_range where user_type=0 or user_type=2)", schema.FlowInstanceTableName, schema.FlowTableName)
+	title, status := a.DB.JSONField("input_data", "title"), a.DB.JSONField("input_data", "status")
+	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code AS flow_code,f.name AS flow_name FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0 AND fi.status = 1 AND f.record_id NOT IN (select flow_id from f_flow_range where user_type=0 or user_type=2)", schema.FlowInstanceTableName, schema.FlowTableName)
 	//最后的更改
 	if ParamSearchList != nil && len(ParamSearchList) > 0 {
-		tmpSql := `  AND input_data->'$.title' != '班干部学生状态修改' AND input_data->'$.title' != '学生调班申请'   AND input_data->'$.title' != '状态调整'  `
+		tmpSql := fmt.Sprintf(" AND %[1]s != '班干部学生状态修改' AND %[1]s != '学生调班申请' AND %[1]s != '状态调整' ", title)
 		for i, v := range ParamSearchList {
 			if i == "page" {
 				continue
 			}
-			tmpSql += ` AND input_data->'$.` + i + `' = ? `
+			tmpSql += fmt.Sprintf(" AND %s = ? ", a.DB.JSONField("input_data", i))
 			args = append(args, v)
 		}
-		query = fmt.Sprintf("%s AND fi.record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=1 %s AND input_data->'$.status' !=2  AND input_data->'$.status' !=3 AND record_id IN(SELECT node_instance_id FROM %s WHERE deleted=0 AND candidate_id=?))", query, schema.NodeInstanceTableName, tmpSql, schema.NodeCandidateTableName)
+		query = fmt.Sprintf("%s AND fi.record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=1 %s AND %s !='2' AND %s !='3' AND record_id IN(SELECT node_instance_id FROM %s WHERE deleted=0 AND candidate_id=?))", query, schema.NodeInstanceTableName, tmpSql, status, status, schema.NodeCandidateTableName)
 	} else {
-		query = fmt.Sprintf("%s AND fi.record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=1  AND input_data->'$.title' != '状态调整'  AND input_data->'$.status' !=2 AND input_data->'$.status' !=3  AND input_data->'$.title' != '班干部学生状态修改' AND input_data->'$.title' != '学生调班申请' AND record_id IN(SELECT node_instance_id FROM %s WHERE deleted=0 AND candidate_id=?))", query, schema.NodeInstanceTableName, schema.NodeCandidateTableName)
+		query = fmt.Sprintf("%[1]s AND fi.record_id IN(SELECT flow_instance_id FROM %[2]s WHERE deleted=0 AND status=1 AND %[3]s != '状态调整' AND %[4]s !='2' AND %[4]s !='3' AND %[3]s != '班干部学生状态修改' AND %[3]s != '学生调班申请' AND record_id IN(SELECT node_instance_id FROM %[5]s WHERE deleted=0 AND candidate_id=?))", query, schema.NodeInstanceTableName, title, status, schema.NodeCandidateTableName)
 	}
 	args = append(args, userID)
 
@@ -1106,7 +1345,7 @@ func (a *Flow) QueryTodoWebFlowInstanceResult(userID, typeCode, flowCode string,
 		args = append(args, flowCode)
 	}
 	//获取信息条数
-	tmpSql := `SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code 'flow_code',f.name 'flow_name'`
+	tmpSql := `SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code AS flow_code,f.name AS flow_name`
 	num := a.GetWebFlowNumber(tmpSql, query, args)
 
 	if v, ok := ParamSearchList["page"]; ok {
@@ -1129,23 +1368,24 @@ func (a *Flow) QueryTodoWebFlowInstanceResult(userID, typeCode, flowCode string,
 // QueryWebHandleFlowInstanceResult web查询处理的流程实例结果
 func (a *Flow) QueryWebHandleFlowInstanceResult(processor, typeCode, flowCode string, lastID int64, count int, ParamSearchList map[string]string) ([]*schema.FlowInstanceResult, int64, error) {
 	var (
-		args []interface{}
+		args  []interface{}
+		title = a.DB.JSONField("input_data", "title")
 	)
-	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code 'flow_code',f.name 'flow_name' FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0 AND f.record_id NOT IN (select flow_id from f_flow_range where user_type=0 or user_type=2) ", schema.FlowInstanceTableName, schema.FlowTableName)
+	query := fmt.Sprintf("SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code AS flow_code,f.name AS flow_name FROM %s fi LEFT JOIN %s f ON fi.flow_id=f.record_id AND f.deleted=0 WHERE fi.deleted=0 AND f.record_id NOT IN (select flow_id from f_flow_range where user_type=0 or user_type=2) ", schema.FlowInstanceTableName, schema.FlowTableName)
 	query = fmt.Sprintf("%s AND fi.launcher!=?", query)
 	args = append(args, processor)
 	if ParamSearchList != nil && len(ParamSearchList) > 0 {
-		tmpSql := ` AND input_data->'$.title' != '班干部学生状态修改' AND input_data->'$.title' != '学生调班申请' AND input_data->'$.title' != '状态调整' `
+		tmpSql := fmt.Sprintf(" AND %[1]s != '班干部学生状态修改' AND %[1]s != '学生调班申请' AND %[1]s != '状态调整' ", title)
 		for i, v := range ParamSearchList {
 			if i == "page" {
 				continue
 			}
-			tmpSql += ` AND input_data->'$.` + i + `' = ? `
+			tmpSql += fmt.Sprintf(" AND %s = ? ", a.DB.JSONField("input_data", i))
 			args = append(args, v)
 		}
 		query = fmt.Sprintf("%s AND fi.record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=2 %s AND processor=?)", query, schema.NodeInstanceTableName, tmpSql)
 	} else {
-		query = fmt.Sprintf("%s AND fi.record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=2   AND input_data->'$.title' != '状态调整'  AND  input_data->'$.title' != '班干部学生状态修改' AND input_data->'$.title' != '学生调班申请' AND processor=?)", query, schema.NodeInstanceTableName)
+		query = fmt.Sprintf("%[1]s AND fi.record_id IN(SELECT flow_instance_id FROM %[2]s WHERE deleted=0 AND status=2 AND %[3]s != '状态调整' AND %[3]s != '班干部学生状态修改' AND %[3]s != '学生调班申请' AND processor=?)", query, schema.NodeInstanceTableName, title)
 
 	}
 	args = append(args, processor)
@@ -1157,7 +1397,7 @@ func (a *Flow) QueryWebHandleFlowInstanceResult(processor, typeCode, flowCode st
 		query = fmt.Sprintf("%s AND f.code=?", query)
 		args = append(args, flowCode)
 	}
-	tmpSql := `SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code 'flow_code',f.name 'flow_name'`
+	tmpSql := `SELECT fi.id,fi.record_id,fi.flow_id,fi.status,fi.launcher,fi.launch_time,f.code AS flow_code,f.name AS flow_name`
 	//获取信息条数
 	num := a.GetWebFlowNumber(tmpSql, query, args)
 
@@ -1186,7 +1426,7 @@ func (a *Flow) QueryWebLastNodeInstances(flowInstanceIDs []string, ParamSearchLi
 	if isComplete {
 		tmpSQL = ` AND status=2 `
 	}
-	query = fmt.Sprintf("SELECT MAX(id)'id' FROM %s WHERE deleted=0 AND flow_instance_id IN(?) %s GROUP BY flow_instance_id", schema.NodeInstanceTableName, tmpSQL)
+	query = fmt.Sprintf("SELECT MAX(id) AS id FROM %s WHERE deleted=0 AND flow_instance_id IN(?) %s GROUP BY flow_instance_id", schema.NodeInstanceTableName, tmpSQL)
 
 	errMsg = "查询流程实例的最后一个节点实例发生错误"
 	query, args, err := a.DB.In(query, flowInstanceIDs)
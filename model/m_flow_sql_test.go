@@ -0,0 +1,264 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"flag"
+	"flow/register"
+	"flow/schema"
+	"flow/service/db"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "更新SQL快照文件")
+
+// 按方言检查Flow查询生成的SQL(与test_data/sql_<方言>.golden快照比较)，
+// 不需要连接MySQL/PostgreSQL即可发现方言相关的SQL变化
+func TestFlowSQLGolden(t *testing.T) {
+	for _, dialect := range []string{db.DialectMySQL, db.DialectSQLite, db.DialectPostgres} {
+		t.Run(dialect, func(t *testing.T) {
+			rec := &sqlRecorder{}
+			d, err := db.NewWithDB(sql.OpenDB(rec), dialect, false)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			register.FlowDBMap(d)
+
+			a := &Flow{DB: d}
+			var buf strings.Builder
+			for _, c := range flowSQLCases(a) {
+				rec.reset()
+				_ = c.fn()
+				fmt.Fprintf(&buf, "-- %s\n", c.name)
+				for _, q := range rec.queries() {
+					fmt.Fprintf(&buf, "%s;\n", q)
+				}
+				buf.WriteString("\n")
+			}
+
+			file := filepath.Join("test_data", fmt.Sprintf("sql_%s.golden", dialect))
+			if *updateGolden {
+				if err := ioutil.WriteFile(file, []byte(buf.String()), 0644); err != nil {
+					t.Fatal(err.Error())
+				}
+				return
+			}
+
+			expected, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if got := buf.String(); got != string(expected) {
+				t.Fatalf("生成的SQL与快照(%s)不一致，确认无误后使用 go test ./model -update 更新：\n%s", file, got)
+			}
+		})
+	}
+}
+
+type flowSQLCase struct {
+	name string
+	fn   func() error
+}
+
+func flowSQLCases(a *Flow) []flowSQLCase {
+	ctx := context.Background()
+	info := map[string]interface{}{"status": 2}
+	search := map[string]string{"title": "T001", "page": "2"}
+	params := schema.FlowQueryParam{Code: "F001", Name: "N001", TypeCode: "T001", Status: 1}
+
+	return []flowSQLCase{
+		{"Transaction", func() error {
+			return a.Transaction(ctx, func(ctx context.Context) error {
+				_, err := a.GetFlow(ctx, "F001")
+				return err
+			})
+		}},
+		{"CreateFlow", func() error {
+			return a.CreateFlow(ctx, &schema.Flow{RecordID: "F001"},
+				&schema.NodeOperating{NodeGroup: []*schema.Node{{RecordID: "N001"}}},
+				&schema.FormOperating{FormGroup: []*schema.Form{{RecordID: "FM001"}}})
+		}},
+		{"GetFlow", func() error { _, err := a.GetFlow(ctx, "F001"); return err }},
+		{"GetFlowByCode", func() error { _, err := a.GetFlowByCode(ctx, "C001"); return err }},
+		{"QueryFlowByCode", func() error { _, err := a.QueryFlowByCode("C001"); return err }},
+		{"GetNode", func() error { _, err := a.GetNode(ctx, "N001"); return err }},
+		{"GetNodeByCode", func() error { _, err := a.GetNodeByCode(ctx, "F001", "C001"); return err }},
+		{"GetFlowInstance", func() error { _, err := a.GetFlowInstance(ctx, "FI001"); return err }},
+		{"GetFlowInstanceByNode", func() error { _, err := a.GetFlowInstanceByNode(ctx, "NI001"); return err }},
+		{"GetNodeInstance", func() error { _, err := a.GetNodeInstance(ctx, "NI001"); return err }},
+		{"QueryNodeRouters", func() error { _, err := a.QueryNodeRouters(ctx, "N001"); return err }},
+		{"QueryNodeRoutersByTarget", func() error { _, err := a.QueryNodeRoutersByTarget(ctx, "N001"); return err }},
+		{"QueryNodeAssignments", func() error { _, err := a.QueryNodeAssignments(ctx, "N001"); return err }},
+		{"CreateNodeInstance", func() error {
+			return a.CreateNodeInstance(ctx, &schema.NodeInstance{RecordID: "NI001"},
+				[]*schema.NodeCandidate{{RecordID: "NC001"}})
+		}},
+		{"UpdateNodeInstance", func() error { return a.UpdateNodeInstance(ctx, "NI001", info) }},
+		{"UpdateNodeInstanceWithVersion", func() error { return a.UpdateNodeInstanceWithVersion(ctx, "NI001", 1, 1, info) }},
+		{"CheckFlowInstanceTodo", func() error { _, err := a.CheckFlowInstanceTodo(ctx, "FI001"); return err }},
+		{"QuerySubFlowInstances", func() error { _, err := a.QuerySubFlowInstances(ctx, "NI001"); return err }},
+		{"UpdateFlowInstance", func() error { return a.UpdateFlowInstance(ctx, "FI001", info) }},
+		{"UpdateFlowInstanceWithVersion", func() error { return a.UpdateFlowInstanceWithVersion(ctx, "FI001", 1, 1, info) }},
+		{"CreateFlowInstance", func() error {
+			return a.CreateFlowInstance(ctx, &schema.FlowInstance{RecordID: "FI001"}, &schema.NodeInstance{RecordID: "NI001"})
+		}},
+		{"QueryNodeCandidates", func() error { _, err := a.QueryNodeCandidates(ctx, "NI001"); return err }},
+		{"CheckNodeCandidate", func() error { _, err := a.CheckNodeCandidate(ctx, "NI001", "U001"); return err }},
+		{"QueryTodo", func() error { _, err := a.QueryTodo("T001", "", "U001", 10); return err }},
+		{"GetTodoByID", func() error { _, err := a.GetTodoByID("NI001"); return err }},
+		{"GetDoneByID", func() error { _, err := a.GetDoneByID("NI001"); return err }},
+		{"QueryDone", func() error { _, err := a.QueryDone("T001", "", "U001", 1, 10); return err }},
+		{"GetDoneCount", func() error { _, err := a.GetDoneCount("U001"); return err }},
+		{"DeleteFlow", func() error { return a.DeleteFlow("F001") }},
+		{"QueryHistory", func() error { _, err := a.QueryHistory("FI001"); return err }},
+		{"QueryDoneIDs", func() error { _, err := a.QueryDoneIDs("C001", "U001"); return err }},
+		{"QueryFlowIDsByType", func() error { _, err := a.QueryFlowIDsByType("T001", "T002"); return err }},
+		{"QueryFlowByIDs", func() error { _, err := a.QueryFlowByIDs([]string{"F001", "F002"}); return err }},
+		{"GetFlowFormByNodeID", func() error { _, err := a.GetFlowFormByNodeID("N001"); return err }},
+		{"QueryNodeByTypeCodeAndFlowIDs", func() error { _, err := a.QueryNodeByTypeCodeAndFlowIDs(ctx, "userTask", "F001", "F002"); return err }},
+		{"GetNodeByFlowAndTypeCode", func() error { _, err := a.GetNodeByFlowAndTypeCode(ctx, "F001", "startEvent"); return err }},
+		{"GetForm", func() error { _, err := a.GetForm("FM001"); return err }},
+		{"Update", func() error { return a.Update("F001", info) }},
+		{"QueryNodeProperty", func() error { _, err := a.QueryNodeProperty(ctx, "N001"); return err }},
+		{"QueryNodesByProperty", func() error { _, err := a.QueryNodesByProperty(ctx, "message_name", "M001"); return err }},
+		{"CreateNodeTiming", func() error { return a.CreateNodeTiming(ctx, &schema.NodeTiming{NodeInstanceID: "NI001"}) }},
+		{"UpdateNodeTiming", func() error { return a.UpdateNodeTiming(ctx, "NI001", info) }},
+		{"QueryExpiredNodeTiming", func() error { _, err := a.QueryExpiredNodeTiming(); return err }},
+		{"ClaimNodeTiming", func() error { _, err := a.ClaimNodeTiming(1, "O001", 1); return err }},
+		{"UpdateDeadNodeTiming", func() error { _, err := a.UpdateDeadNodeTiming(ctx, 1, info); return err }},
+		{"UpdateNodeTimingByID", func() error { return a.UpdateNodeTimingByID(ctx, 1, info) }},
+		{"UpdateClaimedNodeTiming", func() error { _, err := a.UpdateClaimedNodeTiming(ctx, 1, "O001", info); return err }},
+		{"QueryDeadNodeTiming", func() error { _, err := a.QueryDeadNodeTiming(); return err }},
+		{"CreateExternalTask", func() error { return a.CreateExternalTask(ctx, &schema.ExternalTask{RecordID: "E001"}) }},
+		{"GetExternalTask", func() error { _, err := a.GetExternalTask(ctx, "E001"); return err }},
+		{"QueryUnlockedExternalTask", func() error { _, err := a.QueryUnlockedExternalTask("topic", 10); return err }},
+		{"LockExternalTask", func() error { _, err := a.LockExternalTask("E001", "W001", 1); return err }},
+		{"UpdateExternalTask", func() error { return a.UpdateExternalTask(ctx, "E001", info) }},
+		{"QueryLaunchFlowInstanceResult", func() error { _, err := a.QueryLaunchFlowInstanceResult("U001", "T001", "", 1, 10); return err }},
+		{"QueryTodoFlowInstanceResult", func() error { _, err := a.QueryTodoFlowInstanceResult("U001", "T001", "", 1, 10); return err }},
+		{"QueryHandleFlowInstanceResult", func() error { _, err := a.QueryHandleFlowInstanceResult("U001", "T001", "", 1, 10); return err }},
+		{"QueryLastNodeInstances", func() error { _, err := a.QueryLastNodeInstances([]string{"FI001", "FI002"}); return err }},
+		{"QueryPendingNodeInstances", func() error { _, err := a.QueryPendingNodeInstances(ctx, "FI001"); return err }},
+		{"QueryLoopNodeInstances", func() error { _, err := a.QueryLoopNodeInstances(ctx, "L001"); return err }},
+		{"QueryPendingNodeInstancesByNode", func() error { _, err := a.QueryPendingNodeInstancesByNode(ctx, "N001"); return err }},
+		{"QueryLastNodeInstance", func() error { _, err := a.QueryLastNodeInstance("FI001"); return err }},
+		{"QueryAllFlowPage", func() error { _, _, err := a.QueryAllFlowPage(params, 2, 10); return err }},
+		{"QueryGroupFlowPage", func() error { _, _, err := a.QueryGroupFlowPage(params, 2, 10); return err }},
+		{"QueryFlowQueryResultByCodesAndVersions", func() error {
+			_, err := a.QueryFlowQueryResultByCodesAndVersions([]string{"C001", "C002"}, []int64{1, 2})
+			return err
+		}},
+		{"GetFlowQueryResultByCodeAndVersion", func() error { _, err := a.GetFlowQueryResultByCodeAndVersion("C001", 1); return err }},
+		{"QueryFlowVersion", func() error { _, err := a.QueryFlowVersion("C001"); return err }},
+		{"QueryTodoWebFlowInstanceResult", func() error {
+			_, _, err := a.QueryTodoWebFlowInstanceResult("U001", "T001,T002", "", 10, search)
+			return err
+		}},
+		{"QueryWebHandleFlowInstanceResult", func() error {
+			_, _, err := a.QueryWebHandleFlowInstanceResult("U001", "T001,T002", "", 1, 10, search)
+			return err
+		}},
+		{"QueryWebLastNodeInstances", func() error {
+			_, err := a.QueryWebLastNodeInstances([]string{"FI001", "FI002"}, search, true)
+			return err
+		}},
+	}
+}
+
+var (
+	spaceRegexp = regexp.MustCompile(`\s+`)
+	valueRegexp = regexp.MustCompile(`(?i)^select count\(|returning "id";?$`)
+)
+
+// sqlRecorder 记录执行SQL的数据库驱动(查询返回空结果，统计查询及插入返回的ID为1)
+type sqlRecorder struct {
+	lock  sync.Mutex
+	items []string
+}
+
+func (r *sqlRecorder) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.items = nil
+}
+
+func (r *sqlRecorder) record(query string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.items = append(r.items, strings.TrimSuffix(strings.TrimSpace(spaceRegexp.ReplaceAllString(query, " ")), ";"))
+}
+
+func (r *sqlRecorder) queries() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.items...)
+}
+
+func (r *sqlRecorder) Connect(context.Context) (driver.Conn, error) { return &recordConn{r}, nil }
+func (r *sqlRecorder) Driver() driver.Driver                        { return r }
+func (r *sqlRecorder) Open(string) (driver.Conn, error)             { return &recordConn{r}, nil }
+
+type recordConn struct {
+	r *sqlRecorder
+}
+
+func (c *recordConn) Prepare(query string) (driver.Stmt, error) { return &recordStmt{c.r, query}, nil }
+func (c *recordConn) Close() error                              { return nil }
+func (c *recordConn) Begin() (driver.Tx, error)                 { c.r.record("BEGIN"); return c, nil }
+func (c *recordConn) Commit() error                             { c.r.record("COMMIT"); return nil }
+func (c *recordConn) Rollback() error                           { c.r.record("ROLLBACK"); return nil }
+
+// CheckNamedValue 接受任意类型的参数
+func (c *recordConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type recordStmt struct {
+	r     *sqlRecorder
+	query string
+}
+
+func (s *recordStmt) Close() error  { return nil }
+func (s *recordStmt) NumInput() int { return -1 }
+
+func (s *recordStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.r.record(s.query)
+	return recordResult{}, nil
+}
+
+type recordResult struct{}
+
+func (recordResult) LastInsertId() (int64, error) { return 1, nil }
+func (recordResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s *recordStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.r.record(s.query)
+	if valueRegexp.MatchString(strings.TrimSpace(s.query)) {
+		return &recordRows{columns: []string{"count"}, values: []driver.Value{int64(1)}}, nil
+	}
+	return &recordRows{}, nil
+}
+
+type recordRows struct {
+	columns []string
+	values  []driver.Value
+}
+
+func (r *recordRows) Columns() []string { return r.columns }
+
+func (r *recordRows) Close() error { return nil }
+
+func (r *recordRows) Next(dest []driver.Value) error {
+	if r.values == nil {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.values = nil
+	return nil
+}
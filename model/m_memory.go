@@ -0,0 +1,1654 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flow/schema"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Memory 基于内存的流程存储(用于测试及嵌入式场景)
+type Memory struct {
+	sync.RWMutex
+	tx               sync.Mutex // 事务锁(事务之间及事务外的运行数据写入串行执行)
+	seq              int64
+	flows            []*schema.Flow
+	nodes            []*schema.Node
+	routers          []*schema.NodeRouter
+	assignments      []*schema.NodeAssignment
+	properties       []*schema.NodeProperty
+	flowInstances    []*schema.FlowInstance
+	nodeInstances    []*schema.NodeInstance
+	timings          []*schema.NodeTiming
+	externalTasks    []*schema.ExternalTask
+	candidates       []*schema.NodeCandidate
+	forms            []*schema.Form
+	formFields       []*schema.FormField
+	fieldOptions     []*schema.FieldOption
+	fieldProperties  []*schema.FieldProperty
+	fieldValidations []*schema.FieldValidation
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory 创建内存存储
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (a *Memory) nextID() int64 {
+	a.seq++
+	return a.seq
+}
+
+// 事务的回滚日志(记录事务中插入及修改的数据)
+type memoryUndoLog struct {
+	touched map[interface{}]bool
+	undo    []func()
+}
+
+// 获取上下文中事务的回滚日志(不在事务中时返回nil)
+func undoLog(ctx context.Context) *memoryUndoLog {
+	if v, ok := fromTransContext(ctx); ok {
+		log, _ := v.(*memoryUndoLog)
+		return log
+	}
+	return nil
+}
+
+// 记录修改前的数据(调用方持有写锁，同一数据只记录第一次修改前的值)
+func (l *memoryUndoLog) touch(item interface{}) {
+	if l == nil || l.touched[item] {
+		return
+	}
+	l.touched[item] = true
+
+	v := reflect.ValueOf(item).Elem()
+	old := reflect.New(v.Type()).Elem()
+	old.Set(v)
+	l.undo = append(l.undo, func() {
+		v.Set(old)
+	})
+}
+
+// 记录插入的数据，回滚时从数据列表中移除(调用方持有写锁)
+func (l *memoryUndoLog) insert(list, item interface{}) {
+	if l == nil {
+		return
+	}
+
+	l.undo = append(l.undo, func() {
+		v := reflect.ValueOf(list).Elem()
+		for i := 0; i < v.Len(); i++ {
+			if v.Index(i).Interface() == item {
+				v.Set(reflect.AppendSlice(v.Slice(0, i), v.Slice(i+1, v.Len())))
+				return
+			}
+		}
+	})
+}
+
+// 按相反顺序撤销事务中的写入(调用方持有写锁，自增ID不回退以免与事务外创建的数据重复)
+func (l *memoryUndoLog) rollback() {
+	for i := len(l.undo) - 1; i >= 0; i-- {
+		l.undo[i]()
+	}
+}
+
+// Transaction 在事务中执行(事务串行执行，出错时按回滚日志撤销事务中的写入)
+func (a *Memory) Transaction(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := fromTransContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	a.tx.Lock()
+	defer a.tx.Unlock()
+
+	log := &memoryUndoLog{touched: make(map[interface{}]bool)}
+	err := fn(newTransContext(ctx, log))
+	if err != nil {
+		a.Lock()
+		log.rollback()
+		a.Unlock()
+	}
+	return err
+}
+
+// 锁定运行数据的写入，返回解锁函数
+// 事务外的写入等待进行中的事务结束，避免事务回滚时覆盖其写入
+func (a *Memory) lockWrite(ctx context.Context) func() {
+	_, inTrans := fromTransContext(ctx)
+	if !inTrans {
+		a.tx.Lock()
+	}
+	a.Lock()
+
+	return func() {
+		a.Unlock()
+		if !inTrans {
+			a.tx.Unlock()
+		}
+	}
+}
+
+// 获取数据类型对应的数据列表
+func (a *Memory) table(item interface{}) interface{} {
+	switch item.(type) {
+	case *schema.Flow:
+		return &a.flows
+	case *schema.Node:
+		return &a.nodes
+	case *schema.NodeRouter:
+		return &a.routers
+	case *schema.NodeAssignment:
+		return &a.assignments
+	case *schema.NodeProperty:
+		return &a.properties
+	case *schema.FlowInstance:
+		return &a.flowInstances
+	case *schema.NodeInstance:
+		return &a.nodeInstances
+	case *schema.NodeTiming:
+		return &a.timings
+	case *schema.ExternalTask:
+		return &a.externalTasks
+	case *schema.NodeCandidate:
+		return &a.candidates
+	case *schema.Form:
+		return &a.forms
+	case *schema.FormField:
+		return &a.formFields
+	case *schema.FieldOption:
+		return &a.fieldOptions
+	case *schema.FieldProperty:
+		return &a.fieldProperties
+	case *schema.FieldValidation:
+		return &a.fieldValidations
+	}
+	return nil
+}
+
+// 插入数据(调用方持有写锁，在事务中时记录到回滚日志)
+func (a *Memory) insert(log *memoryUndoLog, items ...interface{}) error {
+	for _, item := range items {
+		list := a.table(item)
+		if list == nil {
+			return fmt.Errorf("不支持的数据类型：%T", item)
+		}
+
+		v := reflect.ValueOf(item).Elem()
+		v.FieldByName("ID").SetInt(a.nextID())
+		c := reflect.New(v.Type())
+		c.Elem().Set(v)
+
+		l := reflect.ValueOf(list).Elem()
+		l.Set(reflect.Append(l, c))
+		log.insert(list, c.Interface())
+	}
+	return nil
+}
+
+// 按db标签更新结构体字段
+func setFields(dst interface{}, info map[string]interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+
+	for key, val := range info {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("db"), ",")[0]
+			if name != key {
+				continue
+			}
+			found = true
+
+			fv := v.Field(i)
+			rv := reflect.ValueOf(val)
+			if !rv.IsValid() {
+				fv.Set(reflect.Zero(fv.Type()))
+				break
+			}
+			if !rv.Type().ConvertibleTo(fv.Type()) ||
+				(rv.Kind() == reflect.String) != (fv.Kind() == reflect.String) {
+				return fmt.Errorf("字段(%s)类型不匹配：%T", key, val)
+			}
+			fv.Set(rv.Convert(fv.Type()))
+			break
+		}
+		if !found {
+			return fmt.Errorf("未知的字段：%s", key)
+		}
+	}
+	return nil
+}
+
+func (a *Memory) getFlow(recordID string) *schema.Flow {
+	for _, item := range a.flows {
+		if item.Deleted == 0 && item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+func (a *Memory) getNode(recordID string) *schema.Node {
+	for _, item := range a.nodes {
+		if item.Deleted == 0 && item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+func (a *Memory) getForm(recordID string) *schema.Form {
+	for _, item := range a.forms {
+		if item.Deleted == 0 && item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+func (a *Memory) getFlowInstance(recordID string) *schema.FlowInstance {
+	for _, item := range a.flowInstances {
+		if item.Deleted == 0 && item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+func (a *Memory) getNodeInstance(recordID string) *schema.NodeInstance {
+	for _, item := range a.nodeInstances {
+		if item.Deleted == 0 && item.RecordID == recordID {
+			return item
+		}
+	}
+	return nil
+}
+
+// 检查是否是节点实例的候选人
+func (a *Memory) isCandidate(nodeInstanceID, userID string) bool {
+	for _, item := range a.candidates {
+		if item.Deleted == 0 && item.NodeInstanceID == nodeInstanceID && item.CandidateID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查流程是否匹配类型或编号(typeCode优先)
+func (a *Memory) matchFlow(flowID, typeCode, flowCode string) bool {
+	if typeCode == "" && flowCode == "" {
+		return true
+	}
+
+	for _, item := range a.flows {
+		if item.Deleted != 0 || item.Flag != 1 || item.RecordID != flowID {
+			continue
+		}
+		if typeCode != "" {
+			return item.TypeCode == typeCode
+		}
+		return item.Code == flowCode
+	}
+	return false
+}
+
+// 获取节点表单(类型、数据)
+func (a *Memory) nodeForm(node *schema.Node) (*string, *string) {
+	if node == nil || node.FormID == "" {
+		return nil, nil
+	}
+	form := a.getForm(node.FormID)
+	if form == nil {
+		return nil, nil
+	}
+	typeCode, data := form.TypeCode, form.Data
+	return &typeCode, &data
+}
+
+func (a *Memory) toTodoResult(ni *schema.NodeInstance, fi *schema.FlowInstance) *schema.FlowTodoResult {
+	item := &schema.FlowTodoResult{
+		RecordID:       ni.RecordID,
+		FlowInstanceID: ni.FlowInstanceID,
+		NodeID:         ni.NodeID,
+		InputData:      ni.InputData,
+		Launcher:       fi.Launcher,
+		LaunchTime:     fi.LaunchTime,
+	}
+
+	if n := a.getNode(ni.NodeID); n != nil {
+		item.NodeCode = n.Code
+		item.NodeName = n.Name
+		item.FormType, item.FormData = a.nodeForm(n)
+		if f := a.getFlow(n.FlowID); f != nil {
+			item.FlowName = f.Name
+		}
+	}
+	return item
+}
+
+func (a *Memory) toDoneResult(ni *schema.NodeInstance, fi *schema.FlowInstance, n *schema.Node) *schema.FlowDoneResult {
+	item := &schema.FlowDoneResult{
+		RecordID:       ni.RecordID,
+		FlowInstanceID: ni.FlowInstanceID,
+		OutData:        ni.OutData,
+		ProcessTime:    ni.ProcessTime,
+		FlowStatus:     fi.Status,
+		Launcher:       fi.Launcher,
+		LaunchTime:     fi.LaunchTime,
+		NodeID:         n.RecordID,
+		NodeName:       n.Name,
+	}
+	item.FormType, item.FormData = a.nodeForm(n)
+	if f := a.getFlow(n.FlowID); f != nil {
+		item.FlowName = f.Name
+	}
+	return item
+}
+
+func (a *Memory) toFlowQueryResult(item *schema.Flow) *schema.FlowQueryResult {
+	return &schema.FlowQueryResult{
+		ID:       item.ID,
+		RecordID: item.RecordID,
+		Code:     item.Code,
+		Name:     item.Name,
+		Version:  item.Version,
+		TypeCode: item.TypeCode,
+		Status:   item.Status,
+		Created:  item.Created,
+		Memo:     item.Memo,
+	}
+}
+
+func (a *Memory) toFlowInstanceResult(fi *schema.FlowInstance) *schema.FlowInstanceResult {
+	item := &schema.FlowInstanceResult{
+		ID:         fi.ID,
+		RecordID:   fi.RecordID,
+		FlowID:     fi.FlowID,
+		Status:     fi.Status,
+		Launcher:   fi.Launcher,
+		LaunchTime: fi.LaunchTime,
+	}
+	if f := a.getFlow(fi.FlowID); f != nil {
+		item.FlowCode = f.Code
+		item.FlowName = f.Name
+	}
+	return item
+}
+
+// 查询流程实例结果(按ID倒序)
+func (a *Memory) queryFlowInstanceResult(typeCode, flowCode string, lastID int64, count int, filter func(*schema.FlowInstance) bool) []*schema.FlowInstanceResult {
+	var typeCodes []string
+	if typeCode != "" {
+		typeCodes = strings.Split(typeCode, ",")
+	}
+
+	var items []*schema.FlowInstanceResult
+	for i := len(a.flowInstances) - 1; i >= 0; i-- {
+		fi := a.flowInstances[i]
+		if fi.Deleted != 0 || !filter(fi) {
+			continue
+		}
+		if lastID > 0 && fi.ID >= lastID {
+			continue
+		}
+
+		f := a.getFlow(fi.FlowID)
+		if len(typeCodes) > 0 {
+			if f == nil || !inStrings(typeCodes, f.TypeCode) {
+				continue
+			}
+		} else if flowCode != "" {
+			if f == nil || f.Code != flowCode {
+				continue
+			}
+		}
+
+		items = append(items, a.toFlowInstanceResult(fi))
+		if count > 0 && len(items) >= count {
+			break
+		}
+	}
+	return items
+}
+
+// 检查节点实例的输入数据是否匹配查询参数
+func matchInputData(inputData string, params map[string]string) bool {
+	if len(params) == 0 {
+		return true
+	}
+
+	var data map[string]interface{}
+	_ = json.Unmarshal([]byte(inputData), &data)
+	for key, val := range params {
+		if key == "page" {
+			continue
+		}
+		if fmt.Sprint(data[key]) != val {
+			return false
+		}
+	}
+	return true
+}
+
+// 获取分页参数中的页码
+func pageParam(params map[string]string) int {
+	if v, ok := params["page"]; ok && v != "" {
+		page, _ := strconv.Atoi(v)
+		return page
+	}
+	return 0
+}
+
+func inStrings(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateFlow 创建流程数据
+func (a *Memory) CreateFlow(ctx context.Context, flow *schema.Flow, nodes *schema.NodeOperating, forms *schema.FormOperating) error {
+	defer a.lockWrite(ctx)()
+
+	items := []interface{}{flow}
+	items = append(items, nodes.All()...)
+	items = append(items, forms.All()...)
+
+	err := a.insert(undoLog(ctx), items...)
+	if err != nil {
+		return errors.Wrapf(err, "插入流程数据发生错误")
+	}
+	return nil
+}
+
+// GetFlow 获取流程数据
+func (a *Memory) GetFlow(ctx context.Context, recordID string) (*schema.Flow, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	if item := a.getFlow(recordID); item != nil {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// GetFlowByCode 根据编号查询流程数据
+func (a *Memory) GetFlowByCode(ctx context.Context, code string) (*schema.Flow, error) {
+	items, err := a.QueryFlowByCode(code)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// QueryFlowByCode 根据流程编号查询流程数据
+func (a *Memory) QueryFlowByCode(flowCode string) ([]*schema.Flow, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.Flow
+	for _, item := range a.flows {
+		if item.Deleted == 0 && item.Flag == 1 && item.Status == 1 && item.Code == flowCode {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Version > items[j].Version
+	})
+	return items, nil
+}
+
+// QueryFlowIDsByType 根据类型查询流程ID列表
+func (a *Memory) QueryFlowIDsByType(typeCodes ...string) ([]string, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var ids []string
+	for _, item := range a.flows {
+		if item.Deleted == 0 && item.Flag == 1 && item.Status == 1 && inStrings(typeCodes, item.TypeCode) {
+			ids = append(ids, item.RecordID)
+		}
+	}
+	return ids, nil
+}
+
+// 查询每个流程编号的最大版本(按编号排序)
+func (a *Memory) queryMaxVersions(filter func(*schema.Flow) bool) []*schema.Flow {
+	versions := make(map[string]int64)
+	for _, item := range a.flows {
+		if item.Deleted != 0 || item.Flag != 1 || !filter(item) {
+			continue
+		}
+		if v, ok := versions[item.Code]; !ok || item.Version > v {
+			versions[item.Code] = item.Version
+		}
+	}
+
+	items := make([]*schema.Flow, 0, len(versions))
+	for code, version := range versions {
+		items = append(items, &schema.Flow{Code: code, Version: version})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Code < items[j].Code
+	})
+	return items
+}
+
+// 根据编号和版本获取流程
+func (a *Memory) getFlowByCodeAndVersion(code string, version int64) *schema.Flow {
+	for _, item := range a.flows {
+		if item.Deleted == 0 && item.Flag == 1 && item.Code == code && item.Version == version {
+			return item
+		}
+	}
+	return nil
+}
+
+// QueryFlowByIDs 根据流程ID查询流程数据
+func (a *Memory) QueryFlowByIDs(flowIDs []string) ([]*schema.FlowQueryResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	items := a.queryMaxVersions(func(item *schema.Flow) bool {
+		return item.Status == 1 && inStrings(flowIDs, item.RecordID)
+	})
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	result := make([]*schema.FlowQueryResult, len(items))
+	for i, item := range items {
+		if f := a.getFlowByCodeAndVersion(item.Code, item.Version); f != nil {
+			result[i] = a.toFlowQueryResult(f)
+		}
+	}
+	return result, nil
+}
+
+// QueryFlowVersion 查询流程版本数据
+func (a *Memory) QueryFlowVersion(code string) ([]*schema.FlowQueryResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.FlowQueryResult
+	for _, item := range a.flows {
+		if item.Deleted == 0 && item.Flag == 1 && item.Code == code {
+			items = append(items, a.toFlowQueryResult(item))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Version < items[j].Version
+	})
+	return items, nil
+}
+
+// 检查流程是否匹配查询参数
+func matchFlowQueryParam(item *schema.Flow, params schema.FlowQueryParam) bool {
+	if params.Code != "" && !strings.Contains(item.Code, params.Code) {
+		return false
+	}
+	if params.Name != "" && !strings.Contains(item.Name, params.Name) {
+		return false
+	}
+	if params.TypeCode != "" && item.TypeCode != params.TypeCode {
+		return false
+	}
+	if params.Status > 0 && item.Status != params.Status {
+		return false
+	}
+	return true
+}
+
+// QueryAllFlowPage 查询流程分页数据
+func (a *Memory) QueryAllFlowPage(params schema.FlowQueryParam, pageIndex, pageSize uint) (int64, []*schema.FlowQueryResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.FlowQueryResult
+	for i := len(a.flows) - 1; i >= 0; i-- {
+		item := a.flows[i]
+		if item.Deleted == 0 && item.Flag == 1 && matchFlowQueryParam(item, params) {
+			items = append(items, &schema.FlowQueryResult{
+				ID:       item.ID,
+				RecordID: item.RecordID,
+				Created:  item.Created,
+				Code:     item.Code,
+				Name:     item.Name,
+				Version:  item.Version,
+			})
+		}
+	}
+
+	total := int64(len(items))
+	if total == 0 {
+		return 0, nil, nil
+	}
+
+	if pageIndex > 0 && pageSize > 0 {
+		items = pageSlice(items, int((pageIndex-1)*pageSize), int(pageSize))
+	}
+	return total, items, nil
+}
+
+// 获取分页切片
+func pageSlice(items []*schema.FlowQueryResult, start, size int) []*schema.FlowQueryResult {
+	if start >= len(items) {
+		return nil
+	}
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// QueryGroupFlowPage 查询流程分组分页数据
+func (a *Memory) QueryGroupFlowPage(params schema.FlowQueryParam, pageIndex, pageSize uint) (int64, []*schema.FlowQueryResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	items := a.queryMaxVersions(func(item *schema.Flow) bool {
+		return matchFlowQueryParam(item, params)
+	})
+	if len(items) == 0 {
+		return 0, nil, nil
+	}
+
+	var result []*schema.FlowQueryResult
+	for _, item := range items {
+		if f := a.getFlowByCodeAndVersion(item.Code, item.Version); f != nil {
+			result = append(result, a.toFlowQueryResult(f))
+		}
+	}
+	if pageIndex > 0 && pageSize > 0 {
+		result = pageSlice(result, int((pageIndex-1)*pageSize), int(pageSize))
+	}
+	return int64(len(items)), result, nil
+}
+
+// Update 更新流程信息
+func (a *Memory) Update(recordID string, info map[string]interface{}) error {
+	a.Lock()
+	defer a.Unlock()
+
+	for _, item := range a.flows {
+		if item.RecordID == recordID {
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新流程信息发生错误")
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteFlow 删除流程
+func (a *Memory) DeleteFlow(flowID string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	deleted := time.Now().Unix()
+	nodeIDs := make(map[string]bool)
+	for _, item := range a.nodes {
+		if item.Deleted == 0 && item.FlowID == flowID {
+			nodeIDs[item.RecordID] = true
+		}
+	}
+
+	for _, item := range a.flows {
+		if item.Deleted == 0 && item.RecordID == flowID {
+			item.Deleted = deleted
+		}
+	}
+	for _, item := range a.routers {
+		if item.Deleted == 0 && nodeIDs[item.SourceNodeID] {
+			item.Deleted = deleted
+		}
+	}
+	for _, item := range a.assignments {
+		if item.Deleted == 0 && nodeIDs[item.NodeID] {
+			item.Deleted = deleted
+		}
+	}
+	for _, item := range a.properties {
+		if item.Deleted == 0 && nodeIDs[item.NodeID] {
+			item.Deleted = deleted
+		}
+	}
+	for _, item := range a.nodes {
+		if item.Deleted == 0 && nodeIDs[item.RecordID] {
+			item.Deleted = deleted
+		}
+	}
+	for _, item := range a.forms {
+		if item.Deleted == 0 && item.FlowID == flowID {
+			item.Deleted = deleted
+		}
+	}
+	return nil
+}
+
+// GetNode 获取流程节点
+func (a *Memory) GetNode(ctx context.Context, recordID string) (*schema.Node, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	if item := a.getNode(recordID); item != nil {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// GetNodeByCode 根据节点编号获取流程节点
+func (a *Memory) GetNodeByCode(ctx context.Context, flowID, nodeCode string) (*schema.Node, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var node *schema.Node
+	for _, item := range a.nodes {
+		if item.Deleted == 0 && item.FlowID == flowID && item.Code == nodeCode {
+			if node == nil || item.OrderNum < node.OrderNum {
+				node = item
+			}
+		}
+	}
+	if node == nil {
+		return nil, nil
+	}
+	c := *node
+	return &c, nil
+}
+
+// GetNodeByFlowAndTypeCode 根据流程ID和节点类型获取节点数据
+func (a *Memory) GetNodeByFlowAndTypeCode(ctx context.Context, flowID, typeCode string) (*schema.Node, error) {
+	items, err := a.QueryNodeByTypeCodeAndFlowIDs(ctx, typeCode, flowID)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// QueryNodeByTypeCodeAndFlowIDs 根据节点类型和流程ID列表查询节点数据
+func (a *Memory) QueryNodeByTypeCodeAndFlowIDs(ctx context.Context, typeCode string, flowIDs ...string) ([]*schema.Node, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.Node
+	for _, item := range a.nodes {
+		if item.Deleted == 0 && item.TypeCode == typeCode && inStrings(flowIDs, item.FlowID) {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryNodeProperty 查询节点属性
+func (a *Memory) QueryNodeProperty(ctx context.Context, nodeID string) ([]*schema.NodeProperty, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeProperty
+	for _, item := range a.properties {
+		if item.Deleted == 0 && item.NodeID == nodeID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryNodesByProperty 查询设定指定属性值的节点
+func (a *Memory) QueryNodesByProperty(ctx context.Context, name, value string) ([]*schema.Node, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.Node
+	for _, node := range a.nodes {
+		if node.Deleted != 0 {
+			continue
+		}
+		for _, item := range a.properties {
+			if item.Deleted == 0 && item.NodeID == node.RecordID && item.Name == name && item.Value == value {
+				c := *node
+				items = append(items, &c)
+				break
+			}
+		}
+	}
+	return items, nil
+}
+
+// QueryNodeAssignments 查询节点指派
+func (a *Memory) QueryNodeAssignments(ctx context.Context, nodeID string) ([]*schema.NodeAssignment, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeAssignment
+	for _, item := range a.assignments {
+		if item.Deleted == 0 && item.NodeID == nodeID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryNodeRouters 查询节点路由
+func (a *Memory) QueryNodeRouters(ctx context.Context, sourceNodeID string) ([]*schema.NodeRouter, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeRouter
+	for _, item := range a.routers {
+		if item.Deleted == 0 && item.SourceNodeID == sourceNodeID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryNodeRoutersByTarget 查询流入节点的路由
+func (a *Memory) QueryNodeRoutersByTarget(ctx context.Context, targetNodeID string) ([]*schema.NodeRouter, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeRouter
+	for _, item := range a.routers {
+		if item.Deleted == 0 && item.TargetNodeID == targetNodeID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// CreateFlowInstance 创建流程实例
+func (a *Memory) CreateFlowInstance(ctx context.Context, flowInstance *schema.FlowInstance, nodeInstances ...*schema.NodeInstance) error {
+	defer a.lockWrite(ctx)()
+
+	items := []interface{}{flowInstance}
+	for _, n := range nodeInstances {
+		items = append(items, n)
+	}
+
+	err := a.insert(undoLog(ctx), items...)
+	if err != nil {
+		return errors.Wrapf(err, "插入流程实例数据发生错误")
+	}
+	return nil
+}
+
+// GetFlowInstance 获取流程实例
+func (a *Memory) GetFlowInstance(ctx context.Context, recordID string) (*schema.FlowInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	if item := a.getFlowInstance(recordID); item != nil {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// GetFlowInstanceByNode 根据节点实例获取流程实例
+func (a *Memory) GetFlowInstanceByNode(ctx context.Context, nodeInstanceID string) (*schema.FlowInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	ni := a.getNodeInstance(nodeInstanceID)
+	if ni == nil {
+		return nil, nil
+	}
+	if item := a.getFlowInstance(ni.FlowInstanceID); item != nil {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// UpdateFlowInstance 更新流程实例信息
+func (a *Memory) UpdateFlowInstance(ctx context.Context, recordID string, info map[string]interface{}) error {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.flowInstances {
+		if item.RecordID == recordID {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新流程实例信息发生错误")
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateFlowInstanceWithVersion 按状态及版本号更新流程实例信息
+func (a *Memory) UpdateFlowInstanceWithVersion(ctx context.Context, recordID string, status, version int64, info map[string]interface{}) error {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.flowInstances {
+		if item.RecordID == recordID && item.Status == status && item.Version == version {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新流程实例信息发生错误")
+			}
+			item.Version = version + 1
+			return nil
+		}
+	}
+	return &ConflictError{Table: schema.FlowInstanceTableName, RecordID: recordID, Version: version}
+}
+
+// CheckFlowInstanceTodo 检查流程实例待办事项
+func (a *Memory) CheckFlowInstanceTodo(ctx context.Context, flowInstanceID string) (bool, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	for _, item := range a.nodeInstances {
+		if item.Deleted == 0 && item.Status == 1 && item.FlowInstanceID == flowInstanceID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// QuerySubFlowInstances 查询进行中的子流程实例
+func (a *Memory) QuerySubFlowInstances(ctx context.Context, parentID string) ([]*schema.FlowInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.FlowInstance
+	for _, item := range a.flowInstances {
+		if item.Deleted == 0 && item.Status == 1 && item.ParentID == parentID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryLaunchFlowInstanceResult 查询发起的流程实例数据
+func (a *Memory) QueryLaunchFlowInstanceResult(launcher, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.queryFlowInstanceResult(typeCode, flowCode, lastID, count, func(fi *schema.FlowInstance) bool {
+		return fi.Launcher == launcher
+	}), nil
+}
+
+// 检查流程实例是否含有指定用户的待办
+func (a *Memory) hasTodo(flowInstanceID, userID string) bool {
+	for _, ni := range a.nodeInstances {
+		if ni.Deleted == 0 && ni.Status == 1 && ni.FlowInstanceID == flowInstanceID && a.isCandidate(ni.RecordID, userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查流程实例是否含有指定用户处理的节点
+func (a *Memory) hasHandled(flowInstanceID, processor string, params map[string]string) bool {
+	for _, ni := range a.nodeInstances {
+		if ni.Deleted == 0 && ni.Status == 2 && ni.FlowInstanceID == flowInstanceID &&
+			ni.Processor == processor && matchInputData(ni.InputData, params) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryTodoFlowInstanceResult 查询待办的流程实例数据
+func (a *Memory) QueryTodoFlowInstanceResult(userID, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.queryFlowInstanceResult(typeCode, flowCode, lastID, count, func(fi *schema.FlowInstance) bool {
+		return fi.Status == 1 && a.hasTodo(fi.RecordID, userID)
+	}), nil
+}
+
+// QueryHandleFlowInstanceResult 查询处理的流程实例结果
+func (a *Memory) QueryHandleFlowInstanceResult(processor, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.queryFlowInstanceResult(typeCode, flowCode, lastID, count, func(fi *schema.FlowInstance) bool {
+		return fi.Launcher != processor && a.hasHandled(fi.RecordID, processor, nil)
+	}), nil
+}
+
+// 对流程实例结果分页
+func pageFlowInstanceResult(items []*schema.FlowInstanceResult, page, count int) []*schema.FlowInstanceResult {
+	if page <= 0 {
+		return items
+	}
+	start := (page - 1) * count
+	if start >= len(items) {
+		return nil
+	}
+	end := start + count
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// QueryTodoWebFlowInstanceResult web查询待办的流程实例数据
+// 查询参数按节点实例输入数据的字段进行等值匹配
+func (a *Memory) QueryTodoWebFlowInstanceResult(userID, typeCode, flowCode string, count int, ParamSearchList map[string]string) ([]*schema.FlowWebInstanceResult, int64, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	items := a.queryFlowInstanceResult(typeCode, flowCode, 0, 0, func(fi *schema.FlowInstance) bool {
+		if fi.Status != 1 {
+			return false
+		}
+		for _, ni := range a.nodeInstances {
+			if ni.Deleted == 0 && ni.Status == 1 && ni.FlowInstanceID == fi.RecordID &&
+				a.isCandidate(ni.RecordID, userID) && matchInputData(ni.InputData, ParamSearchList) {
+				return true
+			}
+		}
+		return false
+	})
+
+	num := int64(len(items))
+	items = pageFlowInstanceResult(items, pageParam(ParamSearchList), count)
+
+	result := make([]*schema.FlowWebInstanceResult, len(items))
+	for i, item := range items {
+		result[i] = &schema.FlowWebInstanceResult{FlowInstanceResult: *item}
+	}
+	return result, num, nil
+}
+
+// QueryWebHandleFlowInstanceResult web查询处理的流程实例结果
+// 查询参数按节点实例输入数据的字段进行等值匹配
+func (a *Memory) QueryWebHandleFlowInstanceResult(processor, typeCode, flowCode string, lastID int64, count int, ParamSearchList map[string]string) ([]*schema.FlowInstanceResult, int64, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	items := a.queryFlowInstanceResult(typeCode, flowCode, 0, 0, func(fi *schema.FlowInstance) bool {
+		return fi.Launcher != processor && a.hasHandled(fi.RecordID, processor, ParamSearchList)
+	})
+
+	num := int64(len(items))
+	return pageFlowInstanceResult(items, pageParam(ParamSearchList), count), num, nil
+}
+
+// CreateNodeInstance 创建流程节点实例
+func (a *Memory) CreateNodeInstance(ctx context.Context, nodeInstance *schema.NodeInstance, nodeCandidates []*schema.NodeCandidate) error {
+	defer a.lockWrite(ctx)()
+
+	items := []interface{}{nodeInstance}
+	for _, c := range nodeCandidates {
+		items = append(items, c)
+	}
+
+	err := a.insert(undoLog(ctx), items...)
+	if err != nil {
+		return errors.Wrapf(err, "插入流程节点实例数据发生错误")
+	}
+	return nil
+}
+
+// GetNodeInstance 获取流程节点实例
+func (a *Memory) GetNodeInstance(ctx context.Context, recordID string) (*schema.NodeInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	if item := a.getNodeInstance(recordID); item != nil {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// UpdateNodeInstance 更新节点实例信息
+func (a *Memory) UpdateNodeInstance(ctx context.Context, recordID string, info map[string]interface{}) error {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.nodeInstances {
+		if item.RecordID == recordID {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新节点实例信息发生错误")
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateNodeInstanceWithVersion 按状态及版本号更新节点实例信息
+func (a *Memory) UpdateNodeInstanceWithVersion(ctx context.Context, recordID string, status, version int64, info map[string]interface{}) error {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.nodeInstances {
+		if item.RecordID == recordID && item.Status == status && item.Version == version {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新节点实例信息发生错误")
+			}
+			item.Version = version + 1
+			return nil
+		}
+	}
+	return &ConflictError{Table: schema.NodeInstanceTableName, RecordID: recordID, Version: version}
+}
+
+// 查询流程实例的最后一个节点实例
+func (a *Memory) lastNodeInstance(flowInstanceID string, filter func(*schema.NodeInstance) bool) *schema.NodeInstance {
+	for i := len(a.nodeInstances) - 1; i >= 0; i-- {
+		item := a.nodeInstances[i]
+		if item.Deleted == 0 && item.FlowInstanceID == flowInstanceID && (filter == nil || filter(item)) {
+			c := *item
+			return &c
+		}
+	}
+	return nil
+}
+
+// QueryPendingNodeInstances 查询流程实例中待处理的节点实例
+func (a *Memory) QueryPendingNodeInstances(ctx context.Context, flowInstanceID string) ([]*schema.NodeInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeInstance
+	for _, item := range a.nodeInstances {
+		if item.Deleted == 0 && item.Status == 1 && item.FlowInstanceID == flowInstanceID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryLoopNodeInstances 查询同一次激活的多实例节点实例
+func (a *Memory) QueryLoopNodeInstances(ctx context.Context, loopID string) ([]*schema.NodeInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeInstance
+	for _, item := range a.nodeInstances {
+		if item.Deleted == 0 && item.LoopID == loopID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryPendingNodeInstancesByNode 查询节点的待处理节点实例
+func (a *Memory) QueryPendingNodeInstancesByNode(ctx context.Context, nodeID string) ([]*schema.NodeInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeInstance
+	for _, item := range a.nodeInstances {
+		if item.Deleted == 0 && item.Status == 1 && item.NodeID == nodeID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// QueryLastNodeInstance 查询节点实例
+func (a *Memory) QueryLastNodeInstance(flowInstanceID string) (*schema.NodeInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.lastNodeInstance(flowInstanceID, nil), nil
+}
+
+// QueryLastNodeInstances 查询流程实例的最后一个节点实例
+func (a *Memory) QueryLastNodeInstances(flowInstanceIDs []string) ([]*schema.NodeInstance, error) {
+	return a.QueryWebLastNodeInstances(flowInstanceIDs, nil, false)
+}
+
+// QueryWebLastNodeInstances web查询流程实例的最后一个节点实例
+func (a *Memory) QueryWebLastNodeInstances(flowInstanceIDs []string, ParamSearchList map[string]string, isComplete bool) ([]*schema.NodeInstance, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeInstance
+	for _, id := range flowInstanceIDs {
+		item := a.lastNodeInstance(id, func(ni *schema.NodeInstance) bool {
+			return !isComplete || ni.Status == 2
+		})
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// QueryTodo 查询用户的待办数据
+func (a *Memory) QueryTodo(typeCode, flowCode, userID string, count int) ([]*schema.FlowTodoResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.FlowTodoResult
+	for i := len(a.nodeInstances) - 1; i >= 0 && len(items) < count; i-- {
+		ni := a.nodeInstances[i]
+		if ni.Deleted != 0 || ni.Status != 1 || !a.isCandidate(ni.RecordID, userID) {
+			continue
+		}
+
+		fi := a.getFlowInstance(ni.FlowInstanceID)
+		if fi == nil || fi.Status != 1 || !a.matchFlow(fi.FlowID, typeCode, flowCode) {
+			continue
+		}
+
+		items = append(items, a.toTodoResult(ni, fi))
+	}
+	return items, nil
+}
+
+// GetTodoByID 根据ID获取待办
+func (a *Memory) GetTodoByID(nodeInstanceID string) (*schema.FlowTodoResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	ni := a.getNodeInstance(nodeInstanceID)
+	if ni != nil && ni.Status == 1 {
+		if fi := a.getFlowInstance(ni.FlowInstanceID); fi != nil && fi.Status == 1 {
+			return a.toTodoResult(ni, fi), nil
+		}
+	}
+	return nil, errors.Wrapf(sql.ErrNoRows, "根据ID获取待办发生错误")
+}
+
+// 获取已办节点实例(人工任务)的关联数据
+func (a *Memory) getDone(ni *schema.NodeInstance) (*schema.FlowInstance, *schema.Node) {
+	if ni.Deleted != 0 || ni.Status != 2 {
+		return nil, nil
+	}
+
+	fi := a.getFlowInstance(ni.FlowInstanceID)
+	n := a.getNode(ni.NodeID)
+	if fi == nil || n == nil || n.TypeCode != "userTask" {
+		return nil, nil
+	}
+	return fi, n
+}
+
+// QueryDone 查询用户的已办数据
+func (a *Memory) QueryDone(typeCode, flowCode, userID string, lastTime int64, count int) ([]*schema.FlowDoneResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.FlowDoneResult
+	for _, ni := range a.nodeInstances {
+		if ni.Processor != userID || (lastTime > 0 && ni.ProcessTime >= lastTime) {
+			continue
+		}
+
+		fi, n := a.getDone(ni)
+		if fi == nil || !a.matchFlow(fi.FlowID, typeCode, flowCode) {
+			continue
+		}
+		items = append(items, a.toDoneResult(ni, fi, n))
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].ProcessTime > items[j].ProcessTime
+	})
+	if len(items) > count {
+		items = items[:count]
+	}
+	return items, nil
+}
+
+// GetDoneByID 根据ID获取已办
+func (a *Memory) GetDoneByID(nodeInstanceID string) (*schema.FlowDoneResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	if ni := a.getNodeInstance(nodeInstanceID); ni != nil {
+		if fi, n := a.getDone(ni); fi != nil {
+			return a.toDoneResult(ni, fi, n), nil
+		}
+	}
+	return nil, errors.Wrapf(sql.ErrNoRows, "根据ID获取已办发生错误")
+}
+
+// GetDoneCount 获取已办数量
+func (a *Memory) GetDoneCount(userID string) (int64, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var n int64
+	for _, item := range a.nodeInstances {
+		if item.Deleted == 0 && item.Status == 2 && item.Processor == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// QueryDoneIDs 查询已办理的流程实例ID列表
+func (a *Memory) QueryDoneIDs(flowCode, userID string) ([]string, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	ids := make([]string, 0)
+	for _, fi := range a.flowInstances {
+		if fi.Deleted == 0 && a.matchFlow(fi.FlowID, "", flowCode) && a.hasHandled(fi.RecordID, userID, nil) {
+			ids = append(ids, fi.RecordID)
+		}
+	}
+	return ids, nil
+}
+
+// QueryHistory 查询流程实例历史数据
+func (a *Memory) QueryHistory(flowInstanceID string) ([]*schema.FlowHistoryResult, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.FlowHistoryResult
+	for _, ni := range a.nodeInstances {
+		if ni.Deleted != 0 || ni.FlowInstanceID != flowInstanceID {
+			continue
+		}
+
+		n := a.getNode(ni.NodeID)
+		if n == nil || n.TypeCode != "userTask" {
+			continue
+		}
+
+		item := &schema.FlowHistoryResult{
+			RecordID:    ni.RecordID,
+			Processor:   ni.Processor,
+			ProcessTime: ni.ProcessTime,
+			InputData:   ni.InputData,
+			OutData:     ni.OutData,
+			Status:      ni.Status,
+			NodeID:      n.RecordID,
+			NodeCode:    n.Code,
+			NodeName:    n.Name,
+		}
+		item.FormType, item.FormData = a.nodeForm(n)
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Status != items[j].Status {
+			return items[i].Status > items[j].Status
+		}
+		return items[i].ProcessTime < items[j].ProcessTime
+	})
+	return items, nil
+}
+
+// QueryNodeCandidates 查询节点候选人
+func (a *Memory) QueryNodeCandidates(ctx context.Context, nodeInstanceID string) ([]*schema.NodeCandidate, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeCandidate
+	for _, item := range a.candidates {
+		if item.Deleted == 0 && item.NodeInstanceID == nodeInstanceID {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// CheckNodeCandidate 检查节点候选人
+func (a *Memory) CheckNodeCandidate(ctx context.Context, nodeInstanceID, userID string) (bool, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.isCandidate(nodeInstanceID, userID), nil
+}
+
+// CreateNodeTiming 创建定时节点
+func (a *Memory) CreateNodeTiming(ctx context.Context, item *schema.NodeTiming) error {
+	defer a.lockWrite(ctx)()
+
+	err := a.insert(undoLog(ctx), item)
+	if err != nil {
+		return errors.Wrapf(err, "创建节点定时发生错误")
+	}
+	return nil
+}
+
+// UpdateNodeTiming 更新定时节点
+func (a *Memory) UpdateNodeTiming(ctx context.Context, nodeInstanceID string, info map[string]interface{}) error {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.timings {
+		if item.NodeInstanceID == nodeInstanceID {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新节点定时发生错误")
+			}
+		}
+	}
+	return nil
+}
+
+// QueryExpiredNodeTiming 查询到期的定时节点
+func (a *Memory) QueryExpiredNodeTiming() ([]*schema.NodeTiming, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	now := time.Now().Unix()
+	var items []*schema.NodeTiming
+	for _, item := range a.timings {
+		if item.Deleted == 0 && item.Status == 0 && item.ExpiredAt < now && item.LeaseUntil < now {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].ExpiredAt < items[j].ExpiredAt
+	})
+	return items, nil
+}
+
+// ClaimNodeTiming 领取定时节点的租约
+func (a *Memory) ClaimNodeTiming(id int64, owner string, leaseUntil int64) (bool, error) {
+	defer a.lockWrite(context.Background())()
+
+	now := time.Now().Unix()
+	for _, item := range a.timings {
+		if item.ID == id && item.Deleted == 0 && item.Status == 0 && item.LeaseUntil < now {
+			item.Owner = owner
+			item.LeaseUntil = leaseUntil
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpdateNodeTimingByID 根据ID更新定时节点
+func (a *Memory) UpdateNodeTimingByID(ctx context.Context, id int64, info map[string]interface{}) error {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.timings {
+		if item.ID == id {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新节点定时发生错误")
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateClaimedNodeTiming 更新仍由owner持有租约的定时节点，返回是否更新(租约已过期或被其他引擎实例领取时不更新)
+func (a *Memory) UpdateClaimedNodeTiming(ctx context.Context, id int64, owner string, info map[string]interface{}) (bool, error) {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	now := time.Now().Unix()
+	for _, item := range a.timings {
+		if item.ID == id && item.Deleted == 0 && item.Owner == owner && item.LeaseUntil >= now {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return false, errors.Wrapf(err, "更新节点定时发生错误")
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpdateDeadNodeTiming 更新死信状态的定时节点，返回是否更新(定时不存在、已删除或不是死信时不更新)
+func (a *Memory) UpdateDeadNodeTiming(ctx context.Context, id int64, info map[string]interface{}) (bool, error) {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.timings {
+		if item.ID == id && item.Deleted == 0 && item.Status == 1 {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return false, errors.Wrapf(err, "更新死信节点定时发生错误")
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// QueryDeadNodeTiming 查询死信状态的定时节点
+func (a *Memory) QueryDeadNodeTiming() ([]*schema.NodeTiming, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var items []*schema.NodeTiming
+	for _, item := range a.timings {
+		if item.Deleted == 0 && item.Status == 1 {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	return items, nil
+}
+
+// CreateExternalTask 创建外部任务
+func (a *Memory) CreateExternalTask(ctx context.Context, item *schema.ExternalTask) error {
+	defer a.lockWrite(ctx)()
+
+	err := a.insert(undoLog(ctx), item)
+	if err != nil {
+		return errors.Wrapf(err, "创建外部任务发生错误")
+	}
+	return nil
+}
+
+// GetExternalTask 获取外部任务
+func (a *Memory) GetExternalTask(ctx context.Context, recordID string) (*schema.ExternalTask, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	for _, item := range a.externalTasks {
+		if item.Deleted == 0 && item.RecordID == recordID {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+// QueryUnlockedExternalTask 查询主题下待执行且未锁定的外部任务
+func (a *Memory) QueryUnlockedExternalTask(topic string, count int) ([]*schema.ExternalTask, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	now := time.Now().Unix()
+	var items []*schema.ExternalTask
+	for _, item := range a.externalTasks {
+		if item.Deleted == 0 && item.Status == 0 && item.Topic == topic && item.LockUntil < now {
+			c := *item
+			items = append(items, &c)
+			if len(items) == count {
+				break
+			}
+		}
+	}
+	return items, nil
+}
+
+// LockExternalTask 锁定外部任务(任务已被锁定时返回false)
+func (a *Memory) LockExternalTask(recordID, workerID string, lockUntil int64) (bool, error) {
+	defer a.lockWrite(context.Background())()
+
+	now := time.Now().Unix()
+	for _, item := range a.externalTasks {
+		if item.RecordID == recordID && item.Deleted == 0 && item.Status == 0 && item.LockUntil < now {
+			item.WorkerID = workerID
+			item.LockUntil = lockUntil
+			item.Updated = now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpdateExternalTask 更新外部任务
+func (a *Memory) UpdateExternalTask(ctx context.Context, recordID string, info map[string]interface{}) error {
+	defer a.lockWrite(ctx)()
+	log := undoLog(ctx)
+
+	for _, item := range a.externalTasks {
+		if item.RecordID == recordID {
+			log.touch(item)
+			if err := setFields(item, info); err != nil {
+				return errors.Wrapf(err, "更新外部任务发生错误")
+			}
+		}
+	}
+	return nil
+}
+
+// GetForm 获取流程表单
+func (a *Memory) GetForm(formID string) (*schema.Form, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	if item := a.getForm(formID); item != nil {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// GetFlowFormByNodeID 获取流程节点表单
+func (a *Memory) GetFlowFormByNodeID(nodeID string) (*schema.Form, error) {
+	node, err := a.GetNode(context.Background(), nodeID)
+	if err != nil {
+		return nil, err
+	} else if node == nil || node.FormID == "" {
+		return nil, nil
+	}
+
+	return a.GetForm(node.FormID)
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"flow/schema"
+	"testing"
+	"time"
+)
+
+func TestMemoryUpdateNodeInstance(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	err := m.CreateNodeInstance(ctx, &schema.NodeInstance{RecordID: "N001", Status: 1}, []*schema.NodeCandidate{
+		{RecordID: "C001", NodeInstanceID: "N001", CandidateID: "U001"},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = m.UpdateNodeInstance(ctx, "N001", map[string]interface{}{
+		"processor": "U001",
+		"status":    2,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	item, err := m.GetNodeInstance(ctx, "N001")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if item.Processor != "U001" || item.Status != 2 {
+		t.Fatalf("无效的节点实例：%+v", item)
+	}
+
+	err = m.UpdateNodeInstance(ctx, "N001", map[string]interface{}{"status": "2"})
+	if err == nil {
+		t.Fatal("期望类型不匹配错误")
+	}
+}
+
+func TestMemoryQueryExpiredNodeTiming(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	for _, item := range []*schema.NodeTiming{
+		{NodeInstanceID: "N002", ExpiredAt: now - 10},
+		{NodeInstanceID: "N001", ExpiredAt: now - 20},
+		{NodeInstanceID: "N003", ExpiredAt: now + 60},
+	} {
+		if err := m.CreateNodeTiming(ctx, item); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	err := m.UpdateNodeTiming(ctx, "N002", map[string]interface{}{"deleted": now})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	items, err := m.QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 1 || items[0].NodeInstanceID != "N001" {
+		t.Fatalf("无效的定时数据：%+v", items)
+	}
+}
+
+func TestMemoryUpdateNodeInstanceWithVersion(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	err := m.CreateNodeInstance(ctx, &schema.NodeInstance{RecordID: "N001", Status: 1}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = m.UpdateNodeInstanceWithVersion(ctx, "N001", 1, 0, map[string]interface{}{"status": 2})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	item, err := m.GetNodeInstance(ctx, "N001")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if item.Status != 2 || item.Version != 1 {
+		t.Fatalf("无效的节点实例：%+v", item)
+	}
+
+	err = m.UpdateNodeInstanceWithVersion(ctx, "N001", 1, 0, map[string]interface{}{"status": 2})
+	if !IsConflict(err) {
+		t.Fatalf("期望并发更新冲突错误：%v", err)
+	}
+}
+
+func TestMemoryClaimNodeTiming(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	item := &schema.NodeTiming{NodeInstanceID: "N001", ExpiredAt: now - 10}
+	if err := m.CreateNodeTiming(ctx, item); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ok, err := m.ClaimNodeTiming(item.ID, "E001", now+60)
+	if err != nil || !ok {
+		t.Fatalf("领取定时失败：%v", err)
+	}
+
+	ok, err = m.ClaimNodeTiming(item.ID, "E002", now+60)
+	if err != nil || ok {
+		t.Fatalf("租约期内不应被再次领取：%v", err)
+	}
+
+	items, err := m.QueryExpiredNodeTiming()
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(items) != 0 {
+		t.Fatalf("租约期内的定时不应被查询：%+v", items)
+	}
+
+	// 租约到期后可被其他引擎实例重新领取
+	m.timings[0].LeaseUntil = now - 1
+	ok, err = m.ClaimNodeTiming(item.ID, "E002", now+60)
+	if err != nil || !ok {
+		t.Fatalf("租约到期后领取定时失败：%v", err)
+	}
+
+	// 已转为死信的定时不能被领取
+	m.timings[0].LeaseUntil, m.timings[0].Status = now-1, 1
+	ok, err = m.ClaimNodeTiming(item.ID, "E003", now+60)
+	if err != nil || ok {
+		t.Fatalf("死信定时不应被领取：%v", err)
+	}
+}
+
+func TestMemoryTransactionKeepsConcurrentWrites(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	// 事务执行期间其他协程的写入等待事务结束，事务回滚不覆盖其写入
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		<-started
+		done <- m.CreateNodeInstance(ctx, &schema.NodeInstance{RecordID: "N002", Status: 1}, nil)
+	}()
+
+	err := m.Transaction(ctx, func(ctx context.Context) error {
+		if err := m.CreateNodeInstance(ctx, &schema.NodeInstance{RecordID: "N001", Status: 1}, nil); err != nil {
+			return err
+		}
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		return errors.New("回滚")
+	})
+	if err == nil {
+		t.Fatal("期望事务错误")
+	} else if err = <-done; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if item, _ := m.GetNodeInstance(ctx, "N001"); item != nil {
+		t.Fatalf("事务中的写入应已回滚：%+v", item)
+	}
+	if item, _ := m.GetNodeInstance(ctx, "N002"); item == nil {
+		t.Fatal("事务外的写入不应被回滚覆盖")
+	}
+}
+
+func TestMemoryTransactionRollback(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	err := m.CreateNodeInstance(ctx, &schema.NodeInstance{RecordID: "N001", Status: 1}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// 事务中创建的流程、节点实例及修改的数据在回滚后恢复
+	err = m.Transaction(ctx, func(ctx context.Context) error {
+		nodes := &schema.NodeOperating{NodeGroup: []*schema.Node{{RecordID: "D001", FlowID: "F001", Code: "node_start"}}}
+		if err := m.CreateFlow(ctx, &schema.Flow{RecordID: "F001", Flag: 1}, nodes, &schema.FormOperating{}); err != nil {
+			return err
+		}
+		if err := m.CreateNodeInstance(ctx, &schema.NodeInstance{RecordID: "N002", Status: 1}, nil); err != nil {
+			return err
+		}
+		for _, status := range []int{2, 3} {
+			if err := m.UpdateNodeInstance(ctx, "N001", map[string]interface{}{"status": status}); err != nil {
+				return err
+			}
+		}
+		return errors.New("回滚")
+	})
+	if err == nil {
+		t.Fatal("期望事务错误")
+	}
+
+	if item, _ := m.GetFlow(ctx, "F001"); item != nil {
+		t.Fatalf("事务中创建的流程应已回滚：%+v", item)
+	} else if item, _ := m.GetNodeByCode(ctx, "F001", "node_start"); item != nil {
+		t.Fatalf("事务中创建的节点应已回滚：%+v", item)
+	} else if item, _ := m.GetNodeInstance(ctx, "N002"); item != nil {
+		t.Fatalf("事务中创建的节点实例应已回滚：%+v", item)
+	} else if item, _ := m.GetNodeInstance(ctx, "N001"); item == nil || item.Status != 1 {
+		t.Fatalf("事务中修改的节点实例应已恢复：%+v", item)
+	}
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"context"
+	"flow/schema"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ConflictError 并发更新冲突(数据的状态或版本号已被其他处理修改)
+type ConflictError struct {
+	Table    string // 表名
+	RecordID string // 记录内码
+	Version  int64  // 更新时使用的版本号
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("数据(%s:%s)已被其他处理更新，版本号%d已失效", e.Table, e.RecordID, e.Version)
+}
+
+// IsConflict 检查是否为并发更新冲突错误
+func IsConflict(err error) bool {
+	_, ok := errors.Cause(err).(*ConflictError)
+	return ok
+}
+
+// Store 流程存储接口
+// 流程业务(bll.Flow)通过该接口访问持久化数据，默认实现为基于gorp的Flow
+// 带有context参数的方法参与流程流转，在Transaction的上下文中调用时使用同一事务
+type Store interface {
+	// 事务(上下文中已存在事务时直接复用)
+	Transaction(ctx context.Context, fn func(context.Context) error) error
+
+	// 流程
+	CreateFlow(ctx context.Context, flow *schema.Flow, nodes *schema.NodeOperating, forms *schema.FormOperating) error
+	GetFlow(ctx context.Context, recordID string) (*schema.Flow, error)
+	GetFlowByCode(ctx context.Context, code string) (*schema.Flow, error)
+	QueryFlowByCode(flowCode string) ([]*schema.Flow, error)
+	QueryFlowIDsByType(typeCodes ...string) ([]string, error)
+	QueryFlowByIDs(flowIDs []string) ([]*schema.FlowQueryResult, error)
+	QueryFlowVersion(code string) ([]*schema.FlowQueryResult, error)
+	QueryAllFlowPage(params schema.FlowQueryParam, pageIndex, pageSize uint) (int64, []*schema.FlowQueryResult, error)
+	QueryGroupFlowPage(params schema.FlowQueryParam, pageIndex, pageSize uint) (int64, []*schema.FlowQueryResult, error)
+	Update(recordID string, info map[string]interface{}) error
+	DeleteFlow(flowID string) error
+
+	// 节点
+	GetNode(ctx context.Context, recordID string) (*schema.Node, error)
+	GetNodeByCode(ctx context.Context, flowID, nodeCode string) (*schema.Node, error)
+	GetNodeByFlowAndTypeCode(ctx context.Context, flowID, typeCode string) (*schema.Node, error)
+	QueryNodeByTypeCodeAndFlowIDs(ctx context.Context, typeCode string, flowIDs ...string) ([]*schema.Node, error)
+	QueryNodeProperty(ctx context.Context, nodeID string) ([]*schema.NodeProperty, error)
+	QueryNodesByProperty(ctx context.Context, name, value string) ([]*schema.Node, error)
+	QueryNodeAssignments(ctx context.Context, nodeID string) ([]*schema.NodeAssignment, error)
+
+	// 节点路由
+	QueryNodeRouters(ctx context.Context, sourceNodeID string) ([]*schema.NodeRouter, error)
+	QueryNodeRoutersByTarget(ctx context.Context, targetNodeID string) ([]*schema.NodeRouter, error)
+
+	// 流程实例
+	CreateFlowInstance(ctx context.Context, flowInstance *schema.FlowInstance, nodeInstances ...*schema.NodeInstance) error
+	GetFlowInstance(ctx context.Context, recordID string) (*schema.FlowInstance, error)
+	GetFlowInstanceByNode(ctx context.Context, nodeInstanceID string) (*schema.FlowInstance, error)
+	UpdateFlowInstance(ctx context.Context, recordID string, info map[string]interface{}) error
+	UpdateFlowInstanceWithVersion(ctx context.Context, recordID string, status, version int64, info map[string]interface{}) error
+	CheckFlowInstanceTodo(ctx context.Context, flowInstanceID string) (bool, error)
+	QuerySubFlowInstances(ctx context.Context, parentID string) ([]*schema.FlowInstance, error)
+	QueryLaunchFlowInstanceResult(launcher, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error)
+	QueryTodoFlowInstanceResult(userID, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error)
+	QueryHandleFlowInstanceResult(processor, typeCode, flowCode string, lastID int64, count int) ([]*schema.FlowInstanceResult, error)
+	QueryTodoWebFlowInstanceResult(userID, typeCode, flowCode string, count int, ParamSearchList map[string]string) ([]*schema.FlowWebInstanceResult, int64, error)
+	QueryWebHandleFlowInstanceResult(processor, typeCode, flowCode string, lastID int64, count int, ParamSearchList map[string]string) ([]*schema.FlowInstanceResult, int64, error)
+
+	// 节点实例
+	CreateNodeInstance(ctx context.Context, nodeInstance *schema.NodeInstance, nodeCandidates []*schema.NodeCandidate) error
+	GetNodeInstance(ctx context.Context, recordID string) (*schema.NodeInstance, error)
+	UpdateNodeInstance(ctx context.Context, recordID string, info map[string]interface{}) error
+	UpdateNodeInstanceWithVersion(ctx context.Context, recordID string, status, version int64, info map[string]interface{}) error
+	QueryPendingNodeInstances(ctx context.Context, flowInstanceID string) ([]*schema.NodeInstance, error)
+	QueryLoopNodeInstances(ctx context.Context, loopID string) ([]*schema.NodeInstance, error)
+	QueryPendingNodeInstancesByNode(ctx context.Context, nodeID string) ([]*schema.NodeInstance, error)
+	QueryLastNodeInstance(flowInstanceID string) (*schema.NodeInstance, error)
+	QueryLastNodeInstances(flowInstanceIDs []string) ([]*schema.NodeInstance, error)
+	QueryWebLastNodeInstances(flowInstanceIDs []string, ParamSearchList map[string]string, isComplete bool) ([]*schema.NodeInstance, error)
+	QueryTodo(typeCode, flowCode, userID string, count int) ([]*schema.FlowTodoResult, error)
+	GetTodoByID(nodeInstanceID string) (*schema.FlowTodoResult, error)
+	QueryDone(typeCode, flowCode, userID string, lastTime int64, count int) ([]*schema.FlowDoneResult, error)
+	GetDoneByID(nodeInstanceID string) (*schema.FlowDoneResult, error)
+	GetDoneCount(userID string) (int64, error)
+	QueryDoneIDs(flowCode, userID string) ([]string, error)
+	QueryHistory(flowInstanceID string) ([]*schema.FlowHistoryResult, error)
+
+	// 节点候选人
+	QueryNodeCandidates(ctx context.Context, nodeInstanceID string) ([]*schema.NodeCandidate, error)
+	CheckNodeCandidate(ctx context.Context, nodeInstanceID, userID string) (bool, error)
+
+	// 节点定时
+	CreateNodeTiming(ctx context.Context, item *schema.NodeTiming) error
+	UpdateNodeTiming(ctx context.Context, nodeInstanceID string, info map[string]interface{}) error
+	QueryExpiredNodeTiming() ([]*schema.NodeTiming, error)
+	ClaimNodeTiming(id int64, owner string, leaseUntil int64) (bool, error)
+	UpdateNodeTimingByID(ctx context.Context, id int64, info map[string]interface{}) error
+	UpdateClaimedNodeTiming(ctx context.Context, id int64, owner string, info map[string]interface{}) (bool, error)
+	UpdateDeadNodeTiming(ctx context.Context, id int64, info map[string]interface{}) (bool, error)
+	QueryDeadNodeTiming() ([]*schema.NodeTiming, error)
+
+	// 外部任务
+	CreateExternalTask(ctx context.Context, item *schema.ExternalTask) error
+	GetExternalTask(ctx context.Context, recordID string) (*schema.ExternalTask, error)
+	QueryUnlockedExternalTask(topic string, count int) ([]*schema.ExternalTask, error)
+	LockExternalTask(recordID, workerID string, lockUntil int64) (bool, error)
+	UpdateExternalTask(ctx context.Context, recordID string, info map[string]interface{}) error
+
+	// 表单
+	GetForm(formID string) (*schema.Form, error)
+	GetFlowFormByNodeID(nodeID string) (*schema.Form, error)
+}
+
+var _ Store = (*Flow)(nil)
+
+type transKey struct{}
+
+// 创建事务的上下文值
+func newTransContext(ctx context.Context, trans interface{}) context.Context {
+	return context.WithValue(ctx, transKey{}, trans)
+}
+
+// InTransaction 检查上下文中是否已存在事务
+func InTransaction(ctx context.Context) bool {
+	_, ok := fromTransContext(ctx)
+	return ok
+}
+
+// 获取事务的上下文
+func fromTransContext(ctx context.Context) (interface{}, bool) {
+	trans := ctx.Value(transKey{})
+	return trans, trans != nil
+}
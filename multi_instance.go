@@ -0,0 +1,165 @@
+package flow
+
+import (
+	"encoding/json"
+	"flow/schema"
+	"flow/util"
+
+	"github.com/pkg/errors"
+)
+
+// 多实例任务定义(multiInstanceLoopCharacteristics)
+type multiInstance struct {
+	Sequential          bool   // 是否顺序执行(否则并行执行)
+	Collection          string // 集合表达式(返回字符串切片)
+	ElementVariable     string // 集合元素的变量名
+	CompletionCondition string // 完成条件表达式
+}
+
+// 从节点属性中获取多实例定义(非多实例节点返回nil)
+func getMultiInstance(prop map[string]string) *multiInstance {
+	mode := prop["multi_instance"]
+	if mode == "" {
+		return nil
+	}
+	return &multiInstance{
+		Sequential:          mode == "sequential",
+		Collection:          prop["collection"],
+		ElementVariable:     prop["element_variable"],
+		CompletionCondition: prop["completion_condition"],
+	}
+}
+
+// 多实例的循环变量(nrOfInstances、nrOfCompletedInstances、nrOfActiveInstances、loopCounter及集合元素变量)
+func (m *multiInstance) variables(collection []string, loopCounter, completed, active int) map[string]interface{} {
+	vars := map[string]interface{}{
+		"nrOfInstances":          len(collection),
+		"nrOfCompletedInstances": completed,
+		"nrOfActiveInstances":    active,
+		"loopCounter":            loopCounter,
+	}
+	if m.ElementVariable != "" && loopCounter < len(collection) {
+		vars[m.ElementVariable] = collection[loopCounter]
+	}
+	return vars
+}
+
+// 创建多实例任务的节点实例(并行执行时创建全部实例，顺序执行时创建第一个实例)
+func (n *NodeRouter) addLoopNodeInstances(r *schema.NodeRouter, m *multiInstance) ([]string, error) {
+	collection, err := n.engine.execer.ExecReturnStringSlice(n.ctx, []byte(m.Collection), n.getExpData())
+	if err != nil {
+		return nil, errors.Wrapf(err, "执行多实例任务的集合表达式发生错误")
+	} else if len(collection) == 0 {
+		return nil, errors.Errorf("多实例任务的集合(%s)为空", m.Collection)
+	}
+
+	count := len(collection)
+	if m.Sequential {
+		count = 1
+	}
+
+	loopID := util.UUID()
+	var nodeInstanceIDs []string
+	for i := 0; i < count; i++ {
+		instanceID, err := n.addLoopNodeInstance(r.TargetNodeID, r.RecordID, m, loopID, i, collection)
+		if err != nil {
+			return nil, err
+		}
+		nodeInstanceIDs = append(nodeInstanceIDs, instanceID)
+	}
+	return nodeInstanceIDs, nil
+}
+
+// 创建多实例任务的单个节点实例，未设定指派时集合元素即为候选人
+func (n *NodeRouter) addLoopNodeInstance(nodeID, routerID string, m *multiInstance, loopID string, loopCounter int, collection []string) (string, error) {
+	expData := n.getExpDataWith(m.variables(collection, loopCounter, 0, 0))
+	candidates, err := n.queryCandidates(nodeID, expData)
+	if err != nil {
+		return "", err
+	} else if len(candidates) == 0 {
+		candidates = []string{collection[loopCounter]}
+	}
+
+	return n.engine.flowBll.CreateLoopNodeInstance(n.ctx, n.flowInstance.RecordID, nodeID, routerID, n.inputData, candidates, loopID, loopCounter, collection)
+}
+
+// 完成多实例任务的节点实例，返回多实例任务是否完成(完成时取消其余待处理的实例)
+func (n *NodeRouter) completeLoopNodeInstance(processor string) (bool, error) {
+	prop, err := n.engine.flowBll.GetNodeProperty(n.ctx, n.node.RecordID)
+	if err != nil {
+		return false, err
+	}
+
+	m := getMultiInstance(prop)
+	if m == nil {
+		return true, nil
+	}
+
+	var collection []string
+	if err := json.Unmarshal([]byte(n.nodeInstance.LoopData), &collection); err != nil {
+		return false, errors.Wrapf(err, "解析多实例集合发生错误")
+	}
+
+	// 并行多实例锁定流程实例后再统计完成的实例，避免多个实例同时完成时都判断为等待
+	if !m.Sequential {
+		err = n.engine.flowBll.LockFlowInstance(n.ctx, n.flowInstance.RecordID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	items, err := n.engine.flowBll.QueryLoopNodeInstances(n.ctx, n.nodeInstance.LoopID)
+	if err != nil {
+		return false, err
+	}
+
+	var completed int
+	var pending []*schema.NodeInstance
+	for _, item := range items {
+		switch item.Status {
+		case 1:
+			pending = append(pending, item)
+		case 2:
+			completed++
+		}
+	}
+
+	loopCounter := int(n.nodeInstance.LoopCounter)
+	done := false
+	if m.CompletionCondition != "" {
+		expData := n.getExpDataWith(m.variables(collection, loopCounter, completed, len(pending)))
+		done, err = n.engine.execer.ExecReturnBool(n.ctx, []byte(m.CompletionCondition), expData)
+		if err != nil {
+			return false, errors.Wrapf(err, "执行多实例任务的完成条件发生错误")
+		}
+	}
+
+	if !done {
+		if m.Sequential {
+			if loopCounter+1 < len(collection) {
+				instanceID, err := n.addLoopNodeInstance(n.node.RecordID, n.nodeInstance.RouterID, m, n.nodeInstance.LoopID, loopCounter+1, collection)
+				if err != nil {
+					return false, err
+				}
+				_, err = n.next(instanceID, processor)
+				return false, err
+			}
+		} else if len(pending) > 0 {
+			return false, nil
+		}
+	}
+
+	// 多实例任务完成，取消其余待处理的实例
+	for _, item := range pending {
+		err = n.engine.flowBll.CancelNodeInstance(n.ctx, item.RecordID)
+		if err != nil {
+			return false, err
+		}
+
+		err = n.engine.flowBll.DeleteNodeTiming(n.ctx, item.RecordID)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
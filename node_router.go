@@ -3,16 +3,33 @@ package flow
 import (
 	"context"
 	"encoding/json"
+	"flow/model"
 	"flow/schema"
+	"fmt"
 
 	"github.com/pkg/errors"
 )
 
 // 定义错误
 var (
-	ErrNotFound = errors.New("未找到流程相关的信息")
+	ErrNotFound     = errors.New("未找到流程相关的信息")
+	ErrLeaseExpired = errors.New("定时节点的租约已失效")
 )
 
+// ConflictError 并发处理冲突错误(如多个服务实例同时处理同一节点)
+type ConflictError = model.ConflictError
+
+// NoOutgoingPathError 节点没有满足条件的流出路径且未设定默认路径(流程无法继续流转)
+type NoOutgoingPathError struct {
+	FlowInstanceID string // 流程实例内码
+	NodeInstanceID string // 节点实例内码
+	NodeCode       string // 节点编号
+}
+
+func (e *NoOutgoingPathError) Error() string {
+	return fmt.Sprintf("节点(%s)没有满足条件的流出路径", e.NodeCode)
+}
+
 type (
 	// NextNodeHandle 定义下一节点处理函数
 	NextNodeHandle func(*schema.Node, *schema.NodeInstance, []*schema.NodeCandidate)
@@ -80,7 +97,7 @@ func (n *NodeRouter) Init(ctx context.Context, engine *Engine, nodeInstanceID st
 	n.inputData = inputData
 	n.engine = engine
 
-	nodeInstance, err := n.engine.flowBll.GetNodeInstance(nodeInstanceID)
+	nodeInstance, err := n.engine.flowBll.GetNodeInstance(n.ctx, nodeInstanceID)
 	if err != nil {
 		return nil, err
 	} else if nodeInstance == nil {
@@ -88,7 +105,7 @@ func (n *NodeRouter) Init(ctx context.Context, engine *Engine, nodeInstanceID st
 	}
 	n.nodeInstance = nodeInstance
 
-	flowInstance, err := n.engine.flowBll.GetFlowInstance(nodeInstance.FlowInstanceID)
+	flowInstance, err := n.engine.flowBll.GetFlowInstance(n.ctx, nodeInstance.FlowInstanceID)
 	if err != nil {
 		return nil, err
 	} else if flowInstance == nil {
@@ -96,7 +113,7 @@ func (n *NodeRouter) Init(ctx context.Context, engine *Engine, nodeInstanceID st
 	}
 	n.flowInstance = flowInstance
 
-	node, err := n.engine.flowBll.GetNode(nodeInstance.NodeID)
+	node, err := n.engine.flowBll.GetNode(n.ctx, nodeInstance.NodeID)
 	if err != nil {
 		return nil, err
 	} else if node == nil {
@@ -141,37 +158,89 @@ func (n *NodeRouter) Next(processor string) error {
 		}
 
 		if !(pNodeType == StartEvent && n.parent.opts.autoStart) {
-			// 通知下一节点实例事件
-			if fn := n.opts.onNextNode; fn != nil {
-				candidates, err := n.engine.flowBll.QueryNodeCandidates(n.nodeInstance.RecordID)
+			return n.notifyNextNode()
+		}
+
+	}
+
+	// 中间捕获事件及接收任务停留在等待状态，由定时到期或消息关联后继续流转
+	if (nodeType == IntermediateCatchEvent || nodeType == ReceiveTask) && n.parent != nil {
+		return n.notifyNextNode()
+	}
+
+	// 调用活动及内嵌子流程发起子流程实例，子流程实例结束后继续流转
+	if (nodeType == CallActivity || nodeType == SubProcess) && n.parent != nil {
+		return n.startSubFlow(nodeType, processor)
+	}
+
+	if nodeType == ServiceTask {
+		prop, err := n.engine.flowBll.GetNodeProperty(n.ctx, n.node.RecordID)
+		if err != nil {
+			return err
+		}
+
+		if prop["service_type"] == externalServiceType {
+			// 外部任务创建后停留等待，由外部工作者领取执行完成后继续流转
+			if n.parent != nil {
+				_, err = n.engine.flowBll.CreateExternalTask(n.ctx, n.flowInstance.RecordID, n.nodeInstance.RecordID, prop["topic"])
 				if err != nil {
 					return err
 				}
-				fn(n.node, n.nodeInstance, candidates)
+				return n.notifyNextNode()
+			}
+		} else {
+			// 服务任务立即执行注册的处理函数，处理结果合并到流程数据后继续流转
+			err = n.execServiceTask(prop)
+			if err != nil {
+				return err
 			}
-			return nil
 		}
+	}
 
+	// 信号中间抛出事件广播信号后继续流转
+	if nodeType == IntermediateThrowEvent {
+		err = n.throwSignal()
+		if err != nil {
+			return err
+		}
+	}
+
+	// 脚本任务执行节点脚本，脚本返回的变量合并到流程数据后继续流转
+	if nodeType == ScriptTask {
+		err = n.execScriptTask()
+		if err != nil {
+			return err
+		}
+	}
+
+	// 并行网关及包容网关汇聚，还有未到达的分支时等待
+	if nodeType == ParallelGateway || nodeType == InclusiveGateway {
+		var wait bool
+		if nodeType == ParallelGateway {
+			wait, err = n.joinParallelGateway(processor)
+		} else {
+			wait, err = n.joinInclusiveGateway(processor)
+		}
+		if err != nil {
+			return err
+		} else if wait {
+			return nil
+		}
 	}
 
 	// 完成当前节点
-	err = n.engine.flowBll.DoneNodeInstance(n.nodeInstance.RecordID, processor, n.inputData)
+	err = n.engine.flowBll.DoneNodeInstance(n.ctx, n.nodeInstance.RecordID, processor, n.inputData)
 	if err != nil {
 		return err
 	}
 
-	// 如果当前节点是人工任务，检查下一节点是否是并行网关，如果是则检查还未完成的待办事项，如果有则停止流转
-	if nodeType == UserTask && n.parent == nil {
-		ok, err := n.checkNextNodeType(ParallelGateway)
+	// 多实例任务在满足完成条件或全部实例完成后继续流转
+	if n.nodeInstance.LoopID != "" {
+		done, err := n.completeLoopNodeInstance(processor)
 		if err != nil {
 			return err
-		} else if ok {
-			exists, err := n.engine.flowBll.CheckFlowInstanceTodo(n.flowInstance.RecordID)
-			if err != nil {
-				return err
-			} else if exists {
-				return nil
-			}
+		} else if !done {
+			return nil
 		}
 	}
 
@@ -181,8 +250,14 @@ func (n *NodeRouter) Next(processor string) error {
 		isEnd := false
 
 		// 如果是结束事件，则检查还未完成的待办事项，如果没有则结束流程并通知结束事件
+		// 锁定流程实例后再检查，避免多个分支同时结束时都判断为还有待办
 		if nodeType == EndEvent {
-			exists, err := n.engine.flowBll.CheckFlowInstanceTodo(n.flowInstance.RecordID)
+			err = n.engine.flowBll.LockFlowInstance(n.ctx, n.flowInstance.RecordID)
+			if err != nil {
+				return err
+			}
+
+			exists, err := n.engine.flowBll.CheckFlowInstanceTodo(n.ctx, n.flowInstance.RecordID)
 			if err != nil {
 				return err
 			} else if !exists {
@@ -197,23 +272,41 @@ func (n *NodeRouter) Next(processor string) error {
 
 		if isEnd {
 			// 流程实例结束处理
-			err = n.engine.flowBll.DoneFlowInstance(n.flowInstance.RecordID)
+			err = n.engine.flowBll.DoneFlowInstance(n.ctx, n.flowInstance.RecordID)
 			if err != nil {
 				return err
 			}
 
+			// 终止事件同时停止进行中的子流程实例
+			if nodeType == TerminateEvent {
+				err = n.engine.flowBll.StopSubFlowInstances(n.ctx, n.flowInstance.RecordID, "")
+				if err != nil {
+					return err
+				}
+			}
+
 			n.stop = true
+			// 子流程实例结束后继续父级流程的流转
+			if n.flowInstance.ParentNodeInstanceID != "" {
+				return n.resumeParentFlow(processor)
+			}
+
 			if fn := n.opts.onFlowEnd; fn != nil {
 				fn(n.flowInstance)
 			}
+			return nil
 		}
-		return nil
+
+		// 流转结束后重新检查等待汇聚的包容网关
+		return n.resumeInclusiveGateways(processor)
 	}
 
 	// 增加下一节点
 	nodeInstanceIDs, err := n.addNextNodeInstances()
 	if err != nil {
 		return err
+	} else if len(nodeInstanceIDs) == 0 {
+		return n.resumeInclusiveGateways(processor)
 	}
 
 	for _, instanceID := range nodeInstanceIDs {
@@ -230,42 +323,375 @@ func (n *NodeRouter) Next(processor string) error {
 	return nil
 }
 
+// 发起子流程实例(调用活动或内嵌子流程)，子流程实例同步结束时当前节点已继续流转
+func (n *NodeRouter) startSubFlow(nodeType NodeType, processor string) error {
+	prop, err := n.engine.flowBll.GetNodeProperty(n.ctx, n.node.RecordID)
+	if err != nil {
+		return err
+	}
+
+	flowID := prop["sub_flow_id"]
+	if nodeType == CallActivity {
+		flow, err := n.engine.flowBll.GetFlowByCode(n.ctx, prop["called_element"])
+		if err != nil {
+			return err
+		} else if flow == nil {
+			return errors.Errorf("调用活动(%s)调用的流程(%s)不存在", n.node.Code, prop["called_element"])
+		}
+		flowID = flow.RecordID
+	}
+
+	mappings, err := subFlowMappings(nodeType, prop["in_variables"])
+	if err != nil {
+		return err
+	}
+
+	vars, err := mapVariables(n.inputData, mappings)
+	if err != nil {
+		return err
+	}
+	inputData, _ := json.Marshal(vars)
+
+	_, startInstance, err := n.engine.flowBll.LaunchSubFlowInstance(n.ctx, flowID, n.flowInstance, n.nodeInstance.RecordID, inputData)
+	if err != nil {
+		return err
+	}
+
+	subRouter, err := new(NodeRouter).Init(n.ctx, n.engine, startInstance.RecordID, inputData)
+	if err != nil {
+		return err
+	}
+	// 子流程的人工任务等待处理，不自动开始
+	subRouter.opts = &nodeRouterOptions{
+		onNextNode: n.opts.onNextNode,
+		onFlowEnd:  n.opts.onFlowEnd,
+	}
+
+	err = subRouter.Next(processor)
+	if err != nil {
+		return err
+	}
+
+	nodeInstance, err := n.engine.flowBll.GetNodeInstance(n.ctx, n.nodeInstance.RecordID)
+	if err != nil {
+		return err
+	} else if nodeInstance != nil && nodeInstance.Status == 1 {
+		return n.notifyNextNode()
+	}
+
+	flowInstance, err := n.engine.flowBll.GetFlowInstance(n.ctx, n.flowInstance.RecordID)
+	if err != nil {
+		return err
+	}
+	n.stop = flowInstance != nil && flowInstance.Status != 1
+	return nil
+}
+
+// 子流程实例结束后，输出变量合并到调用节点的流程数据并继续父级流程的流转
+func (n *NodeRouter) resumeParentFlow(processor string) error {
+	nodeInstance, err := n.engine.flowBll.GetNodeInstance(n.ctx, n.flowInstance.ParentNodeInstanceID)
+	if err != nil {
+		return err
+	} else if nodeInstance == nil || nodeInstance.Status != 1 {
+		// 调用节点已取消(如中断边界事件触发)
+		return nil
+	}
+
+	parentRouter, err := new(NodeRouter).Init(n.ctx, n.engine, nodeInstance.RecordID, nil)
+	if err != nil {
+		return err
+	} else if parentRouter.flowInstance.Status != 1 {
+		return nil
+	}
+
+	nodeType, err := GetNodeTypeByName(parentRouter.node.TypeCode)
+	if err != nil {
+		return err
+	}
+
+	prop, err := n.engine.flowBll.GetNodeProperty(n.ctx, parentRouter.node.RecordID)
+	if err != nil {
+		return err
+	}
+
+	mappings, err := subFlowMappings(nodeType, prop["out_variables"])
+	if err != nil {
+		return err
+	}
+
+	vars, err := mapVariables(n.inputData, mappings)
+	if err != nil {
+		return err
+	}
+
+	parentRouter.inputData, err = mergeInputData([]byte(nodeInstance.InputData), vars)
+	if err != nil {
+		return err
+	}
+	parentRouter.opts = n.opts
+
+	err = parentRouter.Next(processor)
+	if err != nil {
+		return err
+	}
+
+	// 调用节点已完成，移除节点的定时(包括边界定时事件)
+	return n.engine.flowBll.DeleteNodeTiming(n.ctx, nodeInstance.RecordID)
+}
+
+// 执行服务任务
+func (n *NodeRouter) execServiceTask(prop map[string]string) error {
+	task := &ServiceTaskInfo{
+		Name:         serviceHandlerName(prop),
+		Node:         n.node,
+		FlowInstance: n.flowInstance,
+		NodeInstance: n.nodeInstance,
+	}
+	inputData, err := n.engine.execServiceTask(n.ctx, task, n.inputData)
+	if err != nil {
+		return err
+	}
+	n.inputData = inputData
+	return nil
+}
+
+// 执行脚本任务
+func (n *NodeRouter) execScriptTask() error {
+	prop, err := n.engine.flowBll.GetNodeProperty(n.ctx, n.node.RecordID)
+	if err != nil {
+		return err
+	}
+
+	vars, err := n.engine.execer.ExecReturnMap(n.ctx, []byte(prop["script"]), n.getExpData())
+	if err != nil {
+		return errors.Wrapf(err, "执行脚本任务(%s)发生错误", n.node.Code)
+	}
+
+	inputData, err := mergeInputData(n.inputData, vars)
+	if err != nil {
+		return err
+	}
+	n.inputData = inputData
+	return nil
+}
+
+// 广播中间抛出事件的信号
+func (n *NodeRouter) throwSignal() error {
+	prop, err := n.engine.flowBll.GetNodeProperty(n.ctx, n.node.RecordID)
+	if err != nil {
+		return err
+	}
+
+	// 与抛出信号的流程在同一事务中处理，任一目标失败时整体回滚
+	_, failures, err := n.engine.broadcastSignal(n.ctx, prop["signal_name"], nil)
+	if err != nil {
+		return err
+	} else if len(failures) > 0 {
+		return &SignalBroadcastError{SignalName: prop["signal_name"], Failures: failures}
+	}
+	return nil
+}
+
+// 包容网关汇聚：流程实例中还有其他可以到达网关的待处理节点时等待，
+// 否则完成已到达网关的其他节点实例，合并流程数据后继续流转
+func (n *NodeRouter) joinInclusiveGateway(processor string) (bool, error) {
+	routers, err := n.engine.flowBll.QueryNodeRoutersByTarget(n.ctx, n.node.RecordID)
+	if err != nil {
+		return false, err
+	} else if len(routers) < 2 {
+		return false, nil
+	}
+
+	// 锁定流程实例后再统计到达的分支，避免多个分支同时到达时都判断为等待
+	err = n.engine.flowBll.LockFlowInstance(n.ctx, n.flowInstance.RecordID)
+	if err != nil {
+		return false, err
+	}
+
+	items, err := n.engine.flowBll.QueryPendingNodeInstances(n.ctx, n.flowInstance.RecordID)
+	if err != nil {
+		return false, err
+	}
+
+	var arrived []*schema.NodeInstance
+	for _, item := range items {
+		if item.RecordID == n.nodeInstance.RecordID {
+			continue
+		} else if item.NodeID == n.node.RecordID {
+			arrived = append(arrived, item)
+			continue
+		}
+
+		reachable, err := n.engine.flowBll.CheckNodeReachable(n.ctx, item.NodeID, n.node.RecordID)
+		if err != nil {
+			return false, err
+		} else if reachable {
+			return true, nil
+		}
+	}
+
+	return false, n.mergeArrivedTokens(arrived, processor)
+}
+
+// 并行网关汇聚：每个流入路径都有到达的节点实例时继续流转，否则等待
+// 同一流入路径多次到达时按到达顺序属于不同的网关激活
+func (n *NodeRouter) joinParallelGateway(processor string) (bool, error) {
+	routers, err := n.engine.flowBll.QueryNodeRoutersByTarget(n.ctx, n.node.RecordID)
+	if err != nil {
+		return false, err
+	} else if len(routers) < 2 {
+		return false, nil
+	}
+
+	// 锁定流程实例后再统计到达的分支，避免多个分支同时到达时都判断为等待
+	err = n.engine.flowBll.LockFlowInstance(n.ctx, n.flowInstance.RecordID)
+	if err != nil {
+		return false, err
+	}
+
+	items, err := n.engine.flowBll.QueryPendingNodeInstances(n.ctx, n.flowInstance.RecordID)
+	if err != nil {
+		return false, err
+	}
+
+	tokens := make(map[string]*schema.NodeInstance)
+	for _, item := range items {
+		if item.NodeID != n.node.RecordID {
+			continue
+		} else if _, ok := tokens[item.RouterID]; !ok {
+			tokens[item.RouterID] = item
+		}
+	}
+
+	var arrived []*schema.NodeInstance
+	for _, r := range routers {
+		item, ok := tokens[r.RecordID]
+		if !ok {
+			return true, nil
+		} else if item.RecordID != n.nodeInstance.RecordID {
+			arrived = append(arrived, item)
+		}
+	}
+	return false, n.mergeArrivedTokens(arrived, processor)
+}
+
+// 完成已到达网关的其他节点实例，流程数据合并到当前节点(当前节点的数据优先)
+func (n *NodeRouter) mergeArrivedTokens(arrived []*schema.NodeInstance, processor string) error {
+	if len(arrived) == 0 {
+		return nil
+	}
+
+	vars := make(map[string]interface{})
+	for _, item := range arrived {
+		var input map[string]interface{}
+		_ = json.Unmarshal([]byte(item.InputData), &input)
+		for k, v := range input {
+			vars[k] = v
+		}
+
+		err := n.engine.flowBll.DoneNodeInstance(n.ctx, item.RecordID, processor, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	var input map[string]interface{}
+	_ = json.Unmarshal(n.inputData, &input)
+	for k, v := range input {
+		vars[k] = v
+	}
+	n.inputData, _ = json.Marshal(vars)
+	return nil
+}
+
+// 重新检查流程实例中等待汇聚的包容网关(其他分支结束后网关可能不再需要等待)
+func (n *NodeRouter) resumeInclusiveGateways(processor string) error {
+	items, err := n.engine.flowBll.QueryPendingNodeInstances(n.ctx, n.flowInstance.RecordID)
+	if err != nil {
+		return err
+	}
+
+	checked := make(map[string]bool)
+	for _, item := range items {
+		if checked[item.NodeID] {
+			continue
+		}
+		checked[item.NodeID] = true
+
+		node, err := n.engine.flowBll.GetNode(n.ctx, item.NodeID)
+		if err != nil {
+			return err
+		} else if node == nil || node.TypeCode != InclusiveGateway.String() {
+			continue
+		}
+
+		current, err := n.engine.flowBll.GetNodeInstance(n.ctx, item.RecordID)
+		if err != nil {
+			return err
+		} else if current == nil || current.Status != 1 {
+			continue
+		}
+
+		gatewayRouter, err := new(NodeRouter).Init(n.ctx, n.engine, item.RecordID, []byte(item.InputData))
+		if err != nil {
+			return err
+		}
+		gatewayRouter.opts = n.opts
+		gatewayRouter.parent = n
+
+		err = gatewayRouter.Next(processor)
+		if err != nil {
+			return err
+		} else if gatewayRouter.stop {
+			n.stop = true
+			break
+		}
+	}
+	return nil
+}
+
+// 通知下一节点实例事件
+func (n *NodeRouter) notifyNextNode() error {
+	if fn := n.opts.onNextNode; fn != nil {
+		candidates, err := n.engine.flowBll.QueryNodeCandidates(n.ctx, n.nodeInstance.RecordID)
+		if err != nil {
+			return err
+		}
+		fn(n.node, n.nodeInstance, candidates)
+	}
+	return nil
+}
+
 // 增加下一处理节点实例
 func (n *NodeRouter) addNextNodeInstances() ([]string, error) {
-	routers, err := n.engine.flowBll.QueryNodeRouters(n.node.RecordID)
+	routers, err := n.matchNextRouters()
 	if err != nil {
 		return nil, err
-	} else if len(routers) == 0 {
-		return nil, nil
 	}
 
 	var nodeInstanceIDs []string
 	for _, r := range routers {
-		if r.Expression != "" {
-			allow, err := n.engine.execer.ExecReturnBool(n.ctx, []byte(r.Expression), n.getExpData())
-			if err != nil {
-				return nil, err
-			} else if !allow {
-				continue
-			}
-		}
-
-		// 查询指派人表达式
-		assigns, err := n.engine.flowBll.QueryNodeAssignments(r.TargetNodeID)
+		prop, err := n.engine.flowBll.GetNodeProperty(n.ctx, r.TargetNodeID)
 		if err != nil {
 			return nil, err
 		}
 
-		var candidates []string
-		for _, assign := range assigns {
-			ss, err := n.engine.execer.ExecReturnStringSlice(n.ctx, []byte(assign.Expression), n.getExpData())
+		// 多实例任务按集合创建节点实例
+		if m := getMultiInstance(prop); m != nil {
+			ids, err := n.addLoopNodeInstances(r, m)
 			if err != nil {
 				return nil, err
 			}
-			candidates = append(candidates, ss...)
+			nodeInstanceIDs = append(nodeInstanceIDs, ids...)
+			continue
+		}
+
+		candidates, err := n.queryCandidates(r.TargetNodeID, n.getExpData())
+		if err != nil {
+			return nil, err
 		}
 
-		instanceID, err := n.engine.flowBll.CreateNodeInstance(n.flowInstance.RecordID, r.TargetNodeID, n.inputData, candidates)
+		instanceID, err := n.engine.flowBll.CreateNodeInstance(n.ctx, n.flowInstance.RecordID, r.TargetNodeID, r.RecordID, n.inputData, candidates)
 		if err != nil {
 			return nil, err
 		}
@@ -274,42 +700,75 @@ func (n *NodeRouter) addNextNodeInstances() ([]string, error) {
 	return nodeInstanceIDs, nil
 }
 
-// 检查下一节点类型
-func (n *NodeRouter) checkNextNodeType(t NodeType) (bool, error) {
-	routers, err := n.engine.flowBll.QueryNodeRouters(n.node.RecordID)
+// 执行节点的指派人表达式，查询节点候选人
+func (n *NodeRouter) queryCandidates(nodeID string, expData []byte) ([]string, error) {
+	assigns, err := n.engine.flowBll.QueryNodeAssignments(n.ctx, nodeID)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	var candidates []string
+	for _, assign := range assigns {
+		ss, err := n.engine.execer.ExecReturnStringSlice(n.ctx, []byte(assign.Expression), expData)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, ss...)
+	}
+	return candidates, nil
+}
+
+// 查询满足条件的流出路由(排他网关仅取第一个满足条件的路由)，没有满足条件的路由时使用默认路由
+func (n *NodeRouter) matchNextRouters() ([]*schema.NodeRouter, error) {
+	routers, err := n.engine.flowBll.QueryNodeRouters(n.ctx, n.node.RecordID)
+	if err != nil {
+		return nil, err
 	} else if len(routers) == 0 {
-		return false, nil
+		return nil, nil
 	}
 
+	var matched, defaults []*schema.NodeRouter
 	for _, r := range routers {
+		if r.IsDefaultTarget == 1 {
+			defaults = append(defaults, r)
+			continue
+		}
+
 		if r.Expression != "" {
 			allow, err := n.engine.execer.ExecReturnBool(n.ctx, []byte(r.Expression), n.getExpData())
 			if err != nil {
-				return false, err
+				return nil, err
 			} else if !allow {
 				continue
 			}
 		}
 
-		node, err := n.engine.flowBll.GetNode(r.TargetNodeID)
-		if err != nil {
-			return false, err
-		} else if node == nil {
-			return false, nil
+		matched = append(matched, r)
+		if n.node.TypeCode == ExclusiveGateway.String() {
+			break
 		}
+	}
 
-		if node.TypeCode == t.String() {
-			return true, nil
+	if len(matched) == 0 {
+		matched = defaults
+	}
+	if len(matched) == 0 {
+		return nil, &NoOutgoingPathError{
+			FlowInstanceID: n.flowInstance.RecordID,
+			NodeInstanceID: n.nodeInstance.RecordID,
+			NodeCode:       n.node.Code,
 		}
 	}
-
-	return false, nil
+	return matched, nil
 }
 
 // 获取表达式数据
 func (n *NodeRouter) getExpData() []byte {
+	return n.getExpDataWith(nil)
+}
+
+// 获取表达式数据，并附加变量(如多实例的循环变量)
+func (n *NodeRouter) getExpDataWith(vars map[string]interface{}) []byte {
 	var input map[string]interface{}
 	json.Unmarshal(n.inputData, &input)
 
@@ -318,6 +777,9 @@ func (n *NodeRouter) getExpData() []byte {
 		"flow":  n.flowInstance,
 		"node":  n.nodeInstance,
 	}
+	for k, v := range vars {
+		r[k] = v
+	}
 	b, _ := json.Marshal(r)
 	return b
 }
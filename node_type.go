@@ -18,10 +18,28 @@ const (
 	TerminateEvent NodeType = "terminateEvent"
 	// UserTask 人工任务
 	UserTask NodeType = "userTask"
+	// ServiceTask 服务任务
+	ServiceTask NodeType = "serviceTask"
+	// ScriptTask 脚本任务
+	ScriptTask NodeType = "scriptTask"
+	// ReceiveTask 接收任务
+	ReceiveTask NodeType = "receiveTask"
 	// ExclusiveGateway 排他网关
 	ExclusiveGateway NodeType = "exclusiveGateway"
 	// ParallelGateway 并行网关
 	ParallelGateway NodeType = "parallelGateway"
+	// InclusiveGateway 包容网关
+	InclusiveGateway NodeType = "inclusiveGateway"
+	// BoundaryEvent 边界事件
+	BoundaryEvent NodeType = "boundaryEvent"
+	// IntermediateCatchEvent 中间捕获事件
+	IntermediateCatchEvent NodeType = "intermediateCatchEvent"
+	// IntermediateThrowEvent 中间抛出事件
+	IntermediateThrowEvent NodeType = "intermediateThrowEvent"
+	// CallActivity 调用活动
+	CallActivity NodeType = "callActivity"
+	// SubProcess 内嵌子流程
+	SubProcess NodeType = "subProcess"
 	// Unknown 未知类型
 	Unknown NodeType = "Unknown"
 )
@@ -37,10 +55,28 @@ func GetNodeTypeByName(s string) (NodeType, error) {
 		return TerminateEvent, nil
 	case "userTask":
 		return UserTask, nil
+	case "serviceTask":
+		return ServiceTask, nil
+	case "scriptTask":
+		return ScriptTask, nil
+	case "receiveTask":
+		return ReceiveTask, nil
 	case "exclusiveGateway":
 		return ExclusiveGateway, nil
 	case "parallelGateway":
 		return ParallelGateway, nil
+	case "inclusiveGateway":
+		return InclusiveGateway, nil
+	case "boundaryEvent":
+		return BoundaryEvent, nil
+	case "intermediateCatchEvent":
+		return IntermediateCatchEvent, nil
+	case "intermediateThrowEvent":
+		return IntermediateThrowEvent, nil
+	case "callActivity":
+		return CallActivity, nil
+	case "subProcess":
+		return SubProcess, nil
 	}
 	return Unknown, errors.New(s + "不支持的类型")
 }
@@ -12,11 +12,12 @@ type Parser interface {
 
 // ParseResult 流程数据
 type ParseResult struct {
-	FlowID      string        // 流程ID
-	FlowName    string        // 流程名称
-	FlowVersion int64         // 流程版本号
-	FlowStatus  int           // 流程状态(1:可用 2:不可用)
-	Nodes       []*NodeResult // 节点数据
+	FlowID       string         // 流程ID
+	FlowName     string         // 流程名称
+	FlowVersion  int64          // 流程版本号
+	FlowStatus   int            // 流程状态(1:可用 2:不可用)
+	Nodes        []*NodeResult  // 节点数据
+	SubProcesses []*ParseResult // 内嵌子流程(FlowID为子流程节点ID)
 }
 
 // NodeResult 节点数据
@@ -35,6 +36,7 @@ type RouterResult struct {
 	TargetNodeID string // 目标节点ID
 	Explain      string // 说明
 	Expression   string // 条件表达式
+	IsDefault    bool   // 是否是默认路径(没有满足条件的路径时流转)
 }
 
 // PropertyResult 节点属性
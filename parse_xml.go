@@ -2,10 +2,13 @@ package flow
 
 import (
 	"context"
+	"encoding/json"
 	"flow/util"
 	"strconv"
+	"strings"
 
 	"github.com/beevik/etree"
+	"github.com/pkg/errors"
 )
 
 // NewXMLParser xml解析器
@@ -50,30 +53,123 @@ func (p *xmlParser) Parse(ctx context.Context, content []byte) (*ParseResult, er
 		}
 	}
 
+	err = p.parseElements(process, result)
+	if err != nil {
+		return nil, err
+	}
+
+	// 消息及信号引用由ID转换为名称
+	for _, item := range [][3]string{{"message", "message_name", "消息"}, {"signal", "signal_name", "信号"}} {
+		err = p.resolveEventNames(result, item[1], p.parseEventNames(root, item[0]), item[2])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// 解析流程定义中的消息(message)或信号(signal)，由ID映射到名称
+func (p *xmlParser) parseEventNames(root *etree.Element, tag string) map[string]string {
+	names := make(map[string]string)
+	for _, e := range root.SelectElements(tag) {
+		id := e.SelectAttr("id")
+		if id == nil || id.Value == "" {
+			continue
+		}
+
+		name := id.Value
+		if v := e.SelectAttr("name"); v != nil && v.Value != "" {
+			name = v.Value
+		}
+		names[id.Value] = name
+	}
+	return names
+}
+
+// 将节点的事件属性(message_name或signal_name)由ID转换为名称(包括内嵌子流程的节点)
+func (p *xmlParser) resolveEventNames(result *ParseResult, property string, names map[string]string, label string) error {
+	for _, node := range result.Nodes {
+		for _, item := range node.Properties {
+			if item.Name != property {
+				continue
+			}
+
+			name, ok := names[item.Value]
+			if !ok {
+				return errors.Errorf("节点(%s)引用的%s(%s)未定义", node.NodeID, label, item.Value)
+			}
+			item.Value = name
+		}
+	}
+
+	for _, sub := range result.SubProcesses {
+		if err := p.resolveEventNames(sub, property, names, label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解析流程(或内嵌子流程)中的节点及路由，内嵌子流程解析为子流程数据
+func (p *xmlParser) parseElements(process *etree.Element, result *ParseResult) error {
 	// 定义一个用于辅助的map，由节点id映射到noderesult
 	nodeMap := make(map[string]*NodeResult)
+	defaultFlows := make(map[string]string)
+	var nodeIDs []string
 	// 遍历找到所有的节点，因为是解析一个树，所以先解析节点，再解析sequenceFlow部分
 	// 解析sequenceFlow部分时，nodeMap里面应该已经有对应的nodeId了
 	for _, element := range process.ChildElements() {
 		if element.Tag == "documentation" ||
 			element.Tag == "extensionElements" ||
+			element.Tag == "incoming" ||
+			element.Tag == "outgoing" ||
 			element.Tag == "sequenceFlow" {
 			continue
 		}
-		node, _ := p.ParseNode(element)
+		node, err := p.ParseNode(element)
+		if err != nil {
+			return err
+		}
 		var nodeResult NodeResult
 		nodeResult.NodeID = node.Code
 		nodeResult.NodeName = node.Name
 		nodeResult.NodeType, err = GetNodeTypeByName(node.Type)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		nodeResult.CandidateExpressions = node.CandidateUsers
 		// yupengfei 2018-01-17 增加了form的解析
 		nodeResult.FormResult = node.FormResult
 		nodeResult.Properties = node.Properties
 		nodeMap[nodeResult.NodeID] = &nodeResult
-		// 如果节点是一个路由的话，需要特殊处理
+		nodeIDs = append(nodeIDs, nodeResult.NodeID)
+		if node.DefaultFlow != "" {
+			defaultFlows[node.Code] = node.DefaultFlow
+		}
+
+		// 内嵌子流程的节点及路由作为独立的子流程解析
+		if nodeResult.NodeType == SubProcess {
+			sub := &ParseResult{
+				FlowID:      node.Code,
+				FlowName:    node.Name,
+				FlowVersion: result.FlowVersion,
+				FlowStatus:  result.FlowStatus,
+			}
+			if err := p.parseElements(element, sub); err != nil {
+				return err
+			}
+
+			hasStart := false
+			for _, n := range sub.Nodes {
+				if n.NodeType == StartEvent {
+					hasStart = true
+				}
+			}
+			if !hasStart {
+				return errors.Errorf("子流程(%s)未设定开始事件", node.Code)
+			}
+			result.SubProcesses = append(result.SubProcesses, sub)
+		}
 	}
 
 	for _, element := range process.ChildElements() {
@@ -83,16 +179,17 @@ func (p *xmlParser) Parse(ctx context.Context, content []byte) (*ParseResult, er
 			routerResult.Expression = sequenceFlow.Expression
 			routerResult.Explain = sequenceFlow.Explain
 			routerResult.TargetNodeID = sequenceFlow.TargetRef
+			routerResult.IsDefault = defaultFlows[sequenceFlow.SourceRef] == sequenceFlow.Code
 			if nodeResult, exist := nodeMap[sequenceFlow.SourceRef]; exist {
 				nodeResult.Routers = append(nodeResult.Routers, &routerResult)
 			}
 		}
 	}
 
-	for _, nodeResult := range nodeMap {
-		result.Nodes = append(result.Nodes, nodeResult)
+	for _, id := range nodeIDs {
+		result.Nodes = append(result.Nodes, nodeMap[id])
 	}
-	return result, nil
+	return nil
 }
 
 func (p *xmlParser) ParseNode(element *etree.Element) (*nodeInfo, error) {
@@ -115,6 +212,153 @@ func (p *xmlParser) ParseNode(element *etree.Element) (*nodeInfo, error) {
 	if candidateUsers := element.SelectAttr("candidateUsers"); candidateUsers != nil {
 		node.CandidateUsers = []string{candidateUsers.Value}
 	}
+	if v := element.SelectAttr("default"); v != nil {
+		node.DefaultFlow = v.Value
+	}
+	if node.Type == "boundaryEvent" {
+		attachedToRef := element.SelectAttr("attachedToRef")
+		if attachedToRef == nil || attachedToRef.Value == "" {
+			return nil, errors.Errorf("边界事件(%s)未指定附加的节点", node.Code)
+		}
+
+		cancelActivity := "true"
+		if v := element.SelectAttr("cancelActivity"); v != nil && v.Value == "false" {
+			cancelActivity = "false"
+		}
+		node.Properties = append(node.Properties,
+			&PropertyResult{Name: "attached_to", Value: attachedToRef.Value},
+			&PropertyResult{Name: "cancel_activity", Value: cancelActivity},
+		)
+	}
+	if node.Type == "serviceTask" {
+		for _, attr := range [][2]string{
+			{"type", "service_type"},
+			{"delegateExpression", "delegate_expression"},
+			{"topic", "topic"},
+		} {
+			if v := element.SelectAttr(attr[0]); v != nil && v.Value != "" {
+				node.Properties = append(node.Properties, &PropertyResult{Name: attr[1], Value: v.Value})
+			}
+		}
+		if len(node.Properties) == 0 {
+			return nil, errors.Errorf("服务任务(%s)未指定处理函数", node.Code)
+		} else if v := element.SelectAttr("type"); v != nil && v.Value == externalServiceType {
+			if topic := element.SelectAttr("topic"); topic == nil || topic.Value == "" {
+				return nil, errors.Errorf("外部任务(%s)未指定主题", node.Code)
+			}
+		}
+	}
+	if node.Type == "scriptTask" {
+		var script string
+		if e := element.SelectElement("script"); e != nil {
+			script = strings.TrimSpace(e.Text())
+		}
+		if script == "" {
+			return nil, errors.Errorf("脚本任务(%s)未设定脚本", node.Code)
+		}
+		node.Properties = append(node.Properties, &PropertyResult{Name: "script", Value: script})
+	}
+	if loop := element.SelectElement("multiInstanceLoopCharacteristics"); loop != nil {
+		if node.Type != "userTask" {
+			return nil, errors.Errorf("节点(%s)不支持多实例，仅人工任务支持多实例", node.Code)
+		}
+
+		mode := "parallel"
+		if v := loop.SelectAttr("isSequential"); v != nil && v.Value == "true" {
+			mode = "sequential"
+		}
+
+		var collection string
+		if v := loop.SelectAttr("collection"); v != nil {
+			collection = trimExpression(v.Value)
+		}
+		if collection == "" {
+			return nil, errors.Errorf("多实例任务(%s)未设定集合", node.Code)
+		}
+		node.Properties = append(node.Properties,
+			&PropertyResult{Name: "multi_instance", Value: mode},
+			&PropertyResult{Name: "collection", Value: collection},
+		)
+
+		if v := loop.SelectAttr("elementVariable"); v != nil && v.Value != "" {
+			node.Properties = append(node.Properties, &PropertyResult{Name: "element_variable", Value: v.Value})
+		}
+		if e := loop.SelectElement("completionCondition"); e != nil {
+			if v := trimExpression(e.Text()); v != "" {
+				node.Properties = append(node.Properties, &PropertyResult{Name: "completion_condition", Value: v})
+			}
+		}
+	}
+	if node.Type == "callActivity" {
+		calledElement := element.SelectAttr("calledElement")
+		if calledElement == nil || calledElement.Value == "" {
+			return nil, errors.Errorf("调用活动(%s)未指定调用的流程", node.Code)
+		}
+		node.Properties = append(node.Properties, &PropertyResult{Name: "called_element", Value: calledElement.Value})
+
+		// 解析输入输出变量映射(camunda:in、camunda:out)
+		if extensionElements := element.SelectElement("extensionElements"); extensionElements != nil {
+			for _, item := range [][2]string{{"in", "in_variables"}, {"out", "out_variables"}} {
+				mappings := p.parseVariableMappings(extensionElements.SelectElements(item[0]))
+				if len(mappings) > 0 {
+					buf, _ := json.Marshal(mappings)
+					node.Properties = append(node.Properties, &PropertyResult{Name: item[1], Value: string(buf)})
+				}
+			}
+		}
+	}
+	// 消息开始事件、消息中间捕获事件及接收任务保存引用的消息(message_name属性，解析完成后转换为消息名称)
+	messageRef := ""
+	if e := element.SelectElement("messageEventDefinition"); e != nil {
+		if node.Type != "startEvent" && node.Type != "intermediateCatchEvent" {
+			return nil, errors.Errorf("节点(%s)不支持消息事件定义", node.Code)
+		}
+		if v := e.SelectAttr("messageRef"); v != nil {
+			messageRef = v.Value
+		}
+		if messageRef == "" {
+			return nil, errors.Errorf("消息事件(%s)未指定消息", node.Code)
+		}
+	}
+	if node.Type == "receiveTask" {
+		if v := element.SelectAttr("messageRef"); v != nil {
+			messageRef = v.Value
+		}
+		if messageRef == "" {
+			return nil, errors.Errorf("接收任务(%s)未指定消息", node.Code)
+		}
+	}
+	if messageRef != "" {
+		node.Properties = append(node.Properties, &PropertyResult{Name: "message_name", Value: messageRef})
+	}
+	// 信号开始事件、信号中间捕获/抛出事件及信号边界事件保存引用的信号(signal_name属性，解析完成后转换为信号名称)
+	signalRef := ""
+	if e := element.SelectElement("signalEventDefinition"); e != nil {
+		switch node.Type {
+		case "startEvent", "intermediateCatchEvent", "intermediateThrowEvent", "boundaryEvent":
+		default:
+			return nil, errors.Errorf("节点(%s)不支持信号事件定义", node.Code)
+		}
+		if v := e.SelectAttr("signalRef"); v != nil {
+			signalRef = v.Value
+		}
+		if signalRef == "" {
+			return nil, errors.Errorf("信号事件(%s)未指定信号", node.Code)
+		}
+		node.Properties = append(node.Properties, &PropertyResult{Name: "signal_name", Value: signalRef})
+	}
+	if node.Type == "intermediateCatchEvent" && element.SelectElement("timerEventDefinition") == nil && messageRef == "" && signalRef == "" {
+		return nil, errors.Errorf("中间捕获事件(%s)未设定事件定义", node.Code)
+	}
+	if node.Type == "intermediateThrowEvent" && signalRef == "" {
+		return nil, errors.Errorf("中间抛出事件(%s)未设定信号事件定义", node.Code)
+	}
+	if dueDate := element.SelectAttr("dueDate"); dueDate != nil && dueDate.Value != "" {
+		if _, err := ParseTimer("", dueDate.Value); err != nil {
+			return nil, errors.Wrapf(err, "节点(%s)的截止时间无效", node.Code)
+		}
+		node.Properties = append(node.Properties, &PropertyResult{Name: "due_date", Value: dueDate.Value})
+	}
 
 	nodeFormResult := new(NodeFormResult)
 	if formKey := element.SelectAttr("formKey"); formKey != nil {
@@ -150,9 +394,61 @@ func (p *xmlParser) ParseNode(element *etree.Element) (*nodeInfo, error) {
 	}
 	node.FormResult = nodeFormResult
 
+	// 解析定时器定义(timerEventDefinition)，保存为timing及timing_type属性
+	if timer := element.SelectElement("timerEventDefinition"); timer != nil {
+		for _, e := range timer.ChildElements() {
+			switch TimerType(e.Tag) {
+			case TimeDuration, TimeDate, TimeCycle:
+				node.Properties = append(node.Properties,
+					&PropertyResult{Name: "timing", Value: strings.TrimSpace(e.Text())},
+					&PropertyResult{Name: "timing_type", Value: e.Tag},
+				)
+			}
+		}
+	}
+
+	// 校验定时器定义
+	var timing, timingType string
+	for _, item := range node.Properties {
+		switch item.Name {
+		case "timing":
+			timing = item.Value
+		case "timing_type":
+			timingType = item.Value
+		}
+	}
+	if timing != "" {
+		if _, err := ParseTimer(TimerType(timingType), timing); err != nil {
+			return nil, errors.Wrapf(err, "节点(%s)的定时器定义无效", node.Code)
+		}
+	}
+
 	return &node, nil
 }
 
+// 解析子流程的变量映射
+func (p *xmlParser) parseVariableMappings(elements []*etree.Element) []*variableMapping {
+	var mappings []*variableMapping
+	for _, e := range elements {
+		if v := e.SelectAttr("variables"); v != nil && v.Value == "all" {
+			mappings = append(mappings, &variableMapping{All: true})
+			continue
+		}
+
+		var item variableMapping
+		if source := e.SelectAttr("source"); source != nil {
+			item.Source = source.Value
+		}
+		if target := e.SelectAttr("target"); target != nil {
+			item.Target = target.Value
+		}
+		if item.Source != "" {
+			mappings = append(mappings, &item)
+		}
+	}
+	return mappings
+}
+
 func (p *xmlParser) ParsesequenceFlow(element *etree.Element) (*sequenceFlow, error) {
 	hasExpression := false
 	var seq sequenceFlow
@@ -278,6 +574,7 @@ type nodeInfo struct {
 	Code           string
 	Name           string
 	CandidateUsers []string
+	DefaultFlow    string
 	Properties     []*PropertyResult
 	FormResult     *NodeFormResult
 }
@@ -0,0 +1,404 @@
+package register
+
+import (
+	"flow/schema"
+	"flow/service/db"
+)
+
+// FlowMigrations 流程相关的数据库迁移(按版本号顺序执行，已发布的迁移不可修改)
+func FlowMigrations() []db.Migration {
+	return []db.Migration{
+		{
+			Version:     1,
+			Description: "创建流程数据表",
+			Up: func(db *db.DB) error {
+				for _, item := range flowTablesV1() {
+					if err := db.CreateTable(item); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     2,
+			Description: "补充节点表单及定时标志列",
+			Up: func(db *db.DB) error {
+				if err := addColumns(db, schema.NodeTableName, column("form_id", "VARCHAR(36)")); err != nil {
+					return err
+				}
+				return addColumns(db, schema.NodeTimingTableName, column("flag", "VARCHAR(255)"))
+			},
+		},
+		{
+			Version:     3,
+			Description: "创建流程数据表索引",
+			Up: func(db *db.DB) error {
+				for _, item := range flowIndexes() {
+					if err := db.CreateIndexIfNotExists(item); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     4,
+			Description: "XML及输入输出数据列改为大文本",
+			Up: func(db *db.DB) error {
+				for table, columns := range map[string][]string{
+					schema.FlowTableName:           {"xml"},
+					schema.NodeAssignmentTableName: {"expression"},
+					schema.NodeInstanceTableName:   {"input_data", "out_data"},
+					schema.NodeTimingTableName:     {"input"},
+				} {
+					for _, column := range columns {
+						if err := db.ModifyColumnType(table, column, db.LongTextType()); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     5,
+			Description: "流程实例及节点实例增加版本号列",
+			Up: func(db *db.DB) error {
+				if err := addColumns(db, schema.FlowInstanceTableName, column("version", "BIGINT")); err != nil {
+					return err
+				}
+				return addColumns(db, schema.NodeInstanceTableName, column("version", "BIGINT"))
+			},
+		},
+		{
+			Version:     6,
+			Description: "节点定时增加租约列",
+			Up: func(db *db.DB) error {
+				return addColumns(db, schema.NodeTimingTableName,
+					column("owner", "VARCHAR(64)"),
+					column("lease_until", "BIGINT"),
+				)
+			},
+		},
+		{
+			Version:     7,
+			Description: "节点定时增加重试及死信列",
+			Up: func(db *db.DB) error {
+				return addColumns(db, schema.NodeTimingTableName,
+					column("status", "BIGINT"),
+					column("attempts", "BIGINT"),
+					column("last_error", "VARCHAR(1024)"),
+				)
+			},
+		},
+		{
+			Version:     8,
+			Description: "节点实例增加截止时间列",
+			Up: func(db *db.DB) error {
+				return addColumns(db, schema.NodeInstanceTableName, column("due_at", "BIGINT"))
+			},
+		},
+		{
+			Version:     9,
+			Description: "节点定时增加边界事件列",
+			Up: func(db *db.DB) error {
+				return addColumns(db, schema.NodeTimingTableName,
+					column("boundary_node_id", "VARCHAR(36)"),
+					column("cycle", "VARCHAR(255)"),
+				)
+			},
+		},
+		{
+			Version:     10,
+			Description: "创建外部任务表",
+			Up: func(db *db.DB) error {
+				if err := db.CreateTable(externalTaskTableV10()); err != nil {
+					return err
+				}
+
+				for _, item := range externalTaskIndexes() {
+					if err := db.CreateIndexIfNotExists(item); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     11,
+			Description: "节点属性值列改为大文本",
+			Up: func(db *db.DB) error {
+				return db.ModifyColumnType(schema.NodePropertyTableName, "value", db.LongTextType())
+			},
+		},
+		{
+			Version:     12,
+			Description: "流程实例增加父级流程实例列",
+			Up: func(db *db.DB) error {
+				err := addColumns(db, schema.FlowInstanceTableName,
+					column("parent_id", "VARCHAR(36)"),
+					column("parent_node_instance_id", "VARCHAR(36)"),
+				)
+				if err != nil {
+					return err
+				}
+				return db.CreateIndexIfNotExists(subFlowInstanceIndex())
+			},
+		},
+		{
+			Version:     13,
+			Description: "节点实例增加流入路由列",
+			Up: func(db *db.DB) error {
+				return addColumns(db, schema.NodeInstanceTableName, column("router_id", "VARCHAR(36)"))
+			},
+		},
+		{
+			Version:     14,
+			Description: "节点实例增加多实例列",
+			Up: func(db *db.DB) error {
+				err := addColumns(db, schema.NodeInstanceTableName,
+					column("loop_id", "VARCHAR(36)"),
+					column("loop_counter", "BIGINT"),
+					column("loop_data", "VARCHAR(255)"),
+				)
+				if err != nil {
+					return err
+				}
+				return db.ModifyColumnType(schema.NodeInstanceTableName, "loop_data", db.LongTextType())
+			},
+		},
+		{
+			Version:     15,
+			Description: "创建节点路由目标节点索引",
+			Up: func(db *db.DB) error {
+				return db.CreateIndexIfNotExists(nodeRouterTargetIndex())
+			},
+		},
+		{
+			Version:     16,
+			Description: "创建节点实例按节点及状态查询的索引",
+			Up: func(db *db.DB) error {
+				return db.CreateIndexIfNotExists(nodeInstanceStatusIndex())
+			},
+		},
+	}
+}
+
+// 数据列定义(迁移中的列类型使用字面量，不随结构体映射变化)
+func column(name, sqlType string) db.Column {
+	return db.Column{Name: name, Type: sqlType}
+}
+
+// 为表添加不存在的列
+func addColumns(m *db.DB, table string, cols ...db.Column) error {
+	for _, col := range cols {
+		if err := m.AddColumn(table, col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 版本1创建的流程数据表(已发布的表结构，后续变更需要新增迁移)
+func flowTablesV1() []db.Table {
+	base := func(cols ...db.Column) []db.Column {
+		return append(cols,
+			db.Column{Name: "created", Type: "BIGINT"},
+			db.Column{Name: "updated", Type: "BIGINT"},
+			db.Column{Name: "deleted", Type: "BIGINT"},
+		)
+	}
+
+	return []db.Table{
+		{Name: "f_flow", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "code", Type: "VARCHAR(50)"},
+			db.Column{Name: "name", Type: "VARCHAR(50)"},
+			db.Column{Name: "version", Type: "BIGINT"},
+			db.Column{Name: "type_code", Type: "VARCHAR(50)"},
+			db.Column{Name: "xml", Type: "TEXT"},
+			db.Column{Name: "memo", Type: "VARCHAR(255)"},
+			db.Column{Name: "flag", Type: "BIGINT"},
+			db.Column{Name: "parent_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "status", Type: "INT"},
+		)},
+		{Name: "f_node", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "flow_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "code", Type: "VARCHAR(50)"},
+			db.Column{Name: "name", Type: "VARCHAR(50)"},
+			db.Column{Name: "type_code", Type: "VARCHAR(50)"},
+			db.Column{Name: "order_num", Type: "VARCHAR(10)"},
+			db.Column{Name: "form_id", Type: "VARCHAR(36)"},
+		)},
+		{Name: "f_node_router", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "source_node_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "target_node_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "expression", Type: "TEXT"},
+			db.Column{Name: "explain", Type: "VARCHAR(255)"},
+			db.Column{Name: "is_default_target", Type: "BIGINT"},
+		)},
+		{Name: "f_node_assignment", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "node_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "expression", Type: "TEXT"},
+		)},
+		{Name: "f_flow_instance", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "flow_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "status", Type: "BIGINT"},
+			db.Column{Name: "launcher", Type: "VARCHAR(36)"},
+			db.Column{Name: "launch_time", Type: "BIGINT"},
+		)},
+		{Name: "f_node_instance", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "flow_instance_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "node_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "processor", Type: "VARCHAR(36)"},
+			db.Column{Name: "process_time", Type: "BIGINT"},
+			db.Column{Name: "input_data", Type: "TEXT"},
+			db.Column{Name: "out_data", Type: "TEXT"},
+			db.Column{Name: "status", Type: "BIGINT"},
+		)},
+		{Name: "f_node_timing", Columns: []db.Column{
+			{Name: "node_instance_id", Type: "VARCHAR(255)"},
+			{Name: "flag", Type: "VARCHAR(255)"},
+			{Name: "processor", Type: "VARCHAR(36)"},
+			{Name: "input", Type: "TEXT"},
+			{Name: "expired_at", Type: "BIGINT"},
+			{Name: "created", Type: "BIGINT"},
+			{Name: "deleted", Type: "BIGINT"},
+		}},
+		{Name: "f_node_candidate", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "node_instance_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "candidate_id", Type: "VARCHAR(36)"},
+		)},
+		{Name: "f_form", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "flow_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "code", Type: "VARCHAR(50)"},
+			db.Column{Name: "name", Type: "VARCHAR(50)"},
+			db.Column{Name: "type_code", Type: "VARCHAR(50)"},
+			db.Column{Name: "data", Type: "TEXT"},
+		)},
+		{Name: "f_form_field", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "form_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "code", Type: "VARCHAR(50)"},
+			db.Column{Name: "label", Type: "VARCHAR(50)"},
+			db.Column{Name: "type_code", Type: "VARCHAR(50)"},
+			db.Column{Name: "default_value", Type: "VARCHAR(100)"},
+		)},
+		{Name: "f_field_option", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "field_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "value_id", Type: "VARCHAR(50)"},
+			db.Column{Name: "value_name", Type: "VARCHAR(100)"},
+		)},
+		{Name: "f_field_property", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "field_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "code", Type: "VARCHAR(50)"},
+			db.Column{Name: "value", Type: "VARCHAR(100)"},
+		)},
+		{Name: "f_field_validation", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "field_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "constraint_name", Type: "VARCHAR(50)"},
+			db.Column{Name: "constraint_config", Type: "VARCHAR(100)"},
+		)},
+		{Name: "f_node_property", Columns: base(
+			db.Column{Name: "record_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "node_id", Type: "VARCHAR(36)"},
+			db.Column{Name: "name", Type: "VARCHAR(50)"},
+			db.Column{Name: "value", Type: "VARCHAR(255)"},
+		)},
+	}
+}
+
+// 版本10创建的外部任务表
+func externalTaskTableV10() db.Table {
+	return db.Table{Name: "f_external_task", Columns: []db.Column{
+		{Name: "record_id", Type: "VARCHAR(36)"},
+		{Name: "flow_instance_id", Type: "VARCHAR(36)"},
+		{Name: "node_instance_id", Type: "VARCHAR(36)"},
+		{Name: "topic", Type: "VARCHAR(100)"},
+		{Name: "worker_id", Type: "VARCHAR(64)"},
+		{Name: "lock_until", Type: "BIGINT"},
+		{Name: "retries", Type: "BIGINT"},
+		{Name: "error_message", Type: "VARCHAR(1024)"},
+		{Name: "status", Type: "BIGINT"},
+		{Name: "created", Type: "BIGINT"},
+		{Name: "updated", Type: "BIGINT"},
+		{Name: "deleted", Type: "BIGINT"},
+	}}
+}
+
+// 流程数据表索引(流程编号与版本号在未删除的数据中唯一)
+func flowIndexes() []db.Index {
+	var indexes []db.Index
+	for _, table := range []string{
+		schema.FlowTableName,
+		schema.NodeTableName,
+		schema.NodeRouterTableName,
+		schema.NodeAssignmentTableName,
+		schema.NodePropertyTableName,
+		schema.FlowInstanceTableName,
+		schema.NodeInstanceTableName,
+		schema.NodeCandidateTableName,
+		schema.FormTableName,
+		schema.FormFieldTableName,
+		schema.FieldOptionTableName,
+		schema.FieldPropertyTableName,
+		schema.FieldValidationTableName,
+	} {
+		indexes = append(indexes, db.Index{Table: table, Columns: []string{"record_id"}, Unique: true})
+	}
+
+	return append(indexes,
+		db.Index{Table: schema.FlowTableName, Columns: []string{"code", "version", "deleted"}, Unique: true},
+		db.Index{Table: schema.NodeTableName, Columns: []string{"flow_id"}},
+		db.Index{Table: schema.NodeRouterTableName, Columns: []string{"source_node_id"}},
+		db.Index{Table: schema.NodeAssignmentTableName, Columns: []string{"node_id"}},
+		db.Index{Table: schema.NodePropertyTableName, Columns: []string{"node_id"}},
+		db.Index{Table: schema.FlowInstanceTableName, Columns: []string{"flow_id"}},
+		db.Index{Table: schema.FlowInstanceTableName, Columns: []string{"launcher"}},
+		db.Index{Table: schema.NodeInstanceTableName, Columns: []string{"flow_instance_id"}},
+		db.Index{Table: schema.NodeInstanceTableName, Columns: []string{"processor"}},
+		db.Index{Table: schema.NodeTimingTableName, Columns: []string{"node_instance_id"}},
+		db.Index{Table: schema.NodeTimingTableName, Columns: []string{"expired_at"}},
+		db.Index{Table: schema.NodeCandidateTableName, Columns: []string{"node_instance_id"}},
+		db.Index{Table: schema.NodeCandidateTableName, Columns: []string{"candidate_id"}},
+		db.Index{Table: schema.FormFieldTableName, Columns: []string{"form_id"}},
+		db.Index{Table: schema.FieldOptionTableName, Columns: []string{"field_id"}},
+		db.Index{Table: schema.FieldPropertyTableName, Columns: []string{"field_id"}},
+		db.Index{Table: schema.FieldValidationTableName, Columns: []string{"field_id"}},
+	)
+}
+
+// 外部任务表索引
+func externalTaskIndexes() []db.Index {
+	return []db.Index{
+		{Table: schema.ExternalTaskTableName, Columns: []string{"record_id"}, Unique: true},
+		{Table: schema.ExternalTaskTableName, Columns: []string{"topic", "status"}},
+		{Table: schema.ExternalTaskTableName, Columns: []string{"node_instance_id"}},
+	}
+}
+
+// 子流程实例索引(按父级流程实例查询)
+func subFlowInstanceIndex() db.Index {
+	return db.Index{Table: schema.FlowInstanceTableName, Columns: []string{"parent_id"}}
+}
+
+// 节点路由目标节点索引(按流入路由查询)
+func nodeRouterTargetIndex() db.Index {
+	return db.Index{Table: schema.NodeRouterTableName, Columns: []string{"target_node_id"}}
+}
+
+// 节点实例按节点及状态查询的索引(查询等待消息或信号的节点实例)
+func nodeInstanceStatusIndex() db.Index {
+	return db.Index{Table: schema.NodeInstanceTableName, Columns: []string{"node_id", "status"}}
+}
@@ -10,6 +10,7 @@ const (
 	FlowInstanceTableName    = "f_flow_instance"
 	NodeInstanceTableName    = "f_node_instance"
 	NodeTimingTableName      = "f_node_timing"
+	ExternalTaskTableName    = "f_external_task"
 	NodeCandidateTableName   = "f_node_candidate"
 	FormTableName            = "f_form"
 	FormFieldTableName       = "f_form_field"
@@ -26,7 +27,7 @@ type Flow struct {
 	Name     string `db:"name,size:50" structs:"name" json:"name"`                // 流程名称
 	Version  int64  `db:"version" structs:"version" json:"version"`               // 版本号
 	TypeCode string `db:"type_code,size:50" structs:"type_code" json:"type_code"` // 流程类型编号
-	XML      string `db:"xml,size:1024" structs:"xml" json:"xml"`                 // XML数据
+	XML      string `db:"xml" structs:"xml" json:"xml"`                           // XML数据
 	Memo     string `db:"memo,size:255" structs:"memo" json:"memo"`               // 流程备注
 	Flag     int64  `db:"flag" structs:"flag" json:"flag"`                        // 流程标志(1:主流程 2:子流程)
 	ParentID string `db:"parent_id,size:36" structs:"parent_id" json:"parent_id"` // 父级流程内码
@@ -67,13 +68,13 @@ type NodeRouter struct {
 
 // NodeAssignment 节点指派
 type NodeAssignment struct {
-	ID         int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`          // 唯一标识(自增ID)
-	RecordID   string `db:"record_id,size:36" structs:"record_id" json:"record_id"`      // 记录内码(uuid)
-	NodeID     string `db:"node_id,size:36" structs:"node_id" json:"node_id"`            // 节点内码
-	Expression string `db:"expression,size:1024" structs:"expression" json:"expression"` // 执行表达式(基于qlang可提供多种内置函数支持，支持SQL查询)
-	Created    int64  `db:"created" structs:"created" json:"created"`                    // 创建时间戳
-	Updated    int64  `db:"updated" structs:"updated" json:"updated"`                    // 更新时间戳
-	Deleted    int64  `db:"deleted" structs:"deleted" json:"deleted"`                    // 删除时间戳
+	ID         int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`     // 唯一标识(自增ID)
+	RecordID   string `db:"record_id,size:36" structs:"record_id" json:"record_id"` // 记录内码(uuid)
+	NodeID     string `db:"node_id,size:36" structs:"node_id" json:"node_id"`       // 节点内码
+	Expression string `db:"expression" structs:"expression" json:"expression"`      // 执行表达式(基于qlang可提供多种内置函数支持，支持SQL查询)
+	Created    int64  `db:"created" structs:"created" json:"created"`               // 创建时间戳
+	Updated    int64  `db:"updated" structs:"updated" json:"updated"`               // 更新时间戳
+	Deleted    int64  `db:"deleted" structs:"deleted" json:"deleted"`               // 删除时间戳
 }
 
 // NodeProperty 节点属性
@@ -82,7 +83,7 @@ type NodeProperty struct {
 	RecordID string `db:"record_id,size:36" structs:"record_id" json:"record_id"` // 记录内码(uuid)
 	NodeID   string `db:"node_id,size:36" structs:"node_id" json:"node_id"`       // 节点内码
 	Name     string `db:"name,size:50" structs:"name" json:"name"`                // 属性名称
-	Value    string `db:"value,size:255" structs:"value" json:"value"`            // 属性值
+	Value    string `db:"value" structs:"value" json:"value"`                     // 属性值
 	Created  int64  `db:"created" structs:"created" json:"created"`               // 创建时间戳
 	Updated  int64  `db:"updated" structs:"updated" json:"updated"`               // 更新时间戳
 	Deleted  int64  `db:"deleted" structs:"deleted" json:"deleted"`               // 删除时间戳
@@ -90,15 +91,18 @@ type NodeProperty struct {
 
 // FlowInstance 流程实例
 type FlowInstance struct {
-	ID         int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`     // 唯一标识(自增ID)
-	RecordID   string `db:"record_id,size:36" structs:"record_id" json:"record_id"` // 记录内码(uuid)
-	FlowID     string `db:"flow_id,size:36" structs:"flow_id" json:"flow_id"`       // 流程内码
-	Status     int64  `db:"status" structs:"status" json:"status"`                  // 流程状态(0:未开始 1:进行中 2:暂停 3:已停止 9:已完成)
-	Launcher   string `db:"launcher,size:36" structs:"launcher" json:"launcher"`    // 发起人
-	LaunchTime int64  `db:"launch_time" structs:"launch_time" json:"launch_time"`   // 发起时间
-	Created    int64  `db:"created" structs:"created" json:"created"`               // 创建时间戳
-	Updated    int64  `db:"updated" structs:"updated" json:"updated"`               // 更新时间戳
-	Deleted    int64  `db:"deleted" structs:"deleted" json:"deleted"`               // 删除时间戳
+	ID                   int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                                               // 唯一标识(自增ID)
+	RecordID             string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                                           // 记录内码(uuid)
+	FlowID               string `db:"flow_id,size:36" structs:"flow_id" json:"flow_id"`                                                 // 流程内码
+	Status               int64  `db:"status" structs:"status" json:"status"`                                                            // 流程状态(0:未开始 1:进行中 2:暂停 3:已停止 9:已完成)
+	Launcher             string `db:"launcher,size:36" structs:"launcher" json:"launcher"`                                              // 发起人
+	LaunchTime           int64  `db:"launch_time" structs:"launch_time" json:"launch_time"`                                             // 发起时间
+	Version              int64  `db:"version" structs:"version" json:"version"`                                                         // 版本号(乐观锁)
+	ParentID             string `db:"parent_id,size:36" structs:"parent_id" json:"parent_id"`                                           // 父级流程实例内码(子流程实例)
+	ParentNodeInstanceID string `db:"parent_node_instance_id,size:36" structs:"parent_node_instance_id" json:"parent_node_instance_id"` // 父级流程中调用子流程的节点实例内码
+	Created              int64  `db:"created" structs:"created" json:"created"`                                                         // 创建时间戳
+	Updated              int64  `db:"updated" structs:"updated" json:"updated"`                                                         // 更新时间戳
+	Deleted              int64  `db:"deleted" structs:"deleted" json:"deleted"`                                                         // 删除时间戳
 }
 
 // NodeInstance 节点实例表
@@ -107,11 +111,17 @@ type NodeInstance struct {
 	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
 	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
 	NodeID         string `db:"node_id,size:36" structs:"node_id" json:"node_id"`                            // 节点内码
+	RouterID       string `db:"router_id,size:36" structs:"router_id" json:"router_id"`                      // 流入路由内码(网关汇聚时区分流入路径)
 	Processor      string `db:"processor,size:36" structs:"processor" json:"processor"`                      // 处理人
 	ProcessTime    int64  `db:"process_time" structs:"process_time" json:"process_time"`                     // 处理时间(秒时间戳)
-	InputData      string `db:"input_data,size:1024" structs:"input_data" json:"input_data"`                 // 输入数据
-	OutData        string `db:"out_data,size:1024" structs:"out_data" json:"out_data"`                       // 输出数据
-	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 处理状态(1:待处理 2:已完成)
+	InputData      string `db:"input_data" structs:"input_data" json:"input_data"`                           // 输入数据
+	OutData        string `db:"out_data" structs:"out_data" json:"out_data"`                                 // 输出数据
+	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 处理状态(1:待处理 2:已完成 3:已取消)
+	Version        int64  `db:"version" structs:"version" json:"version"`                                    // 版本号(乐观锁)
+	DueAt          int64  `db:"due_at" structs:"due_at" json:"due_at"`                                       // 截止时间戳(0:未设定)
+	LoopID         string `db:"loop_id,size:36" structs:"loop_id" json:"loop_id"`                            // 多实例激活内码(同一次激活的多实例相同)
+	LoopCounter    int64  `db:"loop_counter" structs:"loop_counter" json:"loop_counter"`                     // 多实例序号(从0开始)
+	LoopData       string `db:"loop_data" structs:"loop_data" json:"loop_data"`                              // 多实例集合(JSON)
 	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
 	Updated        int64  `db:"updated" structs:"updated" json:"updated"`                                    // 更新时间戳
 	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
@@ -119,14 +129,38 @@ type NodeInstance struct {
 
 // NodeTiming 节点定时
 type NodeTiming struct {
-	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                  // 唯一标识(自增ID)
-	NodeInstanceID string `db:"node_instance_id" structs:"node_instance_id" json:"node_instance_id"` // 节点实例ID
-	Flag           string `db:"flag" structs:"flag" json:"flag"`                                     // 标志
-	Processor      string `db:"processor,size:36" structs:"processor" json:"processor"`              // 处理人
-	Input          string `db:"input,size:1024" structs:"input" json:"input"`                        // 输入数据
-	ExpiredAt      int64  `db:"expired_at" structs:"expired_at" json:"expired_at"`                   // 过期时间戳
-	Created        int64  `db:"created" structs:"created" json:"created"`                            // 创建时间戳
-	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                            // 删除时间戳
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	NodeInstanceID string `db:"node_instance_id" structs:"node_instance_id" json:"node_instance_id"`         // 节点实例ID
+	Flag           string `db:"flag" structs:"flag" json:"flag"`                                             // 标志
+	Processor      string `db:"processor,size:36" structs:"processor" json:"processor"`                      // 处理人
+	Input          string `db:"input" structs:"input" json:"input"`                                          // 输入数据
+	ExpiredAt      int64  `db:"expired_at" structs:"expired_at" json:"expired_at"`                           // 过期时间戳
+	Owner          string `db:"owner,size:64" structs:"owner" json:"owner"`                                  // 租约持有者(处理该定时的引擎实例)
+	LeaseUntil     int64  `db:"lease_until" structs:"lease_until" json:"lease_until"`                        // 租约到期时间戳
+	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 状态(0:等待执行 1:死信)
+	Attempts       int64  `db:"attempts" structs:"attempts" json:"attempts"`                                 // 已失败的执行次数
+	LastError      string `db:"last_error,size:1024" structs:"last_error" json:"last_error"`                 // 最后一次执行的错误信息
+	BoundaryNodeID string `db:"boundary_node_id,size:36" structs:"boundary_node_id" json:"boundary_node_id"` // 边界事件节点内码(为空时自动处理节点实例)
+	Cycle          string `db:"cycle" structs:"cycle" json:"cycle"`                                          // 触发后剩余的循环定时(非中断边界事件)
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
+}
+
+// ExternalTask 外部任务(由外部工作者领取执行的服务任务)
+type ExternalTask struct {
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
+	NodeInstanceID string `db:"node_instance_id,size:36" structs:"node_instance_id" json:"node_instance_id"` // 节点实例内码
+	Topic          string `db:"topic,size:100" structs:"topic" json:"topic"`                                 // 主题
+	WorkerID       string `db:"worker_id,size:64" structs:"worker_id" json:"worker_id"`                      // 领取任务的工作者
+	LockUntil      int64  `db:"lock_until" structs:"lock_until" json:"lock_until"`                           // 锁定到期时间戳
+	Retries        int64  `db:"retries" structs:"retries" json:"retries"`                                    // 剩余重试次数
+	ErrorMessage   string `db:"error_message,size:1024" structs:"error_message" json:"error_message"`        // 最后一次执行的错误信息
+	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 状态(0:待执行 1:已完成 2:执行失败)
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Updated        int64  `db:"updated" structs:"updated" json:"updated"`                                    // 更新时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
 }
 
 // NodeCandidate 节点候选人
@@ -242,17 +276,17 @@ type FlowTodoResult struct {
 
 // FlowHistoryResult 流程历史结果
 type FlowHistoryResult struct {
-	RecordID    string  `db:"record_id,size:36" structs:"record_id" json:"record_id"`      // 记录内码(uuid)
-	NodeID      string  `db:"node_id,size:36" structs:"node_id" json:"node_id"`            // 节点ID
-	NodeCode    string  `db:"node_code,size:36" structs:"node_code" json:"node_code"`      // 节点编号
-	NodeName    string  `db:"node_name,size:36" structs:"node_name" json:"node_name"`      // 节点名称
-	Processor   string  `db:"processor,size:36" structs:"processor" json:"processor"`      // 处理人
-	ProcessTime int64   `db:"process_time" structs:"process_time" json:"process_time"`     // 处理时间(秒时间戳)
-	InputData   string  `db:"input_data,size:1024" structs:"input_data" json:"input_data"` // 输入数据
-	OutData     string  `db:"out_data,size:1024" structs:"out_data" json:"out_data"`       // 输出数据
-	Status      int64   `db:"status" structs:"status" json:"status"`                       // 处理状态(1:待处理 2:已完成)
-	FormType    *string `db:"form_type" structs:"form_type" json:"form_type"`              // 表单类型
-	FormData    *string `db:"form_data" structs:"form_data" json:"form_data"`              // 表单数据
+	RecordID    string  `db:"record_id,size:36" structs:"record_id" json:"record_id"`  // 记录内码(uuid)
+	NodeID      string  `db:"node_id,size:36" structs:"node_id" json:"node_id"`        // 节点ID
+	NodeCode    string  `db:"node_code,size:36" structs:"node_code" json:"node_code"`  // 节点编号
+	NodeName    string  `db:"node_name,size:36" structs:"node_name" json:"node_name"`  // 节点名称
+	Processor   string  `db:"processor,size:36" structs:"processor" json:"processor"`  // 处理人
+	ProcessTime int64   `db:"process_time" structs:"process_time" json:"process_time"` // 处理时间(秒时间戳)
+	InputData   string  `db:"input_data" structs:"input_data" json:"input_data"`       // 输入数据
+	OutData     string  `db:"out_data" structs:"out_data" json:"out_data"`             // 输出数据
+	Status      int64   `db:"status" structs:"status" json:"status"`                   // 处理状态(1:待处理 2:已完成)
+	FormType    *string `db:"form_type" structs:"form_type" json:"form_type"`          // 表单类型
+	FormData    *string `db:"form_data" structs:"form_data" json:"form_data"`          // 表单数据
 }
 
 // FlowDoneResult 流程已办结果
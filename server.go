@@ -123,6 +123,10 @@ func newRouterMiddleware(srv *Server) gear.Handler {
 	router.Get("/flow/:id", api.GetFlow)
 	router.Delete("/flow/:id", api.DeleteFlow)
 	router.Post("/flow", api.SaveFlow)
+	router.Post("/external-task/fetch-and-lock", api.FetchAndLockExternalTask)
+	router.Post("/external-task/:id/complete", api.CompleteExternalTask)
+	router.Post("/external-task/:id/failure", api.HandleExternalTaskFailure)
+	router.Post("/external-task/:id/extend-lock", api.ExtendExternalTaskLock)
 
 	return router
 }
@@ -0,0 +1,99 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flow/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerExternalTask(t *testing.T) {
+	e, err := new(Engine).InitWithStore(NewXMLParser(), NewQLangExecer(), model.NewMemory())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = e.LoadFile("test_data/external_task.bpmn")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = e.StartFlow(context.Background(), "process_external_task", "node_start", "T001", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	srv := new(Server).Init(e)
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(buf))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/external-task/fetch-and-lock", map[string]interface{}{
+		"worker_id":     "worker1",
+		"topic":         "credit-check",
+		"max_tasks":     1,
+		"lock_duration": 60000,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("领取外部任务发生错误：%d %s", w.Code, w.Body.String())
+	}
+
+	var tasks []*LockedExternalTask
+	err = json.Unmarshal(w.Body.Bytes(), &tasks)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(tasks) != 1 || tasks[0].WorkerID != "worker1" {
+		t.Fatalf("无效的外部任务：%s", w.Body.String())
+	}
+
+	// 未锁定任务的工作者不能处理任务
+	w = post("/api/external-task/"+tasks[0].RecordID+"/complete", map[string]interface{}{"worker_id": "worker2"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("其他工作者完成任务应返回409：%d %s", w.Code, w.Body.String())
+	}
+
+	w = post("/api/external-task/"+tasks[0].RecordID+"/extend-lock", map[string]interface{}{
+		"worker_id":    "worker1",
+		"new_duration": 60000,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("延长锁定发生错误：%d %s", w.Code, w.Body.String())
+	}
+
+	w = post("/api/external-task/"+tasks[0].RecordID+"/complete", map[string]interface{}{
+		"worker_id": "worker1",
+		"variables": map[string]interface{}{"approver": "T002"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("完成外部任务发生错误：%d %s", w.Code, w.Body.String())
+	}
+
+	var result HandleResult
+	err = json.Unmarshal(w.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(result.NextNodes) != 1 {
+		t.Fatalf("无效的处理结果：%s", w.Body.String())
+	}
+
+	// 已完成或不存在的任务返回404
+	for _, id := range []string{tasks[0].RecordID, "unknown"} {
+		w = post("/api/external-task/"+id+"/failure", map[string]interface{}{"worker_id": "worker1"})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("无效的外部任务应返回404：%d %s", w.Code, w.Body.String())
+		}
+	}
+
+	w = post("/api/external-task/fetch-and-lock", map[string]interface{}{"worker_id": "worker1"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("无效的请求应返回400：%d", w.Code)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 	"github.com/LyricTian/retry"
@@ -36,7 +37,15 @@ func (l *dbLogger) Printf(format string, v ...interface{}) {
 	l.logger.Printf(format, v...)
 }
 
+// 支持的数据库方言
+const (
+	DialectMySQL    = "mysql"    // MySQL
+	DialectSQLite   = "sqlite3"  // SQLite
+	DialectPostgres = "postgres" // PostgreSQL
+)
+
 type options struct {
+	dialect      string        // 数据库方言(同时作为驱动名称)
 	dsn          string        // 连接串
 	trace        bool          // 追踪调试
 	maxLifetime  time.Duration // 设置连接可以被重新使用的最大时间量
@@ -47,6 +56,13 @@ type options struct {
 // Option 配置项
 type Option func(*options)
 
+// SetDialect 设置数据库方言(默认MySQL)
+func SetDialect(dialect string) Option {
+	return func(o *options) {
+		o.dialect = dialect
+	}
+}
+
 // SetDSN 设置连接串
 func SetDSN(dsn string) Option {
 	return func(o *options) {
@@ -85,6 +101,28 @@ func SetMaxIdleConns(maxIdleConns int) Option {
 // DB 数据库
 type DB struct {
 	*gorp.DbMap
+	dialect string
+}
+
+// NewDB 根据配置的方言创建数据库实例
+func NewDB(opts ...Option) (*DB, error) {
+	o := &options{
+		dialect:      DialectMySQL,
+		maxLifetime:  time.Hour * 2,
+		maxOpenConns: 150,
+		maxIdleConns: 50,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	db, err := open(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithDB(db, o.dialect, o.trace)
 }
 
 // NewMySQL 创建MySQL数据库实例
@@ -98,11 +136,21 @@ func NewMySQL(opts ...Option) (*sql.DB, bool, error) {
 	for _, opt := range opts {
 		opt(o)
 	}
+	o.dialect = DialectMySQL
 
-	db, err := sql.Open("mysql", o.dsn)
+	db, err := open(o)
 	if err != nil {
 		return nil, o.trace, err
 	}
+	return db, o.trace, nil
+}
+
+// 打开数据库连接
+func open(o *options) (*sql.DB, error) {
+	db, err := sql.Open(o.dialect, o.dsn)
+	if err != nil {
+		return nil, err
+	}
 
 	// 尝试发送Ping包
 	err = retry.DoFunc(3, func() error {
@@ -115,24 +163,152 @@ func NewMySQL(opts ...Option) (*sql.DB, bool, error) {
 		return time.Second
 	})
 	if err != nil {
-		return nil, o.trace, err
+		return nil, err
 	}
 
 	db.SetMaxOpenConns(o.maxOpenConns)
 	db.SetMaxIdleConns(o.maxIdleConns)
 	db.SetConnMaxLifetime(o.maxLifetime)
 
-	return db, o.trace, nil
+	return db, nil
 }
 
 // NewMySQLWithDB 创建DB
 func NewMySQLWithDB(db *sql.DB, trace bool) *DB {
-	dbMap := &gorp.DbMap{Db: db, Dialect: gorp.MySQLDialect{Encoding: "UTF8", Engine: "InnoDB"}}
+	m, _ := NewWithDB(db, DialectMySQL, trace)
+	return m
+}
+
+// NewWithDB 使用指定的方言创建DB
+func NewWithDB(db *sql.DB, dialect string, trace bool) (*DB, error) {
+	var d gorp.Dialect
+	switch dialect {
+	case DialectMySQL:
+		d = gorp.MySQLDialect{Encoding: "UTF8", Engine: "InnoDB"}
+	case DialectSQLite:
+		d = gorp.SqliteDialect{}
+	case DialectPostgres:
+		d = gorp.PostgresDialect{}
+	default:
+		return nil, fmt.Errorf("不支持的数据库方言：%s", dialect)
+	}
+
+	dbMap := &gorp.DbMap{Db: db, Dialect: d}
 	if trace {
 		dbMap.TraceOn("[db]", new(dbLogger).Init())
 	}
 
-	return &DB{dbMap}
+	return &DB{DbMap: dbMap, dialect: dialect}, nil
+}
+
+// DialectName 获取数据库方言
+func (m *DB) DialectName() string {
+	return m.dialect
+}
+
+// JSONField 获取JSON列中指定字段的文本取值表达式
+func (m *DB) JSONField(column, key string) string {
+	switch m.dialect {
+	case DialectSQLite:
+		return fmt.Sprintf("CAST(json_extract(%s,'$.%s') AS TEXT)", column, key)
+	case DialectPostgres:
+		return fmt.Sprintf("(%s::jsonb->>'%s')", column, key)
+	}
+	return fmt.Sprintf("%s->>'$.%s'", column, key)
+}
+
+// Rebind 将查询语句中的?占位符转换为当前方言的占位符(PostgreSQL使用$n)
+func (m *DB) Rebind(query string) string {
+	if m.dialect != DialectPostgres {
+		return query
+	}
+
+	var (
+		buf    bytes.Buffer
+		n      int
+		quoted bool
+	)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			buf.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// Select 查询数据列表(占位符按方言转换)
+func (m *DB) Select(i interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	return m.DbMap.Select(i, m.Rebind(query), args...)
+}
+
+// SelectOne 查询单条数据(占位符按方言转换)
+func (m *DB) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	return m.DbMap.SelectOne(holder, m.Rebind(query), args...)
+}
+
+// SelectInt 查询整型值(占位符按方言转换)
+func (m *DB) SelectInt(query string, args ...interface{}) (int64, error) {
+	return m.DbMap.SelectInt(m.Rebind(query), args...)
+}
+
+// SelectStr 查询字符串值(占位符按方言转换)
+func (m *DB) SelectStr(query string, args ...interface{}) (string, error) {
+	return m.DbMap.SelectStr(m.Rebind(query), args...)
+}
+
+// Exec 执行SQL(占位符按方言转换)
+func (m *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return m.DbMap.Exec(m.Rebind(query), args...)
+}
+
+// Executor 数据库执行接口(DB及Trans均实现)
+type Executor interface {
+	Insert(list ...interface{}) error
+	Select(i interface{}, query string, args ...interface{}) ([]interface{}, error)
+	SelectOne(holder interface{}, query string, args ...interface{}) error
+	SelectInt(query string, args ...interface{}) (int64, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Trans 数据库事务
+type Trans struct {
+	*gorp.Transaction
+	db *DB
+}
+
+// Begin 开启事务
+func (m *DB) Begin() (*Trans, error) {
+	tran, err := m.DbMap.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Trans{Transaction: tran, db: m}, nil
+}
+
+// Select 查询数据列表(占位符按方言转换)
+func (t *Trans) Select(i interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	return t.Transaction.Select(i, t.db.Rebind(query), args...)
+}
+
+// SelectOne 查询单条数据(占位符按方言转换)
+func (t *Trans) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	return t.Transaction.SelectOne(holder, t.db.Rebind(query), args...)
+}
+
+// SelectInt 查询整型值(占位符按方言转换)
+func (t *Trans) SelectInt(query string, args ...interface{}) (int64, error) {
+	return t.Transaction.SelectInt(t.db.Rebind(query), args...)
+}
+
+// Exec 执行SQL(占位符按方言转换)
+func (t *Trans) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Transaction.Exec(t.db.Rebind(query), args...)
 }
 
 // Close 关闭数据库连接
@@ -176,7 +352,7 @@ func (m *DB) InsertM(table string, info M) (int64, error) {
 // InsertMWithTran 使用事物插入数据
 func (m *DB) InsertMWithTran(tran *gorp.Transaction, table string, info M) (int64, error) {
 	q, vals := m.InsertSQL(table, info)
-	result, err := tran.Exec(q, vals...)
+	result, err := tran.Exec(m.Rebind(q), vals...)
 	if err != nil {
 		return 0, err
 	}
@@ -185,7 +361,7 @@ func (m *DB) InsertMWithTran(tran *gorp.Transaction, table string, info M) (int6
 	return lastInsertID, nil
 }
 
-// UpdateSQL 获取更新SQL
+// UpdateSQL 获取更新SQL(按字段名排序，保证生成的SQL稳定)
 func (m *DB) UpdateSQL(table string, pk, info M) (string, []interface{}) {
 	q := fmt.Sprintf("UPDATE %s SET", table)
 
@@ -194,23 +370,32 @@ func (m *DB) UpdateSQL(table string, pk, info M) (string, []interface{}) {
 		vals []interface{}
 	)
 
-	for k, v := range info {
+	for _, k := range sortedKeys(info) {
 		cols = append(cols, fmt.Sprintf("%s=?", k))
-		vals = append(vals, v)
+		vals = append(vals, info[k])
 	}
 
 	q = fmt.Sprintf("%s %s", q, strings.Join(cols, ","))
 	cols = nil
 
-	for k, v := range pk {
+	for _, k := range sortedKeys(pk) {
 		cols = append(cols, fmt.Sprintf("%s=?", k))
-		vals = append(vals, v)
+		vals = append(vals, pk[k])
 	}
 
 	q = fmt.Sprintf("%s WHERE %s", q, strings.Join(cols, " and "))
 	return q, vals
 }
 
+func sortedKeys(m M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // UpdateByPK 更新表数据
 func (m *DB) UpdateByPK(table string, pk, info M) (int64, error) {
 	q, vals := m.UpdateSQL(table, pk, info)
@@ -230,7 +415,7 @@ func (m *DB) UpdateByPK(table string, pk, info M) (int64, error) {
 // UpdateByPKWithTran 使用事物更新表数据
 func (m *DB) UpdateByPKWithTran(tran *gorp.Transaction, table string, pk, info M) (int64, error) {
 	q, vals := m.UpdateSQL(table, pk, info)
-	result, err := tran.Exec(q, vals...)
+	result, err := tran.Exec(m.Rebind(q), vals...)
 	if err != nil {
 		return 0, err
 	}
@@ -280,7 +465,7 @@ func (m *DB) DeleteByPK(table string, pk M) (int64, error) {
 // DeleteByPKWithTran 使用事物删除表数据
 func (m *DB) DeleteByPKWithTran(tran *gorp.Transaction, table string, pk M) (int64, error) {
 	q, vals := m.DeleteSQL(table, pk)
-	result, err := tran.Exec(q, vals...)
+	result, err := tran.Exec(m.Rebind(q), vals...)
 	if err != nil {
 		return 0, err
 	}
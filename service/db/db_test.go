@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	query := "SELECT * FROM t WHERE a=? AND b IN(?,?) AND c!='?'"
+
+	m := &DB{dialect: DialectMySQL}
+	if v := m.Rebind(query); v != query {
+		t.Fatalf("无效的查询语句：%s", v)
+	}
+
+	m = &DB{dialect: DialectPostgres}
+	if v := m.Rebind(query); v != "SELECT * FROM t WHERE a=$1 AND b IN($2,$3) AND c!='?'" {
+		t.Fatalf("无效的查询语句：%s", v)
+	}
+}
+
+func TestAddColumnSQL(t *testing.T) {
+	m := &DB{dialect: DialectMySQL}
+	if v := m.addColumnSQL("t", Column{Name: "c", Type: "VARCHAR(1024)"}); v != "ALTER TABLE t ADD COLUMN c VARCHAR(1024) NOT NULL DEFAULT ''" {
+		t.Fatalf("无效的添加列语句：%s", v)
+	}
+	if v := m.addColumnSQL("t", Column{Name: "c", Type: "text"}); v != "ALTER TABLE t ADD COLUMN c text NOT NULL" {
+		t.Fatalf("MySQL大文本列不能设置默认值：%s", v)
+	}
+	if v := m.addColumnSQL("t", Column{Name: "c", Type: "BIGINT"}); v != "ALTER TABLE t ADD COLUMN c BIGINT NOT NULL DEFAULT 0" {
+		t.Fatalf("无效的添加列语句：%s", v)
+	}
+
+	m = &DB{dialect: DialectPostgres}
+	if v := m.addColumnSQL("t", Column{Name: "c", Type: "TEXT"}); v != "ALTER TABLE t ADD COLUMN c TEXT NOT NULL DEFAULT ''" {
+		t.Fatalf("无效的添加列语句：%s", v)
+	}
+}
@@ -0,0 +1,369 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaVersionTableName 数据库版本表名
+const SchemaVersionTableName = "schema_version"
+
+// 数据库迁移锁
+const (
+	migrationLockName    = "flow_schema_migration" // MySQL命名锁名称
+	migrationLockKey     = 7236140539              // PostgreSQL咨询锁键
+	migrationLockTimeout = 600                     // MySQL获取命名锁的超时时间(秒)
+)
+
+// SQLite不支持咨询锁，同一进程内的迁移互斥执行
+var sqliteMigrationLock sync.Mutex
+
+// Migration 数据库迁移项
+type Migration struct {
+	Version     int             // 版本号(递增且唯一)
+	Description string          // 描述
+	Up          func(*DB) error // 升级操作
+}
+
+// 按版本号排序并校验版本号唯一
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	items := make([]Migration, len(migrations))
+	copy(items, migrations)
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Version < items[j].Version
+	})
+
+	for i, item := range items {
+		if item.Version <= 0 {
+			return nil, errors.Errorf("无效的迁移版本号：%d", item.Version)
+		} else if i > 0 && items[i-1].Version == item.Version {
+			return nil, errors.Errorf("重复的迁移版本号：%d", item.Version)
+		}
+	}
+	return items, nil
+}
+
+// 创建数据库版本表
+func (m *DB) createSchemaVersionTable() error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY, description VARCHAR(255) NOT NULL, applied_at BIGINT NOT NULL)", SchemaVersionTableName)
+	_, err := m.Exec(query)
+	if err != nil {
+		return errors.Wrapf(err, "创建数据库版本表发生错误")
+	}
+	return nil
+}
+
+// 查询已执行的迁移版本
+func (m *DB) appliedVersions() (map[int]bool, error) {
+	var items []struct {
+		Version int `db:"version"`
+	}
+	_, err := m.Select(&items, fmt.Sprintf("SELECT version FROM %s", SchemaVersionTableName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询数据库版本发生错误")
+	}
+
+	versions := make(map[int]bool, len(items))
+	for _, item := range items {
+		versions[item.Version] = true
+	}
+	return versions, nil
+}
+
+// PendingMigrations 获取尚未执行的迁移项
+func (m *DB) PendingMigrations(migrations []Migration) ([]Migration, error) {
+	items, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.createSchemaVersionTable()
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, item := range items {
+		if !versions[item.Version] {
+			pending = append(pending, item)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate 按版本号顺序执行尚未执行的迁移(持有迁移锁，多个实例同时启动时依次执行)
+func (m *DB) Migrate(migrations []Migration) error {
+	unlock, err := m.lockMigration()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// 获取锁后再查询，跳过其他实例已执行的迁移
+	pending, err := m.PendingMigrations(migrations)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range pending {
+		err = item.Up(m)
+		if err != nil {
+			return errors.Wrapf(err, "执行数据库迁移(%d:%s)发生错误", item.Version, item.Description)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s(version,description,applied_at) VALUES(?,?,?)", SchemaVersionTableName)
+		_, err = m.Exec(query, item.Version, item.Description, time.Now().Unix())
+		if err != nil {
+			return errors.Wrapf(err, "记录数据库版本(%d)发生错误", item.Version)
+		}
+	}
+	return nil
+}
+
+// 获取数据库迁移锁，返回释放锁的函数
+// MySQL/PostgreSQL在专用连接上持有会话级的命名锁/咨询锁，连接断开时自动释放；SQLite仅在进程内互斥
+func (m *DB) lockMigration() (func(), error) {
+	if m.dialect == DialectSQLite {
+		sqliteMigrationLock.Lock()
+		return sqliteMigrationLock.Unlock, nil
+	}
+
+	ctx := context.Background()
+	conn, err := m.Db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "获取数据库迁移锁的连接发生错误")
+	}
+
+	var release string
+	var args []interface{}
+	switch m.dialect {
+	case DialectPostgres:
+		release, args = "SELECT pg_advisory_unlock($1)", []interface{}{migrationLockKey}
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", args...)
+	default:
+		release, args = "SELECT RELEASE_LOCK(?)", []interface{}{migrationLockName}
+		var locked sql.NullInt64
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?,?)", migrationLockName, migrationLockTimeout).Scan(&locked)
+		if err == nil && locked.Int64 != 1 {
+			err = errors.New("等待其他实例执行迁移超时")
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "获取数据库迁移锁发生错误")
+	}
+
+	return func() {
+		_, _ = conn.ExecContext(ctx, release, args...)
+		_ = conn.Close()
+	}, nil
+}
+
+// VerifyMigrations 校验迁移是否已全部执行
+func (m *DB) VerifyMigrations(migrations []Migration) error {
+	pending, err := m.PendingMigrations(migrations)
+	if err != nil {
+		return err
+	} else if len(pending) == 0 {
+		return nil
+	}
+
+	versions := make([]string, len(pending))
+	for i, item := range pending {
+		versions[i] = fmt.Sprintf("%d:%s", item.Version, item.Description)
+	}
+	return errors.Errorf("数据库存在未执行的迁移：%s", strings.Join(versions, ","))
+}
+
+// Column 数据列定义
+type Column struct {
+	Name string // 列名
+	Type string // 数据类型(如BIGINT、VARCHAR(36)、TEXT)
+}
+
+// Table 数据表定义(自增主键id列自动添加)
+type Table struct {
+	Name    string   // 表名
+	Columns []Column // 数据列
+}
+
+// CreateTable 按数据表定义创建不存在的表(用于迁移，表结构不随结构体映射变化)
+func (m *DB) CreateTable(table Table) error {
+	var pk, suffix string
+	switch m.dialect {
+	case DialectSQLite:
+		pk = "INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT"
+	case DialectPostgres:
+		pk = "BIGSERIAL NOT NULL PRIMARY KEY"
+	default:
+		pk, suffix = "BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT", " ENGINE=InnoDB CHARSET=UTF8"
+	}
+
+	cols := []string{fmt.Sprintf("%s %s", m.Dialect.QuoteField("id"), pk)}
+	for _, col := range table.Columns {
+		cols = append(cols, fmt.Sprintf("%s %s", m.Dialect.QuoteField(col.Name), col.Type))
+	}
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)%s", m.Dialect.QuotedTableForQuery("", table.Name), strings.Join(cols, ", "), suffix)
+	_, err := m.Exec(query)
+	if err != nil {
+		return errors.Wrapf(err, "创建数据表(%s)发生错误", table.Name)
+	}
+	return nil
+}
+
+// HasColumn 检查表中是否存在指定列
+func (m *DB) HasColumn(table, column string) (bool, error) {
+	var query string
+	switch m.dialect {
+	case DialectSQLite:
+		query = "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?"
+	case DialectPostgres:
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=? AND column_name=?"
+	default:
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema=DATABASE() AND table_name=? AND column_name=?"
+	}
+
+	n, err := m.SelectInt(query, table, column)
+	if err != nil {
+		return false, errors.Wrapf(err, "查询数据表(%s)的列信息发生错误", table)
+	}
+	return n > 0, nil
+}
+
+// AddColumn 为表添加不存在的列(用于迁移，列定义不随结构体映射变化)
+func (m *DB) AddColumn(table string, col Column) error {
+	exists, err := m.HasColumn(table, col.Name)
+	if err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	_, err = m.Exec(m.addColumnSQL(table, col))
+	if err != nil {
+		return errors.Wrapf(err, "添加数据列(%s.%s)发生错误", table, col.Name)
+	}
+	return nil
+}
+
+// 获取添加列的语句(新增列不允许为空，已有数据使用零值填充)
+// MySQL严格模式不允许大文本列设置默认值，已有数据使用隐式默认值(空字符串)填充
+func (m *DB) addColumnSQL(table string, col Column) string {
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s NOT NULL", table, col.Name, col.Type)
+	if m.dialect == DialectMySQL && isTextType(col.Type) {
+		return query
+	}
+	return fmt.Sprintf("%s DEFAULT %s", query, zeroValue(col.Type))
+}
+
+// LongTextType 获取当前方言下不限长度的大文本类型
+func (m *DB) LongTextType() string {
+	if m.dialect == DialectMySQL {
+		return "LONGTEXT"
+	}
+	return "TEXT"
+}
+
+// ModifyColumnType 修改列的数据类型(SQLite不校验列类型及长度，无需修改)
+func (m *DB) ModifyColumnType(table, column, sqlType string) error {
+	var query string
+	switch m.dialect {
+	case DialectSQLite:
+		return nil
+	case DialectPostgres:
+		query = fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", table, column, sqlType)
+	default:
+		query = fmt.Sprintf("ALTER TABLE %s MODIFY %s %s", table, column, sqlType)
+	}
+
+	_, err := m.Exec(query)
+	if err != nil {
+		return errors.Wrapf(err, "修改数据列(%s.%s)类型发生错误", table, column)
+	}
+	return nil
+}
+
+// 获取数据库类型的零值(用于新增列的默认值)
+func zeroValue(sqlType string) string {
+	sqlType = strings.ToLower(sqlType)
+	if strings.Contains(sqlType, "char") || strings.Contains(sqlType, "text") {
+		return "''"
+	}
+	return "0"
+}
+
+// 检查是否为大文本类型(TEXT、MEDIUMTEXT、LONGTEXT等)
+func isTextType(sqlType string) bool {
+	return strings.HasSuffix(strings.ToLower(sqlType), "text")
+}
+
+// Index 数据表索引
+type Index struct {
+	Table   string   // 表名
+	Columns []string // 索引列
+	Unique  bool     // 是否唯一索引
+}
+
+// Name 获取索引名称(uk_/idx_ + 表名 + 列名)
+func (i Index) Name() string {
+	prefix := "idx"
+	if i.Unique {
+		prefix = "uk"
+	}
+	return fmt.Sprintf("%s_%s_%s", prefix, i.Table, strings.Join(i.Columns, "_"))
+}
+
+// HasIndex 检查表中是否存在指定名称的索引
+func (m *DB) HasIndex(table, name string) (bool, error) {
+	var query string
+	switch m.dialect {
+	case DialectSQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type='index' AND tbl_name=? AND name=?"
+	case DialectPostgres:
+		query = "SELECT COUNT(*) FROM pg_indexes WHERE schemaname=current_schema() AND tablename=? AND indexname=?"
+	default:
+		query = "SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema=DATABASE() AND table_name=? AND index_name=?"
+	}
+
+	n, err := m.SelectInt(query, table, name)
+	if err != nil {
+		return false, errors.Wrapf(err, "查询数据表(%s)的索引信息发生错误", table)
+	}
+	return n > 0, nil
+}
+
+// CreateIndexIfNotExists 创建不存在的索引
+func (m *DB) CreateIndexIfNotExists(index Index) error {
+	name := index.Name()
+	exists, err := m.HasIndex(index.Table, name)
+	if err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	var unique string
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+
+	query := fmt.Sprintf("CREATE %sINDEX %s ON %s(%s)", unique, name, index.Table, strings.Join(index.Columns, ","))
+	_, err = m.Exec(query)
+	if err != nil {
+		return errors.Wrapf(err, "创建索引(%s)发生错误", name)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"flow/schema"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceTaskInfo 服务任务信息
+type ServiceTaskInfo struct {
+	Name         string                 // 处理函数名称
+	Node         *schema.Node           // 节点信息
+	FlowInstance *schema.FlowInstance   // 流程实例
+	NodeInstance *schema.NodeInstance   // 节点实例
+	Input        map[string]interface{} // 流程数据
+}
+
+// ServiceHandler 服务任务处理函数(返回的变量合并到流程数据中后继续流转)
+type ServiceHandler func(ctx context.Context, task *ServiceTaskInfo) (map[string]interface{}, error)
+
+// RegisterServiceHandler 注册服务任务处理函数
+// name 对应节点的camunda:delegateExpression(如${sendMail}中的sendMail)、camunda:topic或camunda:type
+func (e *Engine) RegisterServiceHandler(name string, handler ServiceHandler) {
+	e.serviceLock.Lock()
+	defer e.serviceLock.Unlock()
+
+	if e.serviceHandlers == nil {
+		e.serviceHandlers = make(map[string]ServiceHandler)
+	}
+	e.serviceHandlers[name] = handler
+}
+
+func (e *Engine) getServiceHandler(name string) (ServiceHandler, bool) {
+	e.serviceLock.RLock()
+	defer e.serviceLock.RUnlock()
+
+	handler, ok := e.serviceHandlers[name]
+	return handler, ok
+}
+
+// 获取服务任务的处理函数名称(依次按delegateExpression、topic、type查找)
+func serviceHandlerName(prop map[string]string) string {
+	if v := prop["delegate_expression"]; v != "" {
+		return trimExpression(v)
+	}
+	if v := prop["topic"]; v != "" {
+		return v
+	}
+	return prop["service_type"]
+}
+
+// 去除表达式的${}包装(如${sendMail}转换为sendMail)
+func trimExpression(v string) string {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "${") && strings.HasSuffix(v, "}") {
+		v = strings.TrimSpace(v[2 : len(v)-1])
+	}
+	return v
+}
+
+// 执行服务任务，返回合并处理结果后的流程数据
+func (e *Engine) execServiceTask(ctx context.Context, task *ServiceTaskInfo, inputData []byte) ([]byte, error) {
+	handler, ok := e.getServiceHandler(task.Name)
+	if !ok {
+		return nil, errors.Errorf("未注册服务任务处理函数：%s", task.Name)
+	}
+
+	task.Input = make(map[string]interface{})
+	if len(inputData) > 0 {
+		if err := json.Unmarshal(inputData, &task.Input); err != nil {
+			return nil, errors.Wrapf(err, "解析流程数据发生错误")
+		}
+	}
+
+	vars, err := handler(ctx, task)
+	if err != nil {
+		return nil, errors.Wrapf(err, "执行服务任务(%s)发生错误", task.Node.Code)
+	}
+	return mergeInputData(inputData, vars)
+}
+
+// 将变量合并到流程数据中
+func mergeInputData(inputData []byte, vars map[string]interface{}) ([]byte, error) {
+	if len(vars) == 0 {
+		return inputData, nil
+	}
+
+	input := make(map[string]interface{})
+	if len(inputData) > 0 {
+		if err := json.Unmarshal(inputData, &input); err != nil {
+			return nil, errors.Wrapf(err, "解析流程数据发生错误")
+		}
+	}
+
+	for k, v := range vars {
+		input[k] = v
+	}
+	return json.Marshal(input)
+}
@@ -0,0 +1,191 @@
+package flow
+
+import (
+	"context"
+	"flow/model"
+	"flow/schema"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// SignalFailure 信号广播中处理失败的目标
+type SignalFailure struct {
+	NodeID         string // 接收信号的节点内码
+	FlowInstanceID string // 流程实例内码(按信号开始事件发起流程实例失败时为空)
+	Err            error  // 错误
+}
+
+// SignalBroadcastError 信号广播错误(部分目标处理失败，其他目标的处理已提交)
+type SignalBroadcastError struct {
+	SignalName string           // 信号名称
+	Failures   []*SignalFailure // 处理失败的目标
+}
+
+func (e *SignalBroadcastError) Error() string {
+	return fmt.Sprintf("信号(%s)有%d个目标处理失败：%v", e.SignalName, len(e.Failures), e.Failures[0].Err)
+}
+
+// BroadcastSignal 广播信号
+// 继续流转所有等待该信号的节点实例(信号中间捕获事件)，触发附加在待处理节点实例上的信号边界事件，
+// 并按信号开始事件发起最新版本流程的实例；每个目标在单独的事务中处理，返回处理成功的结果，
+// 部分目标处理失败时同时返回*SignalBroadcastError
+// (不能在已有事务中调用，失败目标的部分写入会随外层事务提交)
+// name 信号名称
+// variables 合并到流程数据的变量
+func (e *Engine) BroadcastSignal(ctx context.Context, name string, variables map[string]interface{}) ([]*HandleResult, error) {
+	if model.InTransaction(ctx) {
+		return nil, errors.New("不能在已有事务中广播信号")
+	}
+
+	results, failures, err := e.broadcastSignal(ctx, name, variables)
+	if err != nil {
+		return nil, err
+	} else if len(failures) > 0 {
+		return results, &SignalBroadcastError{SignalName: name, Failures: failures}
+	}
+	return results, nil
+}
+
+// 接收信号的目标(发起的流程实例或等待信号的节点实例)
+type signalTarget struct {
+	flowInstanceID string
+	handle         func(ctx context.Context) (*HandleResult, error)
+}
+
+// 逐个处理接收信号的目标，返回处理结果及处理失败的目标
+// (上下文中已存在事务时共用该事务，调用方须在任一目标失败时回滚整个事务)
+func (e *Engine) broadcastSignal(ctx context.Context, name string, variables map[string]interface{}) ([]*HandleResult, []*SignalFailure, error) {
+	nodes, err := e.flowBll.QueryNodesByProperty(ctx, "signal_name", name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		results  []*HandleResult
+		failures []*SignalFailure
+	)
+	for _, node := range nodes {
+		targets, err := e.querySignalTargets(ctx, node, variables)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, target := range targets {
+			var result *HandleResult
+			err := e.flowBll.Transaction(ctx, func(ctx context.Context) error {
+				var err error
+				result, err = target.handle(ctx)
+				return err
+			})
+			if err != nil {
+				failures = append(failures, &SignalFailure{NodeID: node.RecordID, FlowInstanceID: target.flowInstanceID, Err: err})
+			} else if result != nil {
+				results = append(results, result)
+			}
+		}
+	}
+	return results, failures, nil
+}
+
+// 查询节点上接收信号的目标
+func (e *Engine) querySignalTargets(ctx context.Context, node *schema.Node, variables map[string]interface{}) ([]*signalTarget, error) {
+	switch node.TypeCode {
+	case StartEvent.String():
+		latest, err := e.isLatestFlow(ctx, node.FlowID)
+		if err != nil || !latest {
+			return nil, err
+		}
+
+		return []*signalTarget{{handle: func(ctx context.Context) (*HandleResult, error) {
+			return e.startSignalFlow(ctx, node, variables)
+		}}}, nil
+	case IntermediateCatchEvent.String():
+		nodeInstances, err := e.flowBll.QueryPendingNodeInstancesByNode(ctx, node.RecordID)
+		if err != nil {
+			return nil, err
+		}
+
+		var targets []*signalTarget
+		for _, ni := range nodeInstances {
+			ni := ni
+			targets = append(targets, &signalTarget{flowInstanceID: ni.FlowInstanceID, handle: func(ctx context.Context) (*HandleResult, error) {
+				return e.continueSignalCatch(ctx, ni, variables)
+			}})
+		}
+		return targets, nil
+	case BoundaryEvent.String():
+		prop, err := e.flowBll.GetNodeProperty(ctx, node.RecordID)
+		if err != nil {
+			return nil, err
+		}
+
+		attached, err := e.flowBll.GetNodeByCode(ctx, node.FlowID, prop["attached_to"])
+		if err != nil {
+			return nil, err
+		} else if attached == nil {
+			return nil, ErrNotFound
+		}
+
+		nodeInstances, err := e.flowBll.QueryPendingNodeInstancesByNode(ctx, attached.RecordID)
+		if err != nil {
+			return nil, err
+		}
+
+		var targets []*signalTarget
+		for _, ni := range nodeInstances {
+			ni := ni
+			targets = append(targets, &signalTarget{flowInstanceID: ni.FlowInstanceID, handle: func(ctx context.Context) (*HandleResult, error) {
+				return e.triggerSignalBoundary(ctx, node, prop, ni, variables)
+			}})
+		}
+		return targets, nil
+	}
+	return nil, nil
+}
+
+// 按信号开始事件发起流程实例
+func (e *Engine) startSignalFlow(ctx context.Context, node *schema.Node, variables map[string]interface{}) (*HandleResult, error) {
+	inputData, err := mergeInputData(nil, variables)
+	if err != nil {
+		return nil, err
+	}
+	return e.startEventFlow(ctx, node, inputData)
+}
+
+// 继续流转等待信号的中间捕获事件(流程实例已结束时跳过)
+func (e *Engine) continueSignalCatch(ctx context.Context, ni *schema.NodeInstance, variables map[string]interface{}) (*HandleResult, error) {
+	active, err := e.isActiveFlowInstance(ctx, ni.FlowInstanceID)
+	if err != nil || !active {
+		return nil, err
+	}
+
+	inputData, err := mergeInputData([]byte(ni.InputData), variables)
+	if err != nil {
+		return nil, err
+	}
+	return e.continueFlow(ctx, ni.RecordID, "", inputData)
+}
+
+// 触发附加在待处理节点实例上的信号边界事件(中断事件取消当前节点，流程实例已结束时跳过)
+func (e *Engine) triggerSignalBoundary(ctx context.Context, event *schema.Node, prop map[string]string, ni *schema.NodeInstance, variables map[string]interface{}) (*HandleResult, error) {
+	active, err := e.isActiveFlowInstance(ctx, ni.FlowInstanceID)
+	if err != nil || !active {
+		return nil, err
+	}
+
+	if prop["cancel_activity"] != "false" {
+		err = e.cancelNodeInstance(ctx, ni)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inputData, err := mergeInputData([]byte(ni.InputData), variables)
+	if err != nil {
+		return nil, err
+	}
+	ni.InputData = string(inputData)
+
+	return e.triggerBoundaryEvent(ctx, ni, event.RecordID, "")
+}
@@ -0,0 +1,65 @@
+package flow
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// 子流程的变量映射(对应camunda:in及camunda:out)
+type variableMapping struct {
+	Source string `json:"source,omitempty"` // 源变量
+	Target string `json:"target,omitempty"` // 目标变量(为空时与源变量相同)
+	All    bool   `json:"all,omitempty"`    // 传递全部变量(variables="all")
+}
+
+// 获取子流程节点的变量映射(内嵌子流程传递全部变量)
+func subFlowMappings(nodeType NodeType, value string) ([]*variableMapping, error) {
+	if nodeType == SubProcess {
+		return []*variableMapping{{All: true}}, nil
+	} else if value == "" {
+		return nil, nil
+	}
+
+	var mappings []*variableMapping
+	if err := json.Unmarshal([]byte(value), &mappings); err != nil {
+		return nil, errors.Wrapf(err, "解析子流程的变量映射发生错误")
+	}
+	return mappings, nil
+}
+
+// 按变量映射从流程数据中取出变量
+func mapVariables(inputData []byte, mappings []*variableMapping) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	if len(mappings) == 0 {
+		return vars, nil
+	}
+
+	input := make(map[string]interface{})
+	if len(inputData) > 0 {
+		if err := json.Unmarshal(inputData, &input); err != nil {
+			return nil, errors.Wrapf(err, "解析流程数据发生错误")
+		}
+	}
+
+	for _, m := range mappings {
+		if m.All {
+			for k, v := range input {
+				vars[k] = v
+			}
+			continue
+		}
+
+		v, ok := input[m.Source]
+		if !ok {
+			continue
+		}
+
+		target := m.Target
+		if target == "" {
+			target = m.Source
+		}
+		vars[target] = v
+	}
+	return vars, nil
+}
@@ -0,0 +1,416 @@
+package flow
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimerType 定时器类型(对应BPMN的timerEventDefinition)
+type TimerType string
+
+func (t TimerType) String() string {
+	return string(t)
+}
+
+const (
+	// TimeDuration 延迟时长(ISO 8601，如PT2H30M)
+	TimeDuration TimerType = "timeDuration"
+	// TimeDate 指定时间(ISO 8601，如2018-01-23T18:00:00+08:00)
+	TimeDate TimerType = "timeDate"
+	// TimeCycle 循环周期(ISO 8601重复间隔如R3/PT1H，或cron表达式)
+	TimeCycle TimerType = "timeCycle"
+)
+
+// Timer 定时器定义
+type Timer struct {
+	Type        TimerType // 定时器类型
+	Value       string    // 定义文本
+	duration    *isoDuration
+	date        time.Time
+	start       time.Time
+	repetitions int // 循环次数(-1表示不限次数)
+	cron        *cronSchedule
+}
+
+// ParseTimer 解析定时器定义
+// 未指定类型时按定义文本识别，纯数字按分钟处理(兼容原timing属性)
+func ParseTimer(typ TimerType, value string) (*Timer, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, errors.New("定时器定义为空")
+	}
+
+	if typ == "" {
+		if minutes, err := strconv.Atoi(value); err == nil {
+			return &Timer{Type: TimeDuration, Value: value, duration: &isoDuration{clock: time.Duration(minutes) * time.Minute}}, nil
+		}
+		typ = detectTimerType(value)
+	}
+
+	t := &Timer{Type: typ, Value: value}
+	var err error
+	switch typ {
+	case TimeDuration:
+		t.duration, err = parseISODuration(value)
+	case TimeDate:
+		t.date, err = parseISODate(value)
+	case TimeCycle:
+		err = t.parseCycle(value)
+	default:
+		err = errors.Errorf("未知的定时器类型：%s", typ)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// 按定义文本识别定时器类型
+func detectTimerType(value string) TimerType {
+	switch {
+	case strings.HasPrefix(value, "P"):
+		return TimeDuration
+	case strings.HasPrefix(value, "R"):
+		return TimeCycle
+	case len(strings.Fields(value)) >= 5:
+		return TimeCycle
+	}
+	return TimeDate
+}
+
+// 解析循环周期(R[n]/[开始时间/]时长 或 cron表达式)
+func (t *Timer) parseCycle(value string) error {
+	if !strings.HasPrefix(value, "R") {
+		cron, err := parseCron(value)
+		if err != nil {
+			return err
+		}
+		t.cron = cron
+		t.repetitions = -1
+		return nil
+	}
+
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return errors.Errorf("无效的循环周期：%s", value)
+	}
+
+	t.repetitions = -1
+	if n := strings.TrimPrefix(parts[0], "R"); n != "" {
+		v, err := strconv.Atoi(n)
+		if err != nil || v < 0 {
+			return errors.Errorf("无效的循环次数：%s", value)
+		}
+		t.repetitions = v
+	}
+
+	if len(parts) == 3 {
+		start, err := parseISODate(parts[1])
+		if err != nil {
+			return err
+		}
+		t.start = start
+	}
+
+	d, err := parseISODuration(parts[len(parts)-1])
+	if err != nil {
+		return err
+	} else if d.isZero() {
+		return errors.Errorf("循环周期的时长不能为0：%s", value)
+	}
+	t.duration = d
+	return nil
+}
+
+// Next 获取from之后的首次触发时间(无需触发时返回false)
+// 时长按工作日历计算，cal为空时按自然时间计算
+func (t *Timer) Next(from time.Time, cal BusinessCalendar) (time.Time, bool) {
+	if cal == nil {
+		cal = DefaultCalendar()
+	}
+
+	switch t.Type {
+	case TimeDuration:
+		if t.duration.isZero() || t.duration.clock < 0 {
+			return time.Time{}, false
+		}
+		return t.duration.addTo(from, cal), true
+	case TimeDate:
+		return t.date, true
+	case TimeCycle:
+		if t.repetitions == 0 {
+			return time.Time{}, false
+		} else if t.cron != nil {
+			return t.cron.next(from)
+		} else if t.start.IsZero() {
+			return t.duration.addTo(from, cal), true
+		}
+
+		next := t.start
+		for next.Before(from) {
+			next = t.duration.addTo(next, cal)
+		}
+		return next, true
+	}
+	return time.Time{}, false
+}
+
+// Repeat 获取触发一次后剩余的循环定时(非循环定时或次数用尽时返回nil)
+func (t *Timer) Repeat() *Timer {
+	if t.Type != TimeCycle || t.repetitions == 0 || t.repetitions == 1 {
+		return nil
+	} else if t.cron != nil || t.repetitions < 0 {
+		return t
+	}
+
+	c := *t
+	c.repetitions--
+	c.start = time.Time{}
+	c.Value = "R" + strconv.Itoa(c.repetitions) + "/" + t.Value[strings.LastIndex(t.Value, "/")+1:]
+	return &c
+}
+
+// isoDuration ISO 8601时长(年月按自然日历计算，日按工作日计算，时分秒按工作时长计算)
+type isoDuration struct {
+	years, months, days int
+	clock               time.Duration
+}
+
+func (d *isoDuration) isZero() bool {
+	return d.years == 0 && d.months == 0 && d.days == 0 && d.clock == 0
+}
+
+func (d *isoDuration) addTo(t time.Time, cal BusinessCalendar) time.Time {
+	return cal.AddDuration(cal.AddDays(t.AddDate(d.years, d.months, 0), d.days), d.clock)
+}
+
+var isoDurationRegexp = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+// 解析ISO 8601时长(PnYnMnWnDTnHnMnS)
+func parseISODuration(value string) (*isoDuration, error) {
+	m := isoDurationRegexp.FindStringSubmatch(value)
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return nil, errors.Errorf("无效的ISO 8601时长：%s", value)
+	}
+
+	n := make([]int, 7)
+	for i := 1; i <= 6; i++ {
+		if m[i] != "" {
+			n[i], _ = strconv.Atoi(m[i])
+		}
+	}
+
+	d := &isoDuration{
+		years:  n[1],
+		months: n[2],
+		days:   n[3]*7 + n[4],
+		clock:  time.Duration(n[5])*time.Hour + time.Duration(n[6])*time.Minute,
+	}
+	if m[7] != "" {
+		s, _ := strconv.ParseFloat(strings.Replace(m[7], ",", ".", 1), 64)
+		d.clock += time.Duration(math.Round(s * float64(time.Second)))
+	}
+	return d, nil
+}
+
+// 解析ISO 8601时间(未指定时区时使用本地时区)
+func parseISODate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("无效的ISO 8601时间：%s", value)
+}
+
+// cronSchedule cron表达式(分 时 日 月 周，或在开头增加秒)
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMonthNames = map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6, "JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}
+	cronDowNames   = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+)
+
+// 解析cron表达式(周的取值与Unix cron一致，0或7表示周日)
+func parseCron(value string) (*cronSchedule, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	} else if len(fields) != 6 {
+		return nil, errors.Errorf("无效的cron表达式：%s", value)
+	}
+
+	s := new(cronSchedule)
+	var err error
+	for i, item := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.second, cronField{0, 59, nil}},
+		{&s.minute, cronField{0, 59, nil}},
+		{&s.hour, cronField{0, 23, nil}},
+		{&s.dom, cronField{1, 31, nil}},
+		{&s.month, cronField{1, 12, cronMonthNames}},
+		{&s.dow, cronField{0, 7, cronDowNames}},
+	} {
+		*item.bits, err = parseCronField(fields[i], item.field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "无效的cron表达式：%s", value)
+		}
+	}
+
+	// 7与0均表示周日
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[3] == "*" || fields[3] == "?"
+	s.dowStar = fields[5] == "*" || fields[5] == "?"
+	return s, nil
+}
+
+// 解析cron字段(支持*、?、列表、范围、步长及英文缩写)
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			v, err := strconv.Atoi(part[i+1:])
+			if err != nil || v <= 0 {
+				return 0, errors.Errorf("无效的步长：%s", part)
+			}
+			step = v
+			part = part[:i]
+		}
+
+		start, end := field.min, field.max
+		if part != "*" && part != "?" {
+			bounds := strings.SplitN(part, "-", 2)
+			v, err := cronValue(bounds[0], field)
+			if err != nil {
+				return 0, err
+			}
+			start, end = v, v
+			if len(bounds) == 2 {
+				end, err = cronValue(bounds[1], field)
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				end = field.max
+			}
+		}
+
+		if start > end {
+			return 0, errors.Errorf("无效的范围：%s", part)
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(value string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToUpper(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < field.min || v > field.max {
+		return 0, errors.Errorf("无效的取值：%s", value)
+	}
+	return v, nil
+}
+
+// 检查日期是否匹配(日与周均有限定时满足其一即可)
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// 获取from之后的首次触发时间(5年内无匹配时返回false)
+func (s *cronSchedule) next(from time.Time) (time.Time, bool) {
+	loc := from.Location()
+	t := from.Truncate(time.Second).Add(time.Second)
+	yearLimit := t.Year() + 5
+	added := false
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}, false
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for s.second&(1<<uint(t.Second())) == 0 {
+		if !added {
+			added = true
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+	return t, true
+}
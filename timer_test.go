@@ -0,0 +1,115 @@
+package flow
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimer(t *testing.T) {
+	from := time.Date(2018, 1, 31, 10, 0, 0, 0, time.UTC)
+
+	for _, item := range []struct {
+		typ      TimerType
+		value    string
+		expected time.Time
+	}{
+		{"", "30", from.Add(30 * time.Minute)},
+		{TimeDuration, "PT2H30M", from.Add(150 * time.Minute)},
+		{TimeDuration, "P1DT0.5S", from.Add(24*time.Hour + 500*time.Millisecond)},
+		{TimeDuration, "P1M", time.Date(2018, 3, 3, 10, 0, 0, 0, time.UTC)},
+		{"", "P2W", from.AddDate(0, 0, 14)},
+		{TimeDate, "2018-02-01T08:00:00Z", time.Date(2018, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{TimeCycle, "R3/PT1H", from.Add(time.Hour)},
+		{TimeCycle, "R/2018-01-31T09:30:00Z/PT20M", time.Date(2018, 1, 31, 10, 10, 0, 0, time.UTC)},
+		{TimeCycle, "0 9 * * MON-FRI", time.Date(2018, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"", "30 0 12 1 * ?", time.Date(2018, 2, 1, 12, 0, 30, 0, time.UTC)},
+		{TimeCycle, "*/15 * * * *", time.Date(2018, 1, 31, 10, 15, 0, 0, time.UTC)},
+	} {
+		timer, err := ParseTimer(item.typ, item.value)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		next, ok := timer.Next(from, nil)
+		if !ok || !next.Equal(item.expected) {
+			t.Fatalf("无效的触发时间(%s)：%v", item.value, next)
+		}
+	}
+}
+
+func TestParseTimerInvalid(t *testing.T) {
+	for _, item := range []struct {
+		typ   TimerType
+		value string
+	}{
+		{TimeDuration, "P"},
+		{TimeDuration, "PT"},
+		{TimeDuration, "2H"},
+		{TimeDate, "2018-13-01"},
+		{TimeCycle, "R3/PT0S"},
+		{TimeCycle, "61 * * * *"},
+		{"timeUnknown", "PT1H"},
+	} {
+		if _, err := ParseTimer(item.typ, item.value); err == nil {
+			t.Fatalf("期望定时器定义错误：%s", item.value)
+		}
+	}
+}
+
+func TestTimerRepeat(t *testing.T) {
+	timer, err := ParseTimer(TimeCycle, "R2/2018-01-31T09:30:00Z/PT1H")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	next := timer.Repeat()
+	if next == nil || next.Value != "R1/PT1H" {
+		t.Fatalf("无效的剩余循环：%+v", next)
+	} else if next.Repeat() != nil {
+		t.Fatal("循环次数用尽后不应继续触发")
+	}
+
+	if timer, _ = ParseTimer("", "0"); timer != nil {
+		if _, ok := timer.Next(time.Now(), nil); ok {
+			t.Fatal("时长为0的定时不应触发")
+		}
+	}
+}
+
+func TestParseTimerEventDefinition(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <bpmn:process id="process_timer" isExecutable="true">
+    <bpmn:startEvent id="node_start" />
+    <bpmn:userTask id="node_task">
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration xsi:type="bpmn:tFormalExpression">PT2H</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:userTask>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	result, err := NewXMLParser().Parse(context.Background(), []byte(data))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	props := make(map[string]string)
+	for _, node := range result.Nodes {
+		if node.NodeID == "node_task" {
+			for _, p := range node.Properties {
+				props[p.Name] = p.Value
+			}
+		}
+	}
+	if props["timing"] != "PT2H" || props["timing_type"] != "timeDuration" {
+		t.Fatalf("无效的定时器属性：%v", props)
+	}
+
+	_, err = NewXMLParser().Parse(context.Background(), []byte(strings.Replace(data, "PT2H", "2H", 1)))
+	if err == nil {
+		t.Fatal("期望定时器定义错误")
+	}
+}